@@ -11,6 +11,7 @@ var INDENT_TRACKER = 0
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Position // position of the node's token in the source
 }
 type Statement interface {
 	Node
@@ -23,6 +24,25 @@ type Expression interface {
 
 type Program struct {
 	Statements []Statement
+
+	// only filled when parsing with parser.ParseComments
+	Comments    []StatementComments // Comments[i] are the comments around Statements[i]
+	EndComments []Comment           // comments after the last statement
+}
+
+// Comment is a # line comment or a #[ ... ]# block comment
+type Comment struct {
+	Token token.Token // token.COMMENT
+}
+
+func (c Comment) TokenLiteral() string { return c.Token.Literal }
+func (c Comment) Pos() token.Position  { return c.Token.Pos }
+func (c Comment) String() string       { return c.Token.Literal }
+
+// StatementComments are the comments attached to a statement
+type StatementComments struct {
+	Leading  []Comment // on the lines before the statement
+	Trailing []Comment // inside the statement, or after it on the line it ends
 }
 
 // returns the token literal of the first statement
@@ -34,6 +54,14 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
+// returns the position of the first statement
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
 func (p *Program) String() string {
 	var sb strings.Builder
 	for i, s := range p.Statements {
@@ -49,10 +77,16 @@ func (p *Program) String() string {
 type BlockStatement struct {
 	Token      token.Token // token.LBracket
 	Statements []Statement
+	Slots      int // variables of the scope the block runs in, set by the resolver
+
+	// only filled when parsing with parser.ParseComments, same as in Program
+	Comments    []StatementComments
+	EndComments []Comment // comments between the last statement and the closing bracket
 }
 
 func (bs BlockStatement) statementNode()       {}
 func (bs BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs BlockStatement) Pos() token.Position  { return bs.Token.Pos }
 func (bs BlockStatement) String() string {
 	var sb strings.Builder
 
@@ -69,12 +103,16 @@ func (bs BlockStatement) String() string {
 
 type LetStatement struct {
 	// Statement
-	Token      token.Token // token.LET
+	Token      token.Token // token.LET or token.CONST
 	Identifier IdentifierExpression
 	Expression Expression
 }
 
+// IsConst is true for const statements, their binding cannot be assigned to
+func (ls LetStatement) IsConst() bool { return ls.Token.Type == token.CONST }
+
 func (ls LetStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls LetStatement) Pos() token.Position  { return ls.Token.Pos }
 func (ls LetStatement) statementNode()       {}
 func (ls LetStatement) String() string {
 	var sb strings.Builder
@@ -96,6 +134,7 @@ type ReturnStatement struct {
 }
 
 func (rs ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs ReturnStatement) Pos() token.Position  { return rs.Token.Pos }
 func (rs ReturnStatement) statementNode()       {}
 func (rs ReturnStatement) String() string {
 	var sb strings.Builder
@@ -108,6 +147,103 @@ func (rs ReturnStatement) String() string {
 	return sb.String()
 }
 
+type ForStatement struct {
+	// Statement
+	Token     token.Token // token.FOR
+	Condition Expression
+	Body      BlockStatement
+}
+
+func (fs ForStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs ForStatement) Pos() token.Position  { return fs.Token.Pos }
+func (fs ForStatement) statementNode()       {}
+func (fs ForStatement) String() string {
+	var sb strings.Builder
+
+	sb.WriteString("for (")
+	sb.WriteString(fs.Condition.String())
+	sb.WriteString(") ")
+	sb.WriteString(fs.Body.String())
+
+	return sb.String()
+}
+
+type ForInStatement struct {
+	// Statement
+	Token      token.Token // token.FOR
+	Identifier IdentifierExpression
+	Iterable   Expression
+	Body       BlockStatement
+}
+
+func (fs ForInStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs ForInStatement) Pos() token.Position  { return fs.Token.Pos }
+func (fs ForInStatement) statementNode()       {}
+func (fs ForInStatement) String() string {
+	var sb strings.Builder
+
+	sb.WriteString("for (")
+	sb.WriteString(fs.Identifier.String())
+	sb.WriteString(" in ")
+	sb.WriteString(fs.Iterable.String())
+	sb.WriteString(") ")
+	sb.WriteString(fs.Body.String())
+
+	return sb.String()
+}
+
+// TryStatement is try { } catch (e) { } finally { }, at least one of catch and finally is there
+type TryStatement struct {
+	// Statement
+	Token      token.Token // token.TRY
+	Body       BlockStatement
+	CatchParam *IdentifierExpression // nil without a catch
+	Catch      *BlockStatement       // nil without a catch
+	Finally    *BlockStatement       // nil without a finally
+}
+
+func (ts TryStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts TryStatement) Pos() token.Position  { return ts.Token.Pos }
+func (ts TryStatement) statementNode()       {}
+func (ts TryStatement) String() string {
+	var sb strings.Builder
+
+	sb.WriteString("try ")
+	sb.WriteString(ts.Body.String())
+	if ts.Catch != nil {
+		sb.WriteString(" catch (")
+		sb.WriteString(ts.CatchParam.String())
+		sb.WriteString(") ")
+		sb.WriteString(ts.Catch.String())
+	}
+	if ts.Finally != nil {
+		sb.WriteString(" finally ")
+		sb.WriteString(ts.Finally.String())
+	}
+
+	return sb.String()
+}
+
+type BreakStatement struct {
+	// Statement
+	Token token.Token // token.BREAK
+}
+
+func (bs BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs BreakStatement) Pos() token.Position  { return bs.Token.Pos }
+func (bs BreakStatement) statementNode()       {}
+func (bs BreakStatement) String() string       { return bs.TokenLiteral() + ";" }
+
+type ContinueStatement struct {
+	// Statement
+	Token token.Token // token.CONTINUE
+}
+
+func (cs ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs ContinueStatement) Pos() token.Position  { return cs.Token.Pos }
+func (cs ContinueStatement) statementNode()       {}
+func (cs ContinueStatement) String() string       { return cs.TokenLiteral() + ";" }
+
 type IfExpression struct {
 	// Statement
 	Token      token.Token // token.IF
@@ -116,6 +252,7 @@ type IfExpression struct {
 }
 
 func (ie IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie IfExpression) Pos() token.Position  { return ie.Token.Pos }
 func (ie IfExpression) expressionNode()      {}
 func (ie IfExpression) String() string {
 	var sb strings.Builder
@@ -146,15 +283,35 @@ type ExpressionStatement struct {
 }
 
 func (es ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
+func (es ExpressionStatement) Pos() token.Position  { return es.Token.Pos }
 func (es ExpressionStatement) statementNode()       {}
 func (es ExpressionStatement) String() string       { return es.Expression.String() }
 
 type IdentifierExpression struct {
 	// Expression
-	Token token.Token // token.Identifier + name
+	Token   token.Token // token.Identifier + name
+	Binding Binding     // the variable the name refers to, set by the resolver
+}
+
+// Binding is where the variable an identifier refers to lives at run time
+type Binding struct {
+	Scope BindingScope
+	Depth int  // how many scopes out from the one of the identifier, for locals
+	Slot  int  // of the variable in its scope or among the globals, the index of a builtin
+	Const bool // whether a local cannot be assigned to, globals find out when their declaration runs
 }
 
+type BindingScope int
+
+const (
+	Unresolved BindingScope = iota
+	Local
+	Global
+	Builtin
+)
+
 func (ie IdentifierExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie IdentifierExpression) Pos() token.Position  { return ie.Token.Pos }
 func (ie IdentifierExpression) expressionNode()      {}
 func (ie IdentifierExpression) String() string       { return ie.TokenLiteral() }
 
@@ -164,6 +321,7 @@ type BooleanExpression struct {
 }
 
 func (be BooleanExpression) TokenLiteral() string { return be.Token.Literal }
+func (be BooleanExpression) Pos() token.Position  { return be.Token.Pos }
 func (be BooleanExpression) expressionNode()      {}
 func (be BooleanExpression) String() string       { return be.TokenLiteral() }
 
@@ -173,9 +331,20 @@ type IntExpression struct {
 }
 
 func (ie IntExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie IntExpression) Pos() token.Position  { return ie.Token.Pos }
 func (ie IntExpression) expressionNode()      {}
 func (ie IntExpression) String() string       { return ie.TokenLiteral() }
 
+type FloatExpression struct {
+	// Expression
+	Token token.Token // token.FLOAT + value
+}
+
+func (fe FloatExpression) TokenLiteral() string { return fe.Token.Literal }
+func (fe FloatExpression) Pos() token.Position  { return fe.Token.Pos }
+func (fe FloatExpression) expressionNode()      {}
+func (fe FloatExpression) String() string       { return fe.TokenLiteral() }
+
 type PrefixExpression struct {
 	// Expression
 	Token      token.Token // operator toke (e.g. MINUS, EXCLAMATION)
@@ -188,10 +357,12 @@ type StringExpression struct {
 }
 
 func (se StringExpression) TokenLiteral() string { return se.Token.Literal }
+func (se StringExpression) Pos() token.Position  { return se.Token.Pos }
 func (se StringExpression) expressionNode()      {}
 func (se StringExpression) String() string       { return se.TokenLiteral() }
 
 func (pe PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe PrefixExpression) Pos() token.Position  { return pe.Token.Pos }
 func (pe PrefixExpression) expressionNode()      {}
 func (pe PrefixExpression) String() string {
 	var sb strings.Builder
@@ -204,6 +375,50 @@ func (pe PrefixExpression) String() string {
 	return sb.String()
 }
 
+type PostfixExpression struct {
+	// Expression
+	Token      token.Token // operator token (INCREMENT or DECREMENT)
+	Expression Expression
+}
+
+func (pe PostfixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe PostfixExpression) Pos() token.Position  { return pe.Token.Pos }
+func (pe PostfixExpression) expressionNode()      {}
+func (pe PostfixExpression) String() string {
+	var sb strings.Builder
+
+	sb.WriteString("(")
+	sb.WriteString(pe.Expression.String())
+	sb.WriteString(pe.TokenLiteral())
+	sb.WriteString(")")
+
+	return sb.String()
+}
+
+type AssignExpression struct {
+	// Expression
+	Token  token.Token // token.EQUAL, token.PLUS_EQUAL or token.MINUS_EQUAL
+	Target Expression  // IdentifierExpression or IndexExpression
+	Value  Expression
+}
+
+func (ae AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae AssignExpression) Pos() token.Position  { return ae.Token.Pos }
+func (ae AssignExpression) expressionNode()      {}
+func (ae AssignExpression) String() string {
+	var sb strings.Builder
+
+	sb.WriteString("(")
+	sb.WriteString(ae.Target.String())
+	sb.WriteString(" ")
+	sb.WriteString(ae.TokenLiteral())
+	sb.WriteString(" ")
+	sb.WriteString(ae.Value.String())
+	sb.WriteString(")")
+
+	return sb.String()
+}
+
 type InfixExpression struct {
 	// Expression
 	Token token.Token // operator toke (e.g. MINUS, EXCLAMATION)
@@ -212,6 +427,7 @@ type InfixExpression struct {
 }
 
 func (ie InfixExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie InfixExpression) Pos() token.Position  { return ie.Token.Pos }
 func (ie InfixExpression) expressionNode()      {}
 func (ie InfixExpression) String() string {
 	var sb strings.Builder
@@ -229,17 +445,18 @@ func (ie InfixExpression) String() string {
 
 type CallExpression struct {
 	// Expression
-	Token      token.Token // the function identifier
-	Identifier IdentifierExpression
-	Args       []Expression
+	Token    token.Token // the ( token
+	Function Expression  // any expression that evaluates to a function
+	Args     []Expression
 }
 
 func (ce CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce CallExpression) Pos() token.Position  { return ce.Token.Pos }
 func (ce CallExpression) expressionNode()      {}
 func (ce CallExpression) String() string {
 	var sb strings.Builder
 
-	sb.WriteString(ce.TokenLiteral() + "(")
+	sb.WriteString(ce.Function.String() + "(")
 	for i, a := range ce.Args {
 		sb.WriteString(a.String())
 		if i != len(ce.Args)-1 {
@@ -258,6 +475,7 @@ type ArrayExpression struct {
 }
 
 func (ae ArrayExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae ArrayExpression) Pos() token.Position  { return ae.Token.Pos }
 func (ae ArrayExpression) expressionNode()      {}
 func (ae ArrayExpression) String() string {
 	var sb strings.Builder
@@ -282,6 +500,7 @@ type IndexExpression struct {
 }
 
 func (ie IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie IndexExpression) Pos() token.Position  { return ie.Token.Pos }
 func (ie IndexExpression) expressionNode()      {}
 func (ie IndexExpression) String() string {
 	var sb strings.Builder
@@ -303,6 +522,7 @@ type FunctionExpression struct {
 }
 
 func (fe FunctionExpression) TokenLiteral() string { return fe.Token.Literal }
+func (fe FunctionExpression) Pos() token.Position  { return fe.Token.Pos }
 func (fe FunctionExpression) expressionNode()      {}
 func (fe FunctionExpression) String() string {
 	var sb strings.Builder
@@ -328,6 +548,7 @@ type KeyValuePair struct {
 }
 
 func (kvp KeyValuePair) TokenLiteral() string { return kvp.Token.Literal }
+func (kvp KeyValuePair) Pos() token.Position  { return kvp.Token.Pos }
 func (kvp KeyValuePair) expressionNode()      {}
 func (kvp KeyValuePair) String() string {
 	var sb strings.Builder
@@ -346,6 +567,7 @@ type HashExpression struct {
 }
 
 func (he HashExpression) TokenLiteral() string { return he.Token.Literal }
+func (he HashExpression) Pos() token.Position  { return he.Token.Pos }
 func (he HashExpression) expressionNode()      {}
 func (he HashExpression) String() string {
 	var sb strings.Builder
@@ -12,7 +12,7 @@ func TestString(t *testing.T) {
 	p := Program{Statements: []Statement{
 		LetStatement{
 			Token:      letToken,
-			Identifier: IdentifierExpression{token.Token{Type: token.LET, Literal: "x"}},
+			Identifier: IdentifierExpression{Token: token.Token{Type: token.LET, Literal: "x"}},
 			Expression: IntExpression{Token: token.Token{Type: token.INT, Literal: "10"}},
 		},
 	}}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"main/benchmarks"
+	"main/diagnostics"
+	"main/evaluator"
+	"main/lexer"
+	"main/parser"
+)
+
+// benchReport is what hydrogen bench measured, saved as JSON to compare later runs with
+type benchReport struct {
+	Engine  string        `json:"engine"`
+	Results []benchResult `json:"results"`
+}
+
+type benchResult struct {
+	Name    string `json:"name"`
+	NsPerOp int64  `json:"ns_per_op"` // median of the timed runs
+	Runs    int    `json:"runs"`
+}
+
+// bench runs hydrogen bench: it times scripts, the benchmark corpus by default, and
+// compares them with a saved baseline. Returns the exit code, 1 if a script got slower
+func bench(args []string) int {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: hydrogen bench [flags] [.hy files or directories]")
+		fmt.Fprintln(flags.Output(), "times the benchmark corpus unless scripts are given")
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&engine, "engine", "eval", "Engine that runs the scripts: eval or vm")
+	runs := flags.Int("runs", 10, "Timed runs of each script, the median is reported")
+	baselinePath := flags.String("baseline", "", "Compare with the results saved in this JSON file")
+	savePath := flags.String("save", "", "Save the results to this JSON file")
+	threshold := flags.Float64("threshold", 10, "How many percent slower than the baseline a script may get")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *runs < 1 {
+		fmt.Fprintln(os.Stderr, "-runs must be at least 1")
+		return 2
+	}
+	maxCallDepth = evaluator.DefaultMaxCallDepth
+	if _, err := newRunner(nil, io.Discard, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	scripts, err := benchScripts(flags.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var baseline *benchReport
+	if *baselinePath != "" {
+		if baseline, err = loadBaseline(*baselinePath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	report := benchReport{Engine: engine}
+	for _, script := range scripts {
+		result, err := benchScript(script, *runs)
+		if err != nil {
+			fmt.Fprint(os.Stderr, err)
+			return 1
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	regressions := printBenchReport(os.Stdout, report, baseline, *threshold)
+
+	if *savePath != "" {
+		if err := saveBaseline(*savePath, report); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	if regressions > 0 {
+		fmt.Printf("%d of %d scripts are more than %g%% slower than the baseline\n", regressions, len(report.Results), *threshold)
+		return 1
+	}
+	return 0
+}
+
+// benchScripts reads the scripts at paths, the .hy files of a directory are all used
+func benchScripts(paths []string) ([]benchmarks.Benchmark, error) {
+	if len(paths) == 0 {
+		return benchmarks.Corpus(), nil
+	}
+
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		matches, err := filepath.Glob(filepath.Join(path, "*.hy"))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+
+	scripts := []benchmarks.Benchmark{}
+	for _, file := range files {
+		source, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		scripts = append(scripts, benchmarks.Benchmark{
+			Name:   strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)),
+			File:   file,
+			Source: string(source),
+		})
+	}
+	return scripts, nil
+}
+
+// benchScript runs a script once to warm up and then times it, every run starts
+// with fresh globals. What the script prints is thrown away
+func benchScript(script benchmarks.Benchmark, runs int) (benchResult, error) {
+	p := parser.CreateParser(lexer.CreateFileLexer(script.File, script.Source))
+	program, errs := p.ParseProgram()
+	if len(errs) != 0 {
+		var sb strings.Builder
+		for _, e := range errs {
+			sb.WriteString(diagnostics.ParserError(script.Source, e))
+		}
+		return benchResult{}, fmt.Errorf("%s", sb.String())
+	}
+
+	times := []time.Duration{}
+	for i := 0; i <= runs; i++ {
+		run, _ := newRunner(nil, io.Discard, os.Stderr)
+		start := time.Now()
+		_, evalErr := run(program)
+		elapsed := time.Since(start)
+		if !evalErr.Ok() {
+			return benchResult{}, fmt.Errorf("%s", diagnostics.RuntimeError(diagnostics.Sources{script.File: script.Source}, evalErr))
+		}
+
+		// the first run warms up
+		if i > 0 {
+			times = append(times, elapsed)
+		}
+	}
+
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	return benchResult{Name: script.Name, NsPerOp: int64(times[len(times)/2]), Runs: runs}, nil
+}
+
+// printBenchReport writes a table of the results, next to the baseline when there is one.
+// Returns how many scripts got slower than the baseline by more than threshold percent
+func printBenchReport(out io.Writer, report benchReport, baseline *benchReport, threshold float64) int {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+
+	if baseline == nil {
+		fmt.Fprintf(w, "script\ttime/op\n")
+		for _, result := range report.Results {
+			fmt.Fprintf(w, "%s\t%s\n", result.Name, benchDuration(result.NsPerOp))
+		}
+		return 0
+	}
+
+	before := map[string]int64{}
+	for _, result := range baseline.Results {
+		before[result.Name] = result.NsPerOp
+	}
+
+	regressions := 0
+	fmt.Fprintf(w, "script\ttime/op\tbaseline\tdelta\t\n")
+	for _, result := range report.Results {
+		base, ok := before[result.Name]
+		if !ok || base == 0 {
+			fmt.Fprintf(w, "%s\t%s\t-\tnew\t\n", result.Name, benchDuration(result.NsPerOp))
+			continue
+		}
+
+		delta := float64(result.NsPerOp-base) / float64(base) * 100
+		verdict := ""
+		if delta > threshold {
+			verdict = "regression"
+			regressions++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%+.1f%%\t%s\n",
+			result.Name, benchDuration(result.NsPerOp), benchDuration(base), delta, verdict)
+	}
+	return regressions
+}
+
+func benchDuration(ns int64) string {
+	return time.Duration(ns).Round(time.Microsecond).String()
+}
+
+func loadBaseline(path string) (*benchReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var baseline benchReport
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		return nil, fmt.Errorf("reading baseline %s: %w", path, err)
+	}
+
+	// the engines are too far apart for a comparison to mean anything
+	if baseline.Engine != engine {
+		return nil, fmt.Errorf("baseline %s was measured with -engine=%s, not %s", path, baseline.Engine, engine)
+	}
+	return &baseline, nil
+}
+
+func saveBaseline(path string, report benchReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,39 @@
+package benchmarks
+
+import (
+	"embed"
+	"path"
+	"strings"
+)
+
+//go:embed *.hy
+var files embed.FS
+
+// Benchmark is a script of the corpus, the programs performance changes are measured with
+type Benchmark struct {
+	Name   string // the file name without .hy
+	File   string
+	Source string
+}
+
+// Corpus returns the benchmark scripts, sorted by name
+func Corpus() []Benchmark {
+	entries, err := files.ReadDir(".") // sorted by file name
+	if err != nil {
+		panic(err) // the files are embedded, reading them cannot fail
+	}
+
+	corpus := []Benchmark{}
+	for _, entry := range entries {
+		source, err := files.ReadFile(entry.Name())
+		if err != nil {
+			panic(err)
+		}
+		corpus = append(corpus, Benchmark{
+			Name:   strings.TrimSuffix(entry.Name(), path.Ext(entry.Name())),
+			File:   path.Join("benchmarks", entry.Name()),
+			Source: string(source),
+		})
+	}
+	return corpus
+}
@@ -0,0 +1,301 @@
+package code
+
+import (
+	"encoding/binary"
+	"fmt"
+	"main/token"
+	"sort"
+	"strings"
+)
+
+// Instructions are the bytecode of a function, opcodes each followed by their operands
+type Instructions []byte
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota // push constant [index]
+	OpNull
+	OpTrue
+	OpFalse
+	OpPop
+	OpDup
+
+	// infix operators, they pop the right and then the left operand
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+	OpEqual
+	OpNotEqual
+	OpLess
+	OpLessEqual
+	OpGreater
+	OpGreaterEqual
+	OpAnd
+	OpOr
+	OpBitAnd
+	OpBitOr
+
+	// prefix operators on a value, OpStep is ++ or -- on a variable
+	OpMinus
+	OpBang
+	OpIncrement
+	OpDecrement
+	OpStep // [1 for ++, 0 for --]
+
+	OpJump        // [address]
+	OpJumpNotTrue // pop the condition, jump unless it is the boolean true [address]
+
+	// variables, globals by slot and locals by how many scopes out and slot
+	OpGetGlobal         // [slot]
+	OpSetGlobal         // assign and keep the value [slot]
+	OpDefineGlobal      // let at the top level [slot]
+	OpDefineConstGlobal // const at the top level [slot]
+	OpDeclarableGlobal  // fail if the global is already declared, before its value is computed [slot]
+	OpAssignableGlobal  // fail unless the global can be assigned to [slot]
+	OpGetLocal          // [slot]
+	OpSetLocal          // assign and keep the value [slot]
+	OpInitLocal         // [slot]
+	OpGetOuter          // [scopes out, slot, name constant]
+	OpSetOuter          // assign and keep the value [scopes out, slot, name constant]
+	OpGetBuiltin        // [builtin]
+	OpPushScope         // enter a scope with variables of its own [size]
+	OpPopScope
+
+	OpArray       // [element count]
+	OpHash        // [pair count]
+	OpIndex       // pop the index and the container
+	OpUpdateIndex // assign to an element, see the Update constants [update kind, operator]
+
+	OpClosure      // [function constant]
+	OpNameFunction // name an unnamed function bound by let [name constant]
+	OpCall         // [argument count, call site]
+	OpTailCall     // call in place of the running function [argument count, call site]
+	OpReturnValue
+
+	OpIter      // replace an iterable with an iterator over its items
+	OpIterNext  // push the next item, or jump once there are none left [address]
+	OpIteration // an iteration of a loop starts, counted as a step of the run
+
+	// loops and try statements push a block that break, continue, return and errors unwind to
+	OpSetupLoop  // [break address, continue address]
+	OpSetupTry   // [catch address, finally address], 0 when there is none
+	OpPopBlock   //
+	OpBreak      //
+	OpContinue   //
+	OpCompletion // wrap the value of a try statement for its finally block
+	OpEndFinally // carry on with what the finally block interrupted
+	OpRaise      // raise a runtime error [message constant]
+)
+
+// how OpUpdateIndex computes the value it stores
+const (
+	UpdateAssign   = iota // the value on the stack
+	UpdateCompound        // the element with the value on the stack, by the operator + or -
+	UpdatePrefix          // the element stepped by the operator ++ or --, evaluating to the new value
+	UpdatePostfix         // the same, evaluating to the old value
+)
+
+type Definition struct {
+	Name          string
+	OperandWidths []int // in bytes
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpNull:     {"OpNull", []int{}},
+	OpTrue:     {"OpTrue", []int{}},
+	OpFalse:    {"OpFalse", []int{}},
+	OpPop:      {"OpPop", []int{}},
+	OpDup:      {"OpDup", []int{}},
+
+	OpAdd:          {"OpAdd", []int{}},
+	OpSub:          {"OpSub", []int{}},
+	OpMul:          {"OpMul", []int{}},
+	OpDiv:          {"OpDiv", []int{}},
+	OpMod:          {"OpMod", []int{}},
+	OpEqual:        {"OpEqual", []int{}},
+	OpNotEqual:     {"OpNotEqual", []int{}},
+	OpLess:         {"OpLess", []int{}},
+	OpLessEqual:    {"OpLessEqual", []int{}},
+	OpGreater:      {"OpGreater", []int{}},
+	OpGreaterEqual: {"OpGreaterEqual", []int{}},
+	OpAnd:          {"OpAnd", []int{}},
+	OpOr:           {"OpOr", []int{}},
+	OpBitAnd:       {"OpBitAnd", []int{}},
+	OpBitOr:        {"OpBitOr", []int{}},
+
+	OpMinus:     {"OpMinus", []int{}},
+	OpBang:      {"OpBang", []int{}},
+	OpIncrement: {"OpIncrement", []int{}},
+	OpDecrement: {"OpDecrement", []int{}},
+	OpStep:      {"OpStep", []int{1}},
+
+	OpJump:        {"OpJump", []int{4}},
+	OpJumpNotTrue: {"OpJumpNotTrue", []int{4}},
+
+	OpGetGlobal:         {"OpGetGlobal", []int{2}},
+	OpSetGlobal:         {"OpSetGlobal", []int{2}},
+	OpDefineGlobal:      {"OpDefineGlobal", []int{2}},
+	OpDefineConstGlobal: {"OpDefineConstGlobal", []int{2}},
+	OpDeclarableGlobal:  {"OpDeclarableGlobal", []int{2}},
+	OpAssignableGlobal:  {"OpAssignableGlobal", []int{2}},
+	OpGetLocal:          {"OpGetLocal", []int{2}},
+	OpSetLocal:          {"OpSetLocal", []int{2}},
+	OpInitLocal:         {"OpInitLocal", []int{2}},
+	OpGetOuter:          {"OpGetOuter", []int{1, 2, 2}},
+	OpSetOuter:          {"OpSetOuter", []int{1, 2, 2}},
+	OpGetBuiltin:        {"OpGetBuiltin", []int{1}},
+	OpPushScope:         {"OpPushScope", []int{2}},
+	OpPopScope:          {"OpPopScope", []int{}},
+
+	OpArray:       {"OpArray", []int{2}},
+	OpHash:        {"OpHash", []int{2}},
+	OpIndex:       {"OpIndex", []int{}},
+	OpUpdateIndex: {"OpUpdateIndex", []int{1, 1}},
+
+	OpClosure:      {"OpClosure", []int{2}},
+	OpNameFunction: {"OpNameFunction", []int{2}},
+	OpCall:         {"OpCall", []int{1, 2}},
+	OpTailCall:     {"OpTailCall", []int{1, 2}},
+	OpReturnValue:  {"OpReturnValue", []int{}},
+
+	OpIter:      {"OpIter", []int{}},
+	OpIterNext:  {"OpIterNext", []int{4}},
+	OpIteration: {"OpIteration", []int{}},
+
+	OpSetupLoop:  {"OpSetupLoop", []int{4, 4}},
+	OpSetupTry:   {"OpSetupTry", []int{4, 4}},
+	OpPopBlock:   {"OpPopBlock", []int{}},
+	OpBreak:      {"OpBreak", []int{}},
+	OpContinue:   {"OpContinue", []int{}},
+	OpCompletion: {"OpCompletion", []int{}},
+	OpEndFinally: {"OpEndFinally", []int{}},
+	OpRaise:      {"OpRaise", []int{2}},
+}
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+// MaxOperand is the largest operand that fits in width bytes
+func MaxOperand(width int) int {
+	return 1<<(8*width) - 1
+}
+
+// Make encodes an instruction, operands wider than their width are truncated.
+// Check them against MaxOperand first
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	length := 1
+	for _, w := range def.OperandWidths {
+		length += w
+	}
+
+	instruction := make([]byte, length)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		switch def.OperandWidths[i] {
+		case 1:
+			instruction[offset] = byte(o)
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 4:
+			binary.BigEndian.PutUint32(instruction[offset:], uint32(o))
+		}
+		offset += def.OperandWidths[i]
+	}
+
+	return instruction
+}
+
+// ReadOperands decodes the operands of an instruction, and how many bytes they take
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 1:
+			operands[i] = int(ins[offset])
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 4:
+			operands[i] = int(ReadUint32(ins[offset:]))
+		}
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 { return binary.BigEndian.Uint16(ins) }
+func ReadUint32(ins Instructions) uint32 { return binary.BigEndian.Uint32(ins) }
+
+// String disassembles the instructions, one per line prefixed by its offset
+func (ins Instructions) String() string {
+	var sb strings.Builder
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&sb, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&sb, "%04d %s\n", i, fmtInstruction(def, operands))
+		i += 1 + read
+	}
+
+	return sb.String()
+}
+
+func fmtInstruction(def *Definition, operands []int) string {
+	if len(operands) != len(def.OperandWidths) {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), len(def.OperandWidths))
+	}
+
+	parts := []string{def.Name}
+	for _, o := range operands {
+		parts = append(parts, fmt.Sprint(o))
+	}
+	return strings.Join(parts, " ")
+}
+
+// SourceMap maps instructions back to where they came from in the source, sorted by offset
+type SourceMap []SourcePosition
+
+type SourcePosition struct {
+	Offset int // of the first instruction compiled from Pos
+	Pos    token.Position
+}
+
+// Lookup returns the position of the instruction at offset
+func (sm SourceMap) Lookup(offset int) token.Position {
+	i := sort.Search(len(sm), func(i int) bool { return sm[i].Offset > offset })
+	if i == 0 {
+		return token.Position{}
+	}
+	return sm[i-1].Pos
+}
+
+// CallSite is where a call is made, for the frames of stack traces
+type CallSite struct {
+	Callee string         // the source of the called expression, names builtin frames
+	Pos    token.Position // of the called expression
+}
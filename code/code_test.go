@@ -0,0 +1,108 @@
+package code
+
+import (
+	"main/token"
+	"testing"
+)
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected []byte
+	}{
+		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
+		{OpAdd, []int{}, []byte{byte(OpAdd)}},
+		{OpJump, []int{65536}, []byte{byte(OpJump), 0, 1, 0, 0}},
+		{OpGetOuter, []int{2, 258, 1}, []byte{byte(OpGetOuter), 2, 1, 2, 0, 1}},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+		if string(instruction) != string(tt.expected) {
+			t.Errorf("error - expected: %v - actual: %v", tt.expected, instruction)
+		}
+	}
+}
+
+func TestReadOperands(t *testing.T) {
+	tests := []struct {
+		op        Opcode
+		operands  []int
+		bytesRead int
+	}{
+		{OpConstant, []int{65535}, 2},
+		{OpCall, []int{3, 700}, 3},
+		{OpSetupTry, []int{70000, 12}, 8},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+		def, err := Lookup(byte(tt.op))
+		if err != nil {
+			t.Fatalf("definition not found: %s", err)
+		}
+
+		operands, n := ReadOperands(def, instruction[1:])
+		if n != tt.bytesRead {
+			t.Fatalf("error - expected: %d bytes read - actual: %d", tt.bytesRead, n)
+		}
+		for i, want := range tt.operands {
+			if operands[i] != want {
+				t.Errorf("error - expected: operand %d - actual: %d", want, operands[i])
+			}
+		}
+	}
+}
+
+func TestInstructionsString(t *testing.T) {
+	instructions := []Instructions{
+		Make(OpConstant, 1),
+		Make(OpGetLocal, 2),
+		Make(OpCall, 1, 0),
+		Make(OpReturnValue),
+	}
+
+	expected := `0000 OpConstant 1
+0003 OpGetLocal 2
+0006 OpCall 1 0
+0010 OpReturnValue
+`
+
+	concatted := Instructions{}
+	for _, ins := range instructions {
+		concatted = append(concatted, ins...)
+	}
+
+	if concatted.String() != expected {
+		t.Errorf("error - expected: %q - actual: %q", expected, concatted.String())
+	}
+}
+
+func TestSourceMapLookup(t *testing.T) {
+	sm := SourceMap{
+		{Offset: 0, Pos: token.Position{Line: 1, Column: 1}},
+		{Offset: 4, Pos: token.Position{Line: 2, Column: 5}},
+		{Offset: 9, Pos: token.Position{Line: 3, Column: 2}},
+	}
+
+	tests := []struct {
+		offset   int
+		expected token.Position
+	}{
+		{0, token.Position{Line: 1, Column: 1}},
+		{3, token.Position{Line: 1, Column: 1}},
+		{4, token.Position{Line: 2, Column: 5}},
+		{20, token.Position{Line: 3, Column: 2}},
+	}
+
+	for _, tt := range tests {
+		if got := sm.Lookup(tt.offset); got != tt.expected {
+			t.Errorf("error - expected: %v at offset %d - actual: %v", tt.expected, tt.offset, got)
+		}
+	}
+
+	if got := (SourceMap{}).Lookup(5); got != (token.Position{}) {
+		t.Errorf("error - expected no position in an empty source map - actual: %v", got)
+	}
+}
@@ -0,0 +1,367 @@
+package compiler
+
+import (
+	"fmt"
+	"main/ast"
+	"main/code"
+	"main/object"
+	"main/token"
+	"strconv"
+)
+
+var infixOperators = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"%":  code.OpMod,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	"<":  code.OpLess,
+	"<=": code.OpLessEqual,
+	">":  code.OpGreater,
+	">=": code.OpGreaterEqual,
+	"&&": code.OpAnd,
+	"||": code.OpOr,
+	"&":  code.OpBitAnd,
+	"|":  code.OpBitOr,
+}
+
+var prefixOperators = map[string]code.Opcode{
+	"-":  code.OpMinus,
+	"!":  code.OpBang,
+	"++": code.OpIncrement,
+	"--": code.OpDecrement,
+}
+
+func (c *Compiler) compileExpression(n ast.Expression) object.ErrorObj {
+	defer c.at(n.Pos())()
+
+	switch exp := n.(type) {
+	case ast.IntExpression:
+		value, err := strconv.ParseInt(exp.TokenLiteral(), 0, 64)
+		if err != nil {
+			c.raise("failed to parse integer: " + err.Error())
+			return object.EmptyErrorObj()
+		}
+		c.emit(code.OpConstant, c.addConstant(&object.IntegerObj{Value: value}))
+	case ast.FloatExpression:
+		value, err := strconv.ParseFloat(exp.TokenLiteral(), 64)
+		if err != nil {
+			c.raise("failed to parse float: " + err.Error())
+			return object.EmptyErrorObj()
+		}
+		c.emit(code.OpConstant, c.addConstant(&object.FloatObj{Value: value}))
+	case ast.BooleanExpression:
+		if exp.TokenLiteral() == "true" {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+	case ast.StringExpression:
+		c.emit(code.OpConstant, c.addConstant(&object.StringObj{Value: exp.TokenLiteral()}))
+	case ast.PrefixExpression:
+		return c.compilePrefix(exp)
+	case ast.PostfixExpression:
+		return c.compileUpdate(exp.Expression, code.UpdatePostfix, exp.TokenLiteral(), nil)
+	case ast.AssignExpression:
+		return c.compileAssign(exp)
+	case ast.InfixExpression:
+		return c.compileInfix(exp)
+	case ast.IfExpression:
+		return c.compileIf(exp)
+	case ast.IdentifierExpression:
+		c.load(c.symbol(exp))
+	case ast.FunctionExpression:
+		return c.compileFunction(exp, "")
+	case ast.CallExpression:
+		return c.compileCall(exp, code.OpCall)
+	case ast.ArrayExpression:
+		for _, elem := range exp.Elems {
+			if err := c.compileExpression(elem); !err.Ok() {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(exp.Elems))
+	case ast.IndexExpression:
+		if err := c.compileExpression(exp.Exp); !err.Ok() {
+			return err
+		}
+		if err := c.compileExpression(exp.Index); !err.Ok() {
+			return err
+		}
+		c.emit(code.OpIndex)
+	case ast.HashExpression:
+		for _, kvp := range exp.Elems {
+			if err := c.compileExpression(kvp.Key); !err.Ok() {
+				return err
+			}
+			if err := c.compileExpression(kvp.Value); !err.Ok() {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(exp.Elems))
+	default:
+		return object.NewErrorObj(fmt.Sprintf("unknown expression type: %T", exp))
+	}
+	return object.EmptyErrorObj()
+}
+
+func (c *Compiler) compilePrefix(node ast.PrefixExpression) object.ErrorObj {
+	// ++x and --x on a variable or element store the result, and evaluate to the new value
+	if isStep(node.Token.Type) && isAssignable(node.Expression) {
+		return c.compileUpdate(node.Expression, code.UpdatePrefix, node.TokenLiteral(), nil)
+	}
+
+	if err := c.compileExpression(node.Expression); !err.Ok() {
+		return err
+	}
+	op, ok := prefixOperators[node.TokenLiteral()]
+	if !ok {
+		c.raise("unknown prefix operator: " + node.TokenLiteral())
+		return object.EmptyErrorObj()
+	}
+	c.emit(op)
+	return object.EmptyErrorObj()
+}
+
+func (c *Compiler) compileInfix(node ast.InfixExpression) object.ErrorObj {
+	if err := c.compileExpression(node.Left); !err.Ok() {
+		return err
+	}
+	if err := c.compileExpression(node.Right); !err.Ok() {
+		return err
+	}
+
+	op, ok := infixOperators[node.TokenLiteral()]
+	if !ok {
+		c.raise("unknown infix operator: " + node.TokenLiteral())
+		return object.EmptyErrorObj()
+	}
+	c.emit(op)
+	return object.EmptyErrorObj()
+}
+
+func (c *Compiler) compileAssign(node ast.AssignExpression) object.ErrorObj {
+	switch node.Token.Type {
+	case token.PLUS_EQUAL:
+		return c.compileUpdate(node.Target, code.UpdateCompound, "+", node.Value)
+	case token.MINUS_EQUAL:
+		return c.compileUpdate(node.Target, code.UpdateCompound, "-", node.Value)
+	default:
+		return c.compileUpdate(node.Target, code.UpdateAssign, "", node.Value)
+	}
+}
+
+// compileUpdate compiles a write to a variable or a container element, see the code.Update
+// constants for the kinds of writes. The expression evaluates to the stored value,
+// except for postfix updates which evaluate to the value before
+func (c *Compiler) compileUpdate(target ast.Expression, kind int, operator string, value ast.Expression) object.ErrorObj {
+	switch t := target.(type) {
+	case ast.IdentifierExpression:
+		return c.compileVariableUpdate(t, kind, operator, value)
+	case ast.IndexExpression:
+		if err := c.compileExpression(t.Exp); !err.Ok() {
+			return err
+		}
+		if err := c.compileExpression(t.Index); !err.Ok() {
+			return err
+		}
+		if value != nil {
+			if err := c.compileExpression(value); !err.Ok() {
+				return err
+			}
+		}
+		c.emit(code.OpUpdateIndex, kind, int(operatorByte(operator)))
+	default:
+		c.raise("invalid assignment target: " + target.String())
+	}
+	return object.EmptyErrorObj()
+}
+
+func (c *Compiler) compileVariableUpdate(ident ast.IdentifierExpression, kind int, operator string, value ast.Expression) object.ErrorObj {
+	name := ident.TokenLiteral()
+	sym := c.symbol(ident)
+	if sym.global() {
+		c.emit(code.OpAssignableGlobal, sym.slot)
+	} else if sym.missing {
+		c.raise("cannot assign to undeclared variable: " + name)
+		return object.EmptyErrorObj()
+	} else if sym.isConst {
+		c.raise("cannot assign to constant: " + name)
+		return object.EmptyErrorObj()
+	}
+
+	if kind != code.UpdateAssign {
+		c.load(sym)
+	}
+	if kind == code.UpdatePostfix {
+		c.emit(code.OpDup)
+	}
+
+	switch kind {
+	case code.UpdateAssign, code.UpdateCompound:
+		if err := c.compileExpression(value); !err.Ok() {
+			return err
+		}
+		if kind == code.UpdateCompound {
+			c.emit(infixOperators[operator])
+		}
+	default:
+		step := 0
+		if operator == "++" {
+			step = 1
+		}
+		c.emit(code.OpStep, step)
+	}
+
+	if sym.builtin {
+		c.raise("cannot assign to builtin: " + name)
+		return object.EmptyErrorObj()
+	}
+	c.store(sym)
+
+	if kind == code.UpdatePostfix {
+		c.emit(code.OpPop)
+	}
+	return object.EmptyErrorObj()
+}
+
+// operatorByte encodes the operator of an update as an operand
+func operatorByte(operator string) byte {
+	if operator == "" {
+		return 0
+	}
+	return operator[0]
+}
+
+func isStep(t token.TokenType) bool {
+	return t == token.INCREMENT || t == token.DECREMENT
+}
+
+func isAssignable(exp ast.Expression) bool {
+	switch exp.(type) {
+	case ast.IdentifierExpression, ast.IndexExpression:
+		return true
+	}
+	return false
+}
+
+// load pushes the value of a variable
+func (c *Compiler) load(sym *symbol) {
+	switch {
+	case sym.missing:
+		c.raise("unknown identifier: " + sym.name)
+	case sym.builtin:
+		c.emit(code.OpGetBuiltin, sym.slot)
+	case sym.global():
+		c.emit(code.OpGetGlobal, sym.slot)
+	case c.hops(sym) == 0:
+		c.emit(code.OpGetLocal, sym.slot)
+	default:
+		c.emit(code.OpGetOuter, c.hops(sym), sym.slot, c.addConstant(&object.StringObj{Value: sym.name}))
+	}
+}
+
+// store assigns the value on the stack to a variable, and leaves it there
+func (c *Compiler) store(sym *symbol) {
+	switch {
+	case sym.global():
+		c.emit(code.OpSetGlobal, sym.slot)
+	case c.hops(sym) == 0:
+		c.emit(code.OpSetLocal, sym.slot)
+	default:
+		c.emit(code.OpSetOuter, c.hops(sym), sym.slot, c.addConstant(&object.StringObj{Value: sym.name}))
+	}
+}
+
+func (c *Compiler) compileIf(node ast.IfExpression) object.ErrorObj {
+	done := []int{}
+
+	// looping over the conditions, the block of the first one that is true runs
+	for i, condition := range node.Conditions {
+		if err := c.compileExpression(condition); !err.Ok() {
+			return err
+		}
+		skip := c.emit(code.OpJumpNotTrue, 0)
+
+		if err := c.compileBlock(node.Blocks[i]); !err.Ok() {
+			return err
+		}
+		done = append(done, c.emit(code.OpJump, 0))
+		c.changeOperands(skip, c.here())
+	}
+
+	// the else block
+	if len(node.Blocks) > len(node.Conditions) {
+		if err := c.compileBlock(node.Blocks[len(node.Blocks)-1]); !err.Ok() {
+			return err
+		}
+	} else {
+		c.emit(code.OpNull)
+	}
+
+	for _, jump := range done {
+		c.changeOperands(jump, c.here())
+	}
+	return object.EmptyErrorObj()
+}
+
+// compileFunction compiles a function literal to a constant, and emits the creation of a closure of it
+func (c *Compiler) compileFunction(node ast.FunctionExpression, name string) object.ErrorObj {
+	c.fn = &compilation{function: true, outer: c.fn}
+	c.enterFunction(node.Body)
+
+	// every argument gets a slot, even when a duplicate makes the call fail
+	params := []string{}
+	duplicate := ""
+	for _, arg := range node.Args {
+		param := arg.TokenLiteral()
+		if c.scope.declared[arg.Binding.Slot] && duplicate == "" {
+			duplicate = param
+		}
+		params = append(params, param)
+		c.declare(arg)
+	}
+
+	if duplicate != "" {
+		c.raiseAtCall("duplicate parameter: " + duplicate)
+	}
+	err := c.compileStatements(node.Body.Statements)
+	c.emit(code.OpReturnValue)
+
+	fn := &object.CompiledFunctionObj{
+		Name:         name,
+		Parameters:   params,
+		NumLocals:    c.scope.size,
+		Instructions: c.fn.instructions,
+		SourceMap:    c.fn.sourceMap,
+		CallSites:    c.fn.callSites,
+	}
+	c.scope = c.scope.outer
+	c.fn = c.fn.outer
+	if !err.Ok() {
+		return err
+	}
+
+	c.emit(code.OpClosure, c.addConstant(fn))
+	return object.EmptyErrorObj()
+}
+
+// compileCall compiles a call, op is OpTailCall for a call that is returned
+func (c *Compiler) compileCall(node ast.CallExpression, op code.Opcode) object.ErrorObj {
+	defer c.at(node.Pos())()
+
+	if err := c.compileExpression(node.Function); !err.Ok() {
+		return err
+	}
+	for _, arg := range node.Args {
+		if err := c.compileExpression(arg); !err.Ok() {
+			return err
+		}
+	}
+
+	c.fn.callSites = append(c.fn.callSites, code.CallSite{Callee: node.Function.String(), Pos: node.Function.Pos()})
+	c.emit(op, len(node.Args), len(c.fn.callSites)-1)
+	return object.EmptyErrorObj()
+}
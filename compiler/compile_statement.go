@@ -0,0 +1,263 @@
+package compiler
+
+import (
+	"fmt"
+	"main/ast"
+	"main/code"
+	"main/object"
+)
+
+// compileStatements compiles a block, which leaves the value of its last statement on the stack
+func (c *Compiler) compileStatements(statements []ast.Statement) object.ErrorObj {
+	if len(statements) == 0 {
+		c.emit(code.OpNull)
+		return object.EmptyErrorObj()
+	}
+
+	for i, statement := range statements {
+		pushed, err := c.compileStatement(statement)
+		if !err.Ok() {
+			return err
+		}
+
+		last := i == len(statements)-1
+		if pushed && !last {
+			c.emit(code.OpPop)
+		} else if !pushed && last {
+			c.emit(code.OpNull)
+		}
+	}
+	return object.EmptyErrorObj()
+}
+
+// compileStatement compiles a statement, and reports whether its value is left on the stack.
+// Statements that evaluate to null leave nothing, unless they end a block
+func (c *Compiler) compileStatement(s ast.Statement) (bool, object.ErrorObj) {
+	defer c.at(s.Pos())()
+
+	switch stmt := s.(type) {
+	case ast.BlockStatement:
+		return true, c.compileStatements(stmt.Statements)
+	case ast.ExpressionStatement:
+		return true, c.compileExpression(stmt.Expression)
+	case ast.LetStatement:
+		return false, c.compileLetStatement(stmt)
+	case ast.ReturnStatement:
+		return false, c.compileReturnStatement(stmt)
+	case ast.ForStatement:
+		return false, c.compileForStatement(stmt)
+	case ast.ForInStatement:
+		return false, c.compileForInStatement(stmt)
+	case ast.TryStatement:
+		return true, c.compileTryStatement(stmt)
+	case ast.BreakStatement:
+		c.emit(code.OpBreak)
+		return false, object.EmptyErrorObj()
+	case ast.ContinueStatement:
+		c.emit(code.OpContinue)
+		return false, object.EmptyErrorObj()
+	default:
+		return false, object.NewErrorObj(fmt.Sprintf("unknown statement type: %T", stmt))
+	}
+}
+
+func (c *Compiler) compileLetStatement(stmt ast.LetStatement) object.ErrorObj {
+	name := stmt.Identifier.TokenLiteral()
+
+	// top level variables are checked by the vm before and after their value is computed, they may come from an earlier program
+	if stmt.Identifier.Binding.Scope == ast.Global {
+		sym := c.symbol(stmt.Identifier)
+		c.emit(code.OpDeclarableGlobal, sym.slot)
+		if err := c.compileBoundExpression(stmt.Expression, name); !err.Ok() {
+			return err
+		}
+		if stmt.IsConst() {
+			c.emit(code.OpDefineConstGlobal, sym.slot)
+		} else {
+			c.emit(code.OpDefineGlobal, sym.slot)
+		}
+		return object.EmptyErrorObj()
+	}
+
+	if c.scope.declared[stmt.Identifier.Binding.Slot] {
+		c.raise(fmt.Sprintf("variable '%s' already exists in this scope", name))
+		return object.EmptyErrorObj()
+	}
+
+	if err := c.compileBoundExpression(stmt.Expression, name); !err.Ok() {
+		return err
+	}
+	c.initialize(c.declare(stmt.Identifier))
+	return object.EmptyErrorObj()
+}
+
+// compileBoundExpression compiles the value of a let statement, a function
+// is named after the variable unless it already has a name
+func (c *Compiler) compileBoundExpression(exp ast.Expression, name string) object.ErrorObj {
+	if fn, ok := exp.(ast.FunctionExpression); ok {
+		defer c.at(fn.Pos())()
+		return c.compileFunction(fn, name)
+	}
+
+	if err := c.compileExpression(exp); !err.Ok() {
+		return err
+	}
+
+	switch exp.(type) {
+	case ast.IdentifierExpression, ast.CallExpression, ast.IndexExpression, ast.IfExpression, ast.AssignExpression:
+		c.emit(code.OpNameFunction, c.addConstant(&object.StringObj{Value: name}))
+	}
+	return object.EmptyErrorObj()
+}
+
+func (c *Compiler) compileReturnStatement(stmt ast.ReturnStatement) object.ErrorObj {
+	if stmt.Expression == nil {
+		c.emit(code.OpNull)
+		c.emit(code.OpReturnValue)
+		return object.EmptyErrorObj()
+	}
+
+	// nothing is left to do in the function once a returned call is made, so
+	// it replaces the returning call. Not in try or catch, or its errors would escape them
+	if call, ok := stmt.Expression.(ast.CallExpression); ok && c.fn.function && c.fn.tries == 0 {
+		return c.compileCall(call, code.OpTailCall)
+	}
+
+	if err := c.compileExpression(stmt.Expression); !err.Ok() {
+		return err
+	}
+	c.emit(code.OpReturnValue)
+	return object.EmptyErrorObj()
+}
+
+func (c *Compiler) compileForStatement(stmt ast.ForStatement) object.ErrorObj {
+	setup := c.emit(code.OpSetupLoop, 0, 0)
+
+	next := c.here()
+	if err := c.compileExpression(stmt.Condition); !err.Ok() {
+		return err
+	}
+	exit := c.emit(code.OpJumpNotTrue, 0)
+
+	if err := c.compileLoopBody(stmt.Body); !err.Ok() {
+		return err
+	}
+	c.emit(code.OpJump, next)
+
+	c.changeOperands(exit, c.here())
+	c.emit(code.OpPopBlock)
+	c.changeOperands(setup, c.here(), next)
+	return object.EmptyErrorObj()
+}
+
+func (c *Compiler) compileForInStatement(stmt ast.ForInStatement) object.ErrorObj {
+	if err := c.compileExpression(stmt.Iterable); !err.Ok() {
+		return err
+	}
+	c.emit(code.OpIter)
+	setup := c.emit(code.OpSetupLoop, 0, 0)
+
+	// the loop variable lives in the scope of each iteration, along with the variables of the body
+	next := c.here()
+	exit := c.emit(code.OpIterNext, 0)
+	if err := c.compileLoopBody(stmt.Body, stmt.Identifier); !err.Ok() {
+		return err
+	}
+	c.emit(code.OpJump, next)
+
+	c.changeOperands(exit, c.here())
+	c.emit(code.OpPopBlock)
+	c.changeOperands(setup, c.here(), next)
+	c.emit(code.OpPop) // the iterator
+	return object.EmptyErrorObj()
+}
+
+// compileLoopBody compiles an iteration of a loop, idents are the variables that
+// the iteration declares and takes from the stack, in order
+func (c *Compiler) compileLoopBody(body ast.BlockStatement, idents ...ast.IdentifierExpression) object.ErrorObj {
+	c.emit(code.OpIteration)
+	c.enterBlock(body)
+	for _, ident := range idents {
+		c.initialize(c.declare(ident))
+	}
+	if err := c.compileStatements(body.Statements); !err.Ok() {
+		return err
+	}
+	c.emit(code.OpPop)
+	c.leaveBlock()
+	return object.EmptyErrorObj()
+}
+
+// compileTryStatement compiles try, catch and finally. The finally block gets a completion
+// under its own value, which tells it how to carry on: with the value of try or catch,
+// or with the error, return, break or continue that interrupted them
+func (c *Compiler) compileTryStatement(stmt ast.TryStatement) object.ErrorObj {
+	setup := c.emit(code.OpSetupTry, 0, 0)
+
+	c.fn.tries++
+	err := c.compileBlock(stmt.Body)
+	c.fn.tries--
+	if !err.Ok() {
+		return err
+	}
+	c.emit(code.OpPopBlock)
+	done := []int{c.emit(code.OpJump, 0)}
+
+	catch := 0
+	if stmt.Catch != nil {
+		catch = c.here()
+
+		c.fn.tries++
+		c.enterBlock(*stmt.Catch)
+		c.initialize(c.declare(*stmt.CatchParam))
+		err := c.compileStatements(stmt.Catch.Statements)
+		c.leaveBlock()
+		c.fn.tries--
+		if !err.Ok() {
+			return err
+		}
+
+		// the vm leaves the finally block in place of the try block while catching
+		if stmt.Finally != nil {
+			c.emit(code.OpPopBlock)
+		}
+		done = append(done, c.emit(code.OpJump, 0))
+	}
+
+	finally := 0
+	if stmt.Finally != nil {
+		for _, jump := range done {
+			c.changeOperands(jump, c.here())
+		}
+		c.emit(code.OpCompletion)
+
+		finally = c.here()
+		if err := c.compileBlock(*stmt.Finally); !err.Ok() {
+			return err
+		}
+		c.emit(code.OpPop)
+		c.emit(code.OpEndFinally)
+	} else {
+		for _, jump := range done {
+			c.changeOperands(jump, c.here())
+		}
+	}
+
+	c.changeOperands(setup, catch, finally)
+	return object.EmptyErrorObj()
+}
+
+// compileBlock compiles a block with a scope of its own, leaving its value on the stack
+func (c *Compiler) compileBlock(block ast.BlockStatement) object.ErrorObj {
+	defer c.at(block.Pos())()
+
+	c.enterBlock(block)
+	err := c.compileStatements(block.Statements)
+	c.leaveBlock()
+	return err
+}
+
+// initialize stores the value on the stack in a variable of the current scope
+func (c *Compiler) initialize(sym *symbol) {
+	c.emit(code.OpInitLocal, sym.slot)
+}
@@ -0,0 +1,191 @@
+package compiler
+
+import (
+	"fmt"
+	"main/ast"
+	"main/code"
+	"main/evaluator"
+	"main/object"
+	"main/resolver"
+	"main/token"
+)
+
+// Bytecode is a compiled program, ready to be run by the vm
+type Bytecode struct {
+	Main        *object.CompiledFunctionObj // the top level of the program
+	Constants   []object.Object
+	GlobalNames []string // the variable of each global slot, for error messages
+	Builtins    []string // the builtins OpGetBuiltin refers to, by index
+}
+
+// Compiler turns programs into bytecode. It remembers the globals, constants and builtins of
+// everything it compiled, so the programs of a REPL session can use what earlier ones declared
+type Compiler struct {
+	constants     []object.Object
+	constantIndex map[constantKey]int // literals already in the pool
+	resolver      *resolver.Resolver  // binds every name to its global, builtin or slot of a scope
+
+	global *scope          // the top level of the program being compiled
+	scope  *scope          // the scope being compiled
+	fn     *compilation    // the function being compiled
+	pos    token.Position  // of the node being compiled, errors raised by its instructions point there
+	err    object.ErrorObj // the first instruction whose operands do not fit
+}
+
+// compilation is a function being compiled
+type compilation struct {
+	instructions code.Instructions
+	sourceMap    code.SourceMap
+	callSites    []code.CallSite
+	tries        int  // try and catch blocks around the code, calls returned from them are not tail calls
+	function     bool // false for the top level
+	outer        *compilation
+}
+
+// New returns a compiler for programs that can call builtins, nil for none.
+// The vm running the bytecode has to be given the same builtins
+func New(builtins *evaluator.Builtins) *Compiler {
+	if builtins == nil {
+		builtins = evaluator.NewBuiltins()
+	}
+	c := &Compiler{
+		constantIndex: map[constantKey]int{},
+		resolver:      resolver.New(builtins.Has),
+	}
+	return c
+}
+
+// Compile compiles a program, it may use the globals of the programs compiled before it
+func (c *Compiler) Compile(program ast.Program) (bytecode *Bytecode, compileErr object.ErrorObj) {
+	defer func() {
+		if r := recover(); r != nil {
+			bytecode, compileErr = nil, object.NewErrorObj(fmt.Sprintf("internal error: %v", r))
+			compileErr.Kind = object.INTERNAL_ERROR
+		}
+	}()
+
+	program, err := c.resolver.Resolve(program)
+	if !err.Ok() {
+		return nil, err
+	}
+
+	c.fn = &compilation{}
+	c.global = &scope{declared: map[int]bool{}}
+	c.global.record = c.global
+	c.scope = c.global
+	c.pos = token.Position{}
+	c.err = object.EmptyErrorObj()
+
+	if err := c.compileStatements(program.Statements); !err.Ok() {
+		return nil, err
+	}
+	c.emit(code.OpReturnValue)
+	if !c.err.Ok() {
+		return nil, c.err
+	}
+
+	return &Bytecode{
+		Main: &object.CompiledFunctionObj{
+			NumLocals:    c.global.size,
+			Instructions: c.fn.instructions,
+			SourceMap:    c.fn.sourceMap,
+			CallSites:    c.fn.callSites,
+		},
+		Constants:   c.constants,
+		GlobalNames: c.resolver.Globals(),
+		Builtins:    c.resolver.Builtins(),
+	}, object.EmptyErrorObj()
+}
+
+// DeclareGlobal declares a top level variable from outside of any program, like a value
+// the program embedding the interpreter sets. Returns its slot
+func (c *Compiler) DeclareGlobal(name string) int {
+	return c.resolver.DeclareGlobal(name)
+}
+
+// Global returns the slot of a top level variable, false if no program declared it
+func (c *Compiler) Global(name string) (int, bool) {
+	return c.resolver.Global(name)
+}
+
+// at makes the instructions emitted next point to pos, the returned function goes back to the previous position
+func (c *Compiler) at(pos token.Position) func() {
+	prev := c.pos
+	c.pos = pos
+	return func() { c.pos = prev }
+}
+
+// emit appends an instruction to the function being compiled and returns its offset
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	offset := len(c.fn.instructions)
+	if n := len(c.fn.sourceMap); n == 0 || c.fn.sourceMap[n-1].Pos != c.pos {
+		c.fn.sourceMap = append(c.fn.sourceMap, code.SourcePosition{Offset: offset, Pos: c.pos})
+	}
+	c.checkOperands(op, operands)
+	c.fn.instructions = append(c.fn.instructions, code.Make(op, operands...)...)
+	return offset
+}
+
+// changeOperands rewrites the operands of the instruction at offset, e.g. once a jump target is known
+func (c *Compiler) changeOperands(offset int, operands ...int) {
+	op := code.Opcode(c.fn.instructions[offset])
+	c.checkOperands(op, operands)
+	copy(c.fn.instructions[offset:], code.Make(op, operands...))
+}
+
+// checkOperands records an error for operands too wide for their instruction, like the argument
+// count of a call with too many arguments. The vm would run them truncated
+func (c *Compiler) checkOperands(op code.Opcode, operands []int) {
+	def, err := code.Lookup(byte(op))
+	if err != nil || !c.err.Ok() {
+		return
+	}
+	for i, operand := range operands {
+		if max := code.MaxOperand(def.OperandWidths[i]); operand > max {
+			c.err = object.NewErrorObj(fmt.Sprintf("program too large to compile: %s needs operand %d, at most %d", def.Name, operand, max)).At(c.pos)
+			return
+		}
+	}
+}
+
+// here is the offset of the next instruction, to jump to
+func (c *Compiler) here() int {
+	return len(c.fn.instructions)
+}
+
+// raise emits an error raised when the instruction runs, for mistakes the
+// evaluator only notices once it gets there
+func (c *Compiler) raise(message string) {
+	c.emit(code.OpRaise, c.addConstant(&object.StringObj{Value: message}))
+}
+
+// raiseAtCall is raise for errors that point to the call of the function they happen in
+func (c *Compiler) raiseAtCall(message string) {
+	defer c.at(token.Position{})()
+	c.raise(message)
+}
+
+// constantKey tells literals apart, Inspect shows every int, float and string exactly
+type constantKey struct {
+	Type  object.ObjectType
+	Value string
+}
+
+// addConstant adds an object to the constant pool and returns its index, equal literals share an entry
+func (c *Compiler) addConstant(obj object.Object) int {
+	var key constantKey
+	switch obj.(type) {
+	case *object.IntegerObj, *object.FloatObj, *object.StringObj:
+		key = constantKey{Type: obj.Type(), Value: obj.Inspect()}
+		if index, ok := c.constantIndex[key]; ok {
+			return index
+		}
+	}
+
+	c.constants = append(c.constants, obj)
+	index := len(c.constants) - 1
+	if key.Type != "" {
+		c.constantIndex[key] = index
+	}
+	return index
+}
@@ -0,0 +1,118 @@
+package compiler
+
+import (
+	"main/code"
+	"main/evaluator"
+	"main/lexer"
+	"main/object"
+	"main/parser"
+	"testing"
+)
+
+func compile(input string, t *testing.T) *Bytecode {
+	l := lexer.CreateLexer(input)
+	p := parser.CreateParser(l)
+	program, errs := p.ParseProgram()
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	bytecode, err := New(evaluator.Prelude()).Compile(program)
+	if !err.Ok() {
+		t.Fatalf("unexpected error: %s", err.Inspect())
+	}
+	return bytecode
+}
+
+// contains reports whether the instructions have an op, walking them instruction by instruction
+func contains(ins code.Instructions, op code.Opcode) bool {
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			return false
+		}
+		if code.Opcode(ins[i]) == op {
+			return true
+		}
+		_, read := code.ReadOperands(def, ins[i+1:])
+		i += 1 + read
+	}
+	return false
+}
+
+func TestBlockScopes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"for (x in [1, 2]) { let y = x * 2; }", false},
+		{"let i = 0; for (i < 3) { let y = i; i++; }", false},
+		{"if (true) { let y = 1; y }", false},
+		{"for (x in [1, 2]) { let f = fn() { x }; }", true},
+		{"if (true) { let y = 1; fn() { y } }", true},
+		{"try { let y = 1; fn() { y } } catch (e) { e }", true},
+		{"try { 1 } catch (e) { fn() { e } }", true},
+	}
+
+	for _, tt := range tests {
+		bytecode := compile(tt.input, t)
+		if got := contains(bytecode.Main.Instructions, code.OpPushScope); got != tt.expected {
+			t.Errorf("%q: error - expected a scope of its own: %t - actual: %t", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestFunctionLocals(t *testing.T) {
+	tests := []struct {
+		input     string
+		numLocals int
+	}{
+		{"fn() { 1 }", 0},
+		{"fn(a, b) { a + b }", 2},
+		{"fn(a) { let b = a; let c = b; c }", 3},
+		{"fn(xs) { for (x in xs) { let y = x; } }", 3},
+	}
+
+	for _, tt := range tests {
+		bytecode := compile(tt.input, t)
+
+		var fn *object.CompiledFunctionObj
+		for _, constant := range bytecode.Constants {
+			if f, ok := constant.(*object.CompiledFunctionObj); ok {
+				fn = f
+			}
+		}
+		if fn == nil {
+			t.Fatalf("%q: no compiled function in the constants", tt.input)
+		}
+		if fn.NumLocals != tt.numLocals {
+			t.Errorf("%q: error - expected: %d locals - actual: %d", tt.input, tt.numLocals, fn.NumLocals)
+		}
+	}
+}
+
+func TestMainLocals(t *testing.T) {
+	tests := []struct {
+		input     string
+		numLocals int
+	}{
+		{"let a = 1; a", 0},
+		{"if (true) { let a = 1; let b = a; b }", 2},
+		{"for (x in [1]) { let y = x; }; if (true) { let z = 1; z }", 3},
+		{"if (true) { let a = 1; fn() { a } }", 0},
+	}
+
+	for _, tt := range tests {
+		bytecode := compile(tt.input, t)
+		if bytecode.Main.NumLocals != tt.numLocals {
+			t.Errorf("%q: error - expected: %d locals - actual: %d", tt.input, tt.numLocals, bytecode.Main.NumLocals)
+		}
+	}
+}
+
+func TestConstantsAreShared(t *testing.T) {
+	bytecode := compile(`1 + 1; "a" + "a"; 2.5 * 2.5; 1`, t)
+	if len(bytecode.Constants) != 3 {
+		t.Errorf("error - expected: 3 constants - actual: %d", len(bytecode.Constants))
+	}
+}
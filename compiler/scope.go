@@ -0,0 +1,184 @@
+package compiler
+
+import (
+	"main/ast"
+	"main/code"
+)
+
+// scope is a scope of variables as the resolver has them: the top level, the body of a function call,
+// an iteration of a loop, an if, try, catch or finally block. The resolver numbers the variables of each one from 0.
+// At run time a scope only gets a record of its own when a function may close over its variables,
+// the variables of the others get slots in the record of the scope around them. The record of the top level
+// holds the variables of its blocks, its own variables are globals
+type scope struct {
+	outer    *scope
+	declared map[int]bool // variables declared so far, in the order of the source
+	function bool         // the scope of a function call
+	record   *scope       // the scope whose record holds the variables
+	base     int          // the slot of the first variable in the record
+	depth    int          // how many records are around this one's, for a scope with a record
+	size     int          // slots of the record, for a scope with a record
+	pushAt   int          // the OpPushScope that creates the record
+}
+
+// symbol is where a variable lives at run time
+type symbol struct {
+	name    string
+	slot    int
+	isConst bool
+	record  *scope // the scope with the record holding the slot, nil for globals and builtins
+	builtin bool   // slot indexes the builtins of the bytecode
+	missing bool   // used before its declaration, in the scope declaring it or one of its blocks
+}
+
+func (s *symbol) global() bool { return s.record == nil && !s.builtin }
+
+// symbol finds where the variable an identifier is bound to lives. A function body runs once
+// its surroundings have declared their variables, so only a variable of the same function
+// that is not declared yet is known to be missing
+func (c *Compiler) symbol(ident ast.IdentifierExpression) *symbol {
+	b := ident.Binding
+	sym := &symbol{name: ident.TokenLiteral(), slot: b.Slot, isConst: b.Const}
+	switch b.Scope {
+	case ast.Global:
+		return sym
+	case ast.Builtin:
+		sym.builtin = true
+		return sym
+	}
+
+	s, crossed := c.scope, false
+	for i := 0; i < b.Depth; i++ {
+		crossed = crossed || s.function
+		s = s.outer
+	}
+	sym.slot = s.base + b.Slot
+	sym.record = s.record
+	sym.missing = !crossed && !s.declared[b.Slot]
+	return sym
+}
+
+// declare makes a variable of the current scope visible to the code compiled after it
+func (c *Compiler) declare(ident ast.IdentifierExpression) *symbol {
+	c.scope.declared[ident.Binding.Slot] = true
+	return c.symbol(ident)
+}
+
+// hops is how many records out from the current one the record of a variable is
+func (c *Compiler) hops(sym *symbol) int {
+	return c.scope.record.depth - sym.record.depth
+}
+
+// enterFunction opens the scope of a function call, with a record of its own
+func (c *Compiler) enterFunction(body ast.BlockStatement) {
+	s := &scope{outer: c.scope, declared: map[int]bool{}, function: true, size: body.Slots}
+	s.record = s
+	s.depth = c.scope.record.depth + 1
+	c.scope = s
+}
+
+// enterBlock opens the scope of a block, its variables go in a record of its own when a function may close over them
+func (c *Compiler) enterBlock(block ast.BlockStatement) {
+	s := &scope{outer: c.scope, declared: map[int]bool{}, record: c.scope.record}
+	if block.Slots > 0 && containsFunction(block.Statements) {
+		s.record = s
+		s.depth = c.scope.record.depth + 1
+		s.size = block.Slots
+		s.pushAt = c.emit(code.OpPushScope, 0)
+	} else {
+		s.base = s.record.size
+		s.record.size += block.Slots
+	}
+	c.scope = s
+}
+
+// leaveBlock closes the scope opened by enterBlock
+func (c *Compiler) leaveBlock() {
+	if c.scope.record == c.scope {
+		c.changeOperands(c.scope.pushAt, c.scope.size)
+		c.emit(code.OpPopScope)
+	}
+	c.scope = c.scope.outer
+}
+
+// containsFunction reports whether a function literal appears anywhere in the statements
+func containsFunction(statements []ast.Statement) bool {
+	for _, statement := range statements {
+		if statementContainsFunction(statement) {
+			return true
+		}
+	}
+	return false
+}
+
+func statementContainsFunction(statement ast.Statement) bool {
+	switch stmt := statement.(type) {
+	case ast.BlockStatement:
+		return containsFunction(stmt.Statements)
+	case ast.ExpressionStatement:
+		return expressionContainsFunction(stmt.Expression)
+	case ast.LetStatement:
+		return expressionContainsFunction(stmt.Expression)
+	case ast.ReturnStatement:
+		return stmt.Expression != nil && expressionContainsFunction(stmt.Expression)
+	case ast.ForStatement:
+		return expressionContainsFunction(stmt.Condition) || containsFunction(stmt.Body.Statements)
+	case ast.ForInStatement:
+		return expressionContainsFunction(stmt.Iterable) || containsFunction(stmt.Body.Statements)
+	case ast.TryStatement:
+		return containsFunction(stmt.Body.Statements) ||
+			(stmt.Catch != nil && containsFunction(stmt.Catch.Statements)) ||
+			(stmt.Finally != nil && containsFunction(stmt.Finally.Statements))
+	}
+	return false
+}
+
+func expressionContainsFunction(expression ast.Expression) bool {
+	switch exp := expression.(type) {
+	case ast.FunctionExpression:
+		return true
+	case ast.PrefixExpression:
+		return expressionContainsFunction(exp.Expression)
+	case ast.PostfixExpression:
+		return expressionContainsFunction(exp.Expression)
+	case ast.AssignExpression:
+		return expressionContainsFunction(exp.Target) || expressionContainsFunction(exp.Value)
+	case ast.InfixExpression:
+		return expressionContainsFunction(exp.Left) || expressionContainsFunction(exp.Right)
+	case ast.IfExpression:
+		for _, condition := range exp.Conditions {
+			if expressionContainsFunction(condition) {
+				return true
+			}
+		}
+		for _, block := range exp.Blocks {
+			if containsFunction(block.Statements) {
+				return true
+			}
+		}
+	case ast.CallExpression:
+		if expressionContainsFunction(exp.Function) {
+			return true
+		}
+		for _, arg := range exp.Args {
+			if expressionContainsFunction(arg) {
+				return true
+			}
+		}
+	case ast.ArrayExpression:
+		for _, elem := range exp.Elems {
+			if expressionContainsFunction(elem) {
+				return true
+			}
+		}
+	case ast.IndexExpression:
+		return expressionContainsFunction(exp.Exp) || expressionContainsFunction(exp.Index)
+	case ast.HashExpression:
+		for _, pair := range exp.Elems {
+			if expressionContainsFunction(pair.Key) || expressionContainsFunction(pair.Value) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package diagnostics
+
+import (
+	"fmt"
+	"io"
+	"main/object"
+	"main/parser"
+	"main/token"
+	"strings"
+)
+
+// Format renders a message as file:line:column: message, followed
+// by the offending source line with a caret under the column
+func Format(source string, pos token.Position, message string) string {
+	if !pos.IsValid() {
+		return message + "\n"
+	}
+
+	var sb strings.Builder
+	sb.WriteString(pos.String() + ": " + message + "\n")
+
+	lines := strings.Split(source, "\n")
+	if pos.Line > len(lines) {
+		return sb.String()
+	}
+
+	// keeping tabs so the caret lines up with the source however tabs are displayed
+	line := strings.TrimRight(lines[pos.Line-1], "\r")
+	sb.WriteString(line + "\n")
+	chars := []rune(line) // columns count characters, not bytes
+	for i := 0; i < pos.Column-1; i++ {
+		if i < len(chars) && chars[i] == '\t' {
+			sb.WriteByte('\t')
+		} else {
+			sb.WriteByte(' ')
+		}
+	}
+	sb.WriteString("^\n")
+
+	return sb.String()
+}
+
+// ParserError renders an error of the parser, pointing into the source it parsed
+func ParserError(source string, err error) string {
+	if parserErr, ok := err.(parser.Error); ok {
+		return Format(source, parserErr.Pos, parserErr.Message)
+	}
+	return err.Error() + "\n"
+}
+
+// WriteParserErrors writes every error of the parser to out
+func WriteParserErrors(out io.Writer, source string, errors []error) {
+	for _, e := range errors {
+		io.WriteString(out, ParserError(source, e))
+	}
+}
+
+// Sources are the texts positions point into, by file name. Every input of
+// a REPL session has a name of its own, its functions may fail in a later one
+type Sources map[string]string
+
+// Verbose switches runtime errors from tracebacks to the full chain of
+// what was being evaluated when they happened
+var Verbose bool
+
+// RuntimeError renders an error a program raised and did not catch
+func RuntimeError(texts Sources, err object.ErrorObj) string {
+	if Verbose {
+		return formatErrorChain(texts, err)
+	}
+	return formatTraceback(texts, err)
+}
+
+// formatErrorChain points at the raised error, followed by the chain of
+// what was being evaluated when it happened
+func formatErrorChain(texts Sources, err object.ErrorObj) string {
+	pos := err.Location()
+	output := Format(texts[pos.File], pos, err.Raised().Message)
+	if len(err.SubErrors) != 0 {
+		output += strings.TrimRight(err.Inspect(), "\n") + "\n"
+	}
+	return output
+}
+
+// maxRepeatedFrames is how many times the same frame is shown in a row in a traceback
+const maxRepeatedFrames = 3
+
+func writeRepeatedFrames(sb *strings.Builder, repeated int) {
+	if repeated >= maxRepeatedFrames {
+		fmt.Fprintf(sb, "  [Previous frame repeated %d more times]\n", repeated-maxRepeatedFrames+1)
+	}
+}
+
+// formatTraceback lists the calls the error was raised in, most recent call last,
+// an error raised with a cause is preceded by the traceback of the cause
+func formatTraceback(texts Sources, err object.ErrorObj) string {
+	var sb strings.Builder
+	raised := err.Raised()
+	if raised.Kind == object.USER_ERROR && len(raised.SubErrors) != 0 {
+		sb.WriteString(formatTraceback(texts, raised.SubErrors[0]))
+		sb.WriteString("\nThe above error was the direct cause of the following error:\n\n")
+	}
+
+	// every frame is shown where the next call was made from, the innermost one where the error happened
+	stack := err.CallStack()
+	names := []string{"<module>"}
+	locations := []token.Position{}
+	for _, frame := range stack {
+		names = append(names, frame.Function)
+		locations = append(locations, frame.CallSite)
+	}
+	locations = append(locations, err.Location())
+
+	sb.WriteString("Traceback (most recent call last):\n")
+	repeated := 0
+	for i, pos := range locations {
+		if !pos.IsValid() {
+			continue
+		}
+
+		// deep recursion would bury the error under thousands of identical frames
+		if i > 0 && pos == locations[i-1] && names[i] == names[i-1] {
+			repeated++
+			if repeated >= maxRepeatedFrames {
+				continue
+			}
+		} else {
+			writeRepeatedFrames(&sb, repeated)
+			repeated = 0
+		}
+
+		file := pos.File
+		if file == "" {
+			file = "<stdin>"
+		}
+		fmt.Fprintf(&sb, "  File \"%s\", line %d, column %d, in %s\n", file, pos.Line, pos.Column, names[i])
+		if lines := strings.Split(texts[pos.File], "\n"); pos.Line <= len(lines) {
+			sb.WriteString("    " + strings.TrimSpace(lines[pos.Line-1]) + "\n")
+		}
+	}
+	writeRepeatedFrames(&sb, repeated)
+
+	kind := raised.Kind
+	if kind == "" {
+		kind = object.RUNTIME_ERROR
+	}
+	sb.WriteString(kind + ": " + raised.Message + "\n")
+	return sb.String()
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"io"
+	"main/ast"
+	"main/evaluator"
+	"main/hydrogen"
+	"main/object"
+)
+
+var engine string
+
+// runner runs the programs of a file or a REPL session one after the other, later
+// programs see the variables of earlier ones
+type runner func(program ast.Program) (object.Object, object.ErrorObj)
+
+// newRunner returns a runner for the engine selected with -engine, scripts read from in and write to out and errOut
+func newRunner(in io.Reader, out io.Writer, errOut io.Writer) (runner, error) {
+	// -max-depth=0 removes the limit, hydrogen takes a negative depth for that
+	depth := maxCallDepth
+	if depth == 0 {
+		depth = -1
+	}
+
+	interpreter, err := hydrogen.New(hydrogen.Options{
+		Engine:       engine,
+		MaxCallDepth: depth,
+		Builtins:     evaluator.Prelude(),
+		Limits:       limits,
+		In:           in,
+		Out:          out,
+		Err:          errOut,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return interpreter.Run, nil
+}
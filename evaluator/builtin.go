@@ -2,8 +2,13 @@ package evaluator
 
 import (
 	"fmt"
+	"io"
 	"main/object"
-	"os"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 )
 
 type BuiltinFunction func(env Environment, args ...object.Object) (object.Object, object.ErrorObj)
@@ -15,19 +20,90 @@ type Builtin struct {
 func (b *Builtin) Type() object.ObjectType { return object.BUILTIN_OBJ }
 func (b *Builtin) Inspect() string         { return "builtin function" }
 
-var builtins map[string]*Builtin
+// Arity is -1 for builtins, they take any number of arguments and check them themselves
+func (b *Builtin) Arity() int { return -1 }
 
-func InitBuiltins() {
-	builtins = map[string]*Builtin{
-		"len":    {Fn: builtin_len},
-		"push":   {Fn: builtin_push},
-		"print":  {Fn: builtin_print},
-		"exit":   {Fn: builtin_exit},
-		"rest":   {Fn: builtin_rest},
-		"filter": {Fn: builtin_filter},
-		"map":    {Fn: builtin_map},
-		"reduce": {Fn: builtin_reduce},
+// Builtins are the builtin functions scripts can call by name. Every interpreter has a set of
+// its own, programs see the changes made to it before they run
+type Builtins struct {
+	fns map[string]*Builtin
+}
+
+// NewBuiltins returns an empty set of builtins
+func NewBuiltins() *Builtins {
+	return &Builtins{fns: map[string]*Builtin{}}
+}
+
+// Prelude returns the builtins of the language, in a set of its own that can be changed freely
+func Prelude() *Builtins {
+	return &Builtins{fns: map[string]*Builtin{
+		"len":       {Fn: builtin_len},
+		"push":      {Fn: builtin_push},
+		"print":     {Fn: builtin_print},
+		"input":     {Fn: builtin_input},
+		"read_line": {Fn: builtin_read_line},
+		"exit":      {Fn: builtin_exit},
+		"rest":      {Fn: builtin_rest},
+		"filter":    {Fn: builtin_filter},
+		"map":       {Fn: builtin_map},
+		"reduce":    {Fn: builtin_reduce},
+		"floor":     {Fn: builtin_floor},
+		"ceil":      {Fn: builtin_ceil},
+		"round":     {Fn: builtin_round},
+		"float":     {Fn: builtin_float},
+		"int":       {Fn: builtin_int},
+		"bytes":     {Fn: builtin_bytes},
+		"error":     {Fn: builtin_error},
+	}}
+}
+
+// Lookup returns the builtin with that name, if there is one
+func (b *Builtins) Lookup(name string) (*Builtin, bool) {
+	builtin, ok := b.fns[name]
+	return builtin, ok
+}
+
+// Has reports whether there is a builtin with that name
+func (b *Builtins) Has(name string) bool {
+	_, ok := b.fns[name]
+	return ok
+}
+
+// Names returns the names of the builtins in alphabetical order
+func (b *Builtins) Names() []string {
+	names := make([]string, 0, len(b.fns))
+	for name := range b.fns {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	return names
+}
+
+// Add adds a builtin, it fails if there already is one with that name
+func (b *Builtins) Add(name string, fn BuiltinFunction) error {
+	if b.Has(name) {
+		return fmt.Errorf("builtin already exists: %s", name)
+	}
+	b.fns[name] = &Builtin{Fn: fn}
+	return nil
+}
+
+// Replace changes what a builtin does, it fails if there is no builtin with that name
+func (b *Builtins) Replace(name string, fn BuiltinFunction) error {
+	if !b.Has(name) {
+		return fmt.Errorf("unknown builtin: %s", name)
+	}
+	b.fns[name] = &Builtin{Fn: fn}
+	return nil
+}
+
+// Remove removes a builtin, it fails if there is no builtin with that name
+func (b *Builtins) Remove(name string) error {
+	if !b.Has(name) {
+		return fmt.Errorf("unknown builtin: %s", name)
+	}
+	delete(b.fns, name)
+	return nil
 }
 
 func builtin_len(_ Environment, args ...object.Object) (object.Object, object.ErrorObj) {
@@ -39,7 +115,7 @@ func builtin_len(_ Environment, args ...object.Object) (object.Object, object.Er
 
 	switch obj := args[0].(type) {
 	case *object.StringObj:
-		return &object.IntegerObj{Value: int64(len(obj.Value))}, object.EmptyErrorObj()
+		return &object.IntegerObj{Value: int64(utf8.RuneCountInString(obj.Value))}, object.EmptyErrorObj()
 	case *object.ArrayObj:
 		return &object.IntegerObj{Value: int64(len(obj.Elements))}, object.EmptyErrorObj()
 	case *object.HashObj:
@@ -51,7 +127,7 @@ func builtin_len(_ Environment, args ...object.Object) (object.Object, object.Er
 	)
 }
 
-func builtin_push(_ Environment, args ...object.Object) (object.Object, object.ErrorObj) {
+func builtin_push(env Environment, args ...object.Object) (object.Object, object.ErrorObj) {
 	if len(args) != 3 && len(args) != 2 {
 		return &object.NullObj{}, object.NewErrorObj(
 			fmt.Sprintf("push() requires 2 or 3 arguments, got %d", len(args)),
@@ -65,6 +141,9 @@ func builtin_push(_ Environment, args ...object.Object) (object.Object, object.E
 				fmt.Sprintf("push() to an array requires exactly 2 arguments, got %d", len(args)),
 			)
 		}
+		if err := env.Budget().Allocate(1); !err.Ok() {
+			return &object.NullObj{}, err
+		}
 		obj.Elements = append(obj.Elements, args[1])
 		return obj, object.EmptyErrorObj()
 	case *object.HashObj:
@@ -79,6 +158,9 @@ func builtin_push(_ Environment, args ...object.Object) (object.Object, object.E
 				"key to push() to a hash must be hashable, got " + string(args[1].Type()),
 			)
 		}
+		if err := env.Budget().Allocate(1); !err.Ok() {
+			return &object.NullObj{}, err
+		}
 		obj.Pairs[key.HashKey()] = object.HashPair{Key: args[1], Value: args[2]}
 		return obj, object.EmptyErrorObj()
 	}
@@ -88,45 +170,82 @@ func builtin_push(_ Environment, args ...object.Object) (object.Object, object.E
 	)
 }
 
-func builtin_print(_ Environment, args ...object.Object) (object.Object, object.ErrorObj) {
+func builtin_print(env Environment, args ...object.Object) (object.Object, object.ErrorObj) {
+	var sb strings.Builder
 	for _, arg := range args {
-		fmt.Print(arg.Inspect() + " ")
+		sb.WriteString(arg.Inspect() + " ")
+	}
+	sb.WriteString("\n")
+	if _, err := io.WriteString(env.Out(), sb.String()); err != nil {
+		return &object.NullObj{}, object.NewErrorObj("print() failed: " + err.Error())
 	}
-	fmt.Print("\n")
 	return &object.NullObj{}, object.EmptyErrorObj()
 }
 
-func builtin_exit(_ Environment, args ...object.Object) (object.Object, object.ErrorObj) {
+// builtin_input shows a prompt and reads a line, null once the input ended
+func builtin_input(env Environment, args ...object.Object) (object.Object, object.ErrorObj) {
 	if len(args) > 1 {
 		return &object.NullObj{}, object.NewErrorObj(
-			fmt.Sprintf("exit() takes at most one argument, got %d", len(args)),
+			fmt.Sprintf("input() takes at most one argument, got %d", len(args)),
 		)
 	}
 
-	if len(args) == 0 {
-		fmt.Println("Exiting with code 0")
-		os.Exit(0)
-	} else if intObj, ok := args[0].(*object.IntegerObj); ok {
-		fmt.Printf("Exiting with code %d\n", intObj.Value)
-		os.Exit(int(intObj.Value))
-	} else {
-		panic("argument to exit() must be an integer")
+	if len(args) == 1 {
+		if _, err := io.WriteString(env.Out(), args[0].Inspect()); err != nil {
+			return &object.NullObj{}, object.NewErrorObj("input() failed: " + err.Error())
+		}
 	}
+	return readLine("input", env)
+}
 
-	return &object.NullObj{}, object.EmptyErrorObj()
+// builtin_read_line reads a line, null once the input ended
+func builtin_read_line(env Environment, args ...object.Object) (object.Object, object.ErrorObj) {
+	if len(args) != 0 {
+		return &object.NullObj{}, object.NewErrorObj(
+			fmt.Sprintf("read_line() takes no arguments, got %d", len(args)),
+		)
+	}
+	return readLine("read_line", env)
 }
 
-func builtin_rest(env Environment, args ...object.Object) (object.Object, object.ErrorObj) {
-	if len(args) != 1 && len(args) != 2 {
+func readLine(name string, env Environment) (object.Object, object.ErrorObj) {
+	line, ok, err := env.ReadLine()
+	if err != nil {
+		return &object.NullObj{}, object.NewErrorObj(name + "() failed: " + err.Error())
+	}
+	if !ok {
+		return &object.NullObj{}, object.EmptyErrorObj()
+	}
+	if err := env.Budget().Allocate(len(line)); !err.Ok() {
+		return &object.NullObj{}, err
+	}
+	return &object.StringObj{Value: line}, object.EmptyErrorObj()
+}
+
+// builtin_exit ends the program, the code is left to whoever runs it
+func builtin_exit(_ Environment, args ...object.Object) (object.Object, object.ErrorObj) {
+	if len(args) > 1 {
 		return &object.NullObj{}, object.NewErrorObj(
-			fmt.Sprintf("rest() requires 1 or 2 arguments, got %d", len(args)),
+			fmt.Sprintf("exit() takes at most one argument, got %d", len(args)),
 		)
 	}
 
-	arr, ok := args[0].(*object.ArrayObj)
+	if len(args) == 0 {
+		return &object.NullObj{}, object.NewExitErrorObj(0)
+	}
+	intObj, ok := args[0].(*object.IntegerObj)
 	if !ok {
 		return &object.NullObj{}, object.NewErrorObj(
-			"first argument to rest() must be an array, got " + string(args[0].Type()),
+			"argument to exit() must be an integer, got " + string(args[0].Type()),
+		)
+	}
+	return &object.NullObj{}, object.NewExitErrorObj(intObj.Value)
+}
+
+func builtin_rest(env Environment, args ...object.Object) (object.Object, object.ErrorObj) {
+	if len(args) != 1 && len(args) != 2 {
+		return &object.NullObj{}, object.NewErrorObj(
+			fmt.Sprintf("rest() requires 1 or 2 arguments, got %d", len(args)),
 		)
 	}
 
@@ -141,13 +260,45 @@ func builtin_rest(env Environment, args ...object.Object) (object.Object, object
 		}
 	}
 
-	if len(arr.Elements) == 0 {
-		return &object.ArrayObj{Elements: []object.Object{}}, object.EmptyErrorObj()
+	switch obj := args[0].(type) {
+	case *object.ArrayObj:
+		if len(obj.Elements) == 0 {
+			return &object.ArrayObj{Elements: []object.Object{}}, object.EmptyErrorObj()
+		}
+		if start < 0 || start > len(obj.Elements) {
+			return &object.NullObj{}, object.NewErrorObj(
+				fmt.Sprintf("rest() start %d out of bounds for array of length %d", start, len(obj.Elements)),
+			)
+		}
+
+		if err := env.Budget().Allocate(len(obj.Elements) - start); !err.Ok() {
+			return &object.NullObj{}, err
+		}
+		result := make([]object.Object, len(obj.Elements)-start)
+		copy(result, obj.Elements[start:])
+		return &object.ArrayObj{Elements: result}, object.EmptyErrorObj()
+	case *object.StringObj:
+		// slicing by character, so multibyte characters are never split
+		runes := []rune(obj.Value)
+		if len(runes) == 0 {
+			return &object.StringObj{Value: ""}, object.EmptyErrorObj()
+		}
+		if start < 0 || start > len(runes) {
+			return &object.NullObj{}, object.NewErrorObj(
+				fmt.Sprintf("rest() start %d out of bounds for string of length %d", start, len(runes)),
+			)
+		}
+
+		rest := string(runes[start:])
+		if err := env.Budget().Allocate(len(rest)); !err.Ok() {
+			return &object.NullObj{}, err
+		}
+		return &object.StringObj{Value: rest}, object.EmptyErrorObj()
 	}
 
-	result := make([]object.Object, len(arr.Elements)-start)
-	copy(result, arr.Elements[start:])
-	return &object.ArrayObj{Elements: result}, object.EmptyErrorObj()
+	return &object.NullObj{}, object.NewErrorObj(
+		"first argument to rest() must be an array or a string, got " + string(args[0].Type()),
+	)
 }
 
 func builtin_filter(env Environment, args ...object.Object) (object.Object, object.ErrorObj) {
@@ -164,22 +315,20 @@ func builtin_filter(env Environment, args ...object.Object) (object.Object, obje
 		)
 	}
 
-	fn, ok := args[1].(object.FunctionObj)
+	fn, ok := args[1].(object.Callable)
 	if !ok {
 		return &object.NullObj{}, object.NewErrorObj(
 			"second argument to filter() must be a function, got " + string(args[1].Type()),
 		)
-	} else if len(fn.Parameters) != 1 {
+	} else if fn.Arity() >= 0 && fn.Arity() != 1 {
 		return &object.NullObj{}, object.NewErrorObj(
-			"filter function must take exactly one argument, got " + fmt.Sprintf("%d", len(fn.Parameters)),
+			"filter function must take exactly one argument, got " + fmt.Sprintf("%d", fn.Arity()),
 		)
 	}
 
 	result := []object.Object{}
 	for _, elem := range arr.Elements {
-		funcEnv := NewEnclosedEnvironment(env)
-		funcEnv.Create(fn.Parameters[0], elem)
-		bool, err := EvalStatement(fn.Body, funcEnv)
+		bool, err := env.call(fn, []object.Object{elem})
 		if !err.Ok() {
 			return &object.NullObj{}, object.NewErrorObj("error evaluating filter function", err)
 		}
@@ -188,6 +337,9 @@ func builtin_filter(env Environment, args ...object.Object) (object.Object, obje
 		}
 	}
 
+	if err := env.Budget().Allocate(len(result)); !err.Ok() {
+		return &object.NullObj{}, err
+	}
 	return &object.ArrayObj{Elements: result}, object.EmptyErrorObj()
 }
 
@@ -205,22 +357,20 @@ func builtin_map(env Environment, args ...object.Object) (object.Object, object.
 		)
 	}
 
-	fn, ok := args[1].(object.FunctionObj)
+	fn, ok := args[1].(object.Callable)
 	if !ok {
 		return &object.NullObj{}, object.NewErrorObj(
 			"second argument to map() must be a function, got " + string(args[1].Type()),
 		)
-	} else if len(fn.Parameters) != 1 {
+	} else if fn.Arity() >= 0 && fn.Arity() != 1 {
 		return &object.NullObj{}, object.NewErrorObj(
-			"map function must take exactly one argument, got " + fmt.Sprintf("%d", len(fn.Parameters)),
+			"map function must take exactly one argument, got " + fmt.Sprintf("%d", fn.Arity()),
 		)
 	}
 
 	result := []object.Object{}
 	for _, elem := range arr.Elements {
-		funcEnv := NewEnclosedEnvironment(env)
-		funcEnv.Create(fn.Parameters[0], elem)
-		mapped, err := EvalStatement(fn.Body, funcEnv)
+		mapped, err := env.call(fn, []object.Object{elem})
 		if !err.Ok() {
 			return &object.NullObj{}, object.NewErrorObj("error evaluating map function", err)
 		}
@@ -228,6 +378,9 @@ func builtin_map(env Environment, args ...object.Object) (object.Object, object.
 		result = append(result, mapped)
 	}
 
+	if err := env.Budget().Allocate(len(result)); !err.Ok() {
+		return &object.NullObj{}, err
+	}
 	return &object.ArrayObj{Elements: result}, object.EmptyErrorObj()
 }
 
@@ -252,22 +405,19 @@ func builtin_reduce(env Environment, args ...object.Object) (object.Object, obje
 		)
 	}
 
-	fn, ok := args[2].(object.FunctionObj)
+	fn, ok := args[2].(object.Callable)
 	if !ok {
 		return &object.NullObj{}, object.NewErrorObj(
 			"third argument to reduce() must be a function, got " + string(args[2].Type()),
 		)
-	} else if len(fn.Parameters) != 2 {
+	} else if fn.Arity() >= 0 && fn.Arity() != 2 {
 		return &object.NullObj{}, object.NewErrorObj(
-			"reduce function must take exactly two arguments, got " + fmt.Sprintf("%d", len(fn.Parameters)),
+			"reduce function must take exactly two arguments, got " + fmt.Sprintf("%d", fn.Arity()),
 		)
 	}
 
 	for _, elem := range arr.Elements {
-		funcEnv := NewEnclosedEnvironment(env)
-		funcEnv.Create(fn.Parameters[0], prev)
-		funcEnv.Create(fn.Parameters[1], elem)
-		mapped, err := EvalStatement(fn.Body, funcEnv)
+		mapped, err := env.call(fn, []object.Object{prev, elem})
 		if !err.Ok() {
 			return &object.NullObj{}, object.NewErrorObj("error evaluating reduce function", err)
 		}
@@ -277,3 +427,146 @@ func builtin_reduce(env Environment, args ...object.Object) (object.Object, obje
 
 	return prev, object.EmptyErrorObj()
 }
+
+func builtin_floor(_ Environment, args ...object.Object) (object.Object, object.ErrorObj) {
+	return roundingBuiltin("floor", math.Floor, args)
+}
+
+func builtin_ceil(_ Environment, args ...object.Object) (object.Object, object.ErrorObj) {
+	return roundingBuiltin("ceil", math.Ceil, args)
+}
+
+func builtin_round(_ Environment, args ...object.Object) (object.Object, object.ErrorObj) {
+	return roundingBuiltin("round", math.Round, args)
+}
+
+// roundingBuiltin applies round to a number and returns it as an int
+func roundingBuiltin(name string, round func(float64) float64, args []object.Object) (object.Object, object.ErrorObj) {
+	if len(args) != 1 {
+		return &object.NullObj{}, object.NewErrorObj(
+			fmt.Sprintf("%s() requires exactly one argument, got %d", name, len(args)),
+		)
+	}
+
+	switch obj := args[0].(type) {
+	case *object.IntegerObj:
+		return &object.IntegerObj{Value: obj.Value}, object.EmptyErrorObj()
+	case *object.FloatObj:
+		rounded := round(obj.Value)
+		if math.IsNaN(rounded) || math.IsInf(rounded, 0) {
+			return &object.NullObj{}, object.NewErrorObj(name + "() cannot convert " + obj.Inspect() + " to an integer")
+		}
+		return &object.IntegerObj{Value: int64(rounded)}, object.EmptyErrorObj()
+	}
+
+	return &object.NullObj{}, object.NewErrorObj(
+		"argument type to " + name + "() not supported, got " + string(args[0].Type()),
+	)
+}
+
+func builtin_float(_ Environment, args ...object.Object) (object.Object, object.ErrorObj) {
+	if len(args) != 1 {
+		return &object.NullObj{}, object.NewErrorObj(
+			fmt.Sprintf("float() requires exactly one argument, got %d", len(args)),
+		)
+	}
+
+	switch obj := args[0].(type) {
+	case *object.IntegerObj:
+		return &object.FloatObj{Value: float64(obj.Value)}, object.EmptyErrorObj()
+	case *object.FloatObj:
+		return &object.FloatObj{Value: obj.Value}, object.EmptyErrorObj()
+	case *object.StringObj:
+		value, err := strconv.ParseFloat(strings.TrimSpace(obj.Value), 64)
+		if err != nil {
+			return &object.NullObj{}, object.NewErrorObj("float() could not parse \"" + obj.Value + "\"")
+		}
+		return &object.FloatObj{Value: value}, object.EmptyErrorObj()
+	}
+
+	return &object.NullObj{}, object.NewErrorObj(
+		"argument type to float() not supported, got " + string(args[0].Type()),
+	)
+}
+
+// int truncates floats towards zero, use floor, ceil or round for other behaviour
+func builtin_int(_ Environment, args ...object.Object) (object.Object, object.ErrorObj) {
+	if len(args) != 1 {
+		return &object.NullObj{}, object.NewErrorObj(
+			fmt.Sprintf("int() requires exactly one argument, got %d", len(args)),
+		)
+	}
+
+	switch obj := args[0].(type) {
+	case *object.IntegerObj:
+		return &object.IntegerObj{Value: obj.Value}, object.EmptyErrorObj()
+	case *object.FloatObj:
+		return roundingBuiltin("int", math.Trunc, args)
+	case *object.StringObj:
+		value, err := strconv.ParseInt(strings.TrimSpace(obj.Value), 10, 64)
+		if err != nil {
+			return &object.NullObj{}, object.NewErrorObj("int() could not parse \"" + obj.Value + "\"")
+		}
+		return &object.IntegerObj{Value: value}, object.EmptyErrorObj()
+	}
+
+	return &object.NullObj{}, object.NewErrorObj(
+		"argument type to int() not supported, got " + string(args[0].Type()),
+	)
+}
+
+// builtin_bytes exposes the raw utf-8 bytes of a string, since len and indexing work on characters
+func builtin_bytes(env Environment, args ...object.Object) (object.Object, object.ErrorObj) {
+	if len(args) != 1 {
+		return &object.NullObj{}, object.NewErrorObj(
+			fmt.Sprintf("bytes() requires exactly one argument, got %d", len(args)),
+		)
+	}
+
+	str, ok := args[0].(*object.StringObj)
+	if !ok {
+		return &object.NullObj{}, object.NewErrorObj(
+			"argument type to bytes() not supported, got " + string(args[0].Type()),
+		)
+	}
+
+	if err := env.Budget().Allocate(len(str.Value)); !err.Ok() {
+		return &object.NullObj{}, err
+	}
+	elements := make([]object.Object, len(str.Value))
+	for i := 0; i < len(str.Value); i++ {
+		elements[i] = &object.IntegerObj{Value: int64(str.Value[i])}
+	}
+	return &object.ArrayObj{Elements: elements}, object.EmptyErrorObj()
+}
+
+// builtin_error raises an error with a message and optional data, a caught error given as data
+// becomes the cause of the new one. error(e) with a caught error raises it again as it was
+func builtin_error(_ Environment, args ...object.Object) (object.Object, object.ErrorObj) {
+	if len(args) != 1 && len(args) != 2 {
+		return &object.NullObj{}, object.NewErrorObj(
+			fmt.Sprintf("error() requires 1 or 2 arguments, got %d", len(args)),
+		)
+	}
+
+	if caught, ok := args[0].(*object.ErrorValueObj); ok && len(args) == 1 {
+		return &object.NullObj{}, caught.Err
+	}
+
+	message, ok := args[0].(*object.StringObj)
+	if !ok {
+		return &object.NullObj{}, object.NewErrorObj(
+			"first argument to error() must be a string, got " + string(args[0].Type()),
+		)
+	}
+
+	err := object.ErrorObj{Message: message.Value, Kind: object.USER_ERROR, SubErrors: []object.ErrorObj{}}
+	if len(args) == 2 {
+		if cause, ok := args[1].(*object.ErrorValueObj); ok {
+			err.SubErrors = []object.ErrorObj{cause.Err}
+		} else {
+			err.Data = args[1]
+		}
+	}
+	return &object.NullObj{}, err
+}
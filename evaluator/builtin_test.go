@@ -1,11 +1,14 @@
-package evaluator
+package evaluator_test
 
 import (
+	"bytes"
+	"main/evaluator"
+	"main/object"
+	"strings"
 	"testing"
 )
 
 func TestBuiltinFunctions(t *testing.T) {
-	InitBuiltins()
 	tests := []struct {
 		input    string
 		expected interface{}
@@ -14,12 +17,156 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
 		{"let test = {}; push(test, 1, 2); len(test)", 1},
+		{`len("héllo")`, 5},
+		{`len("😀")`, 1},
+		{`len("👍🏽 ok")`, 5},
+		{`len("中文字")`, 3},
+		{`len(bytes("😀"))`, 4},
+		{`len(bytes("中文字"))`, 9},
+		{`bytes("é")[0]`, 0xc3},
+		{`bytes("é")[1]`, 0xa9},
+		{`len(bytes(""))`, 0},
+		{`len("\u{1F600}\n")`, 2},
+		{"len(`a\\n`)", 3},
+		{`len("""ab
+cd""")`, 5},
+		{`rest("😀ab")`, "ab"},
+		{`rest("中文字", 2)`, "字"},
+		{`rest("中文", 2)`, ""},
+		{`rest([1, 2, 3], 2)[0]`, 3},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input, t)
 		switch expected := tt.expected.(type) {
 		case int:
 			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testStringObject(t, evaluated, expected)
+		}
+	}
+}
+
+// push() changes the array or hash it is given, so every variable holding it sees the new element
+func TestPushAliasing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = [1]; let b = a; push(b, 2); len(a)", 2},
+		{"let a = [1]; let b = a; push(b, 2); a[1]", 2},
+		{"let a = [1]; let b = push(a, 2); push(b, 3); len(a)", 3},
+		{"let add = fn(arr) { push(arr, 0) }; let a = []; add(a); add(a); len(a)", 2},
+		{"let a = {}; let b = a; push(b, 1, 2); a[1]", 2},
+		{"let a = {}; let b = a; push(b, 1, 2); len(a)", 1},
+
+		// arrays built from another one do not see its pushes, and the other way around
+		{"let a = [1, 2, 3]; let b = rest(a); push(b, 4); len(a)", 3},
+		{"let a = [1, 2, 3]; let b = rest(a); push(a, 4); len(b)", 2},
+		{"let a = [1, 2]; let b = map(a, fn(x) { x }); push(b, 3); len(a)", 2},
+
+		// the pushed value is immutable, changing the variable does not change the element
+		{"let x = 1; let a = []; push(a, x); x += 1; a[0]", 1},
+		{"let x = 1; let a = []; push(a, x); a[0] += 1; x", 1},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input, t)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestBuiltinErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`bytes(1)`, "argument type to bytes() not supported, got INT_OBJ"},
+		{`bytes("a", "b")`, "bytes() requires exactly one argument, got 2"},
+		{`rest("中文", 3)`, "rest() start 3 out of bounds for string of length 2"},
+		{`rest([1], -1)`, "rest() start -1 out of bounds for array of length 1"},
+		{`rest(1)`, "first argument to rest() must be an array or a string, got INT_OBJ"},
+		{`input(1, 2)`, "input() takes at most one argument, got 2"},
+		{`read_line(1)`, "read_line() takes no arguments, got 1"},
+		// a global declared later shadows the builtin, even in functions called before the declaration
+		{`let f = fn() { len("ab") }; f(); let len = fn(x) { 99 }; f()`, "unknown identifier: len"},
+	}
+	for _, tt := range tests {
+		err := testEvalError(tt.input, t)
+		if err.RootCause().Message != tt.expected {
+			t.Errorf("expected error: %q - got: %q", tt.expected, err.RootCause().Message)
+		}
+	}
+}
+
+func constantBuiltin(value int64) evaluator.BuiltinFunction {
+	return func(_ evaluator.Environment, args ...object.Object) (object.Object, object.ErrorObj) {
+		return &object.IntegerObj{Value: value}, object.EmptyErrorObj()
+	}
+}
+
+// every interpreter has builtins of its own, the programs it runs see the changes made to them before they run
+func TestBuiltinRegistry(t *testing.T) {
+	for _, engine := range engines {
+		builtins := evaluator.NewBuiltins()
+		if err := builtins.Add("answer", constantBuiltin(42)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		session := engine.newSession(evaluator.DefaultMaxCallDepth, builtins)
+
+		val, err := session.run(parse("let f = fn() { answer() }; f()", t))
+		if !err.Ok() {
+			t.Fatalf("%s: unexpected error: %s", engine.name, err.Inspect())
+		}
+		testIntegerObject(t, val, 42)
+
+		// the prelude is not there unless asked for
+		if _, err := session.run(parse(`len("a")`, t)); err.Message != "unknown identifier: len" {
+			t.Errorf("%s: error - expected: unknown identifier: len - actual: %q", engine.name, err.Message)
+		}
+
+		builtins.Replace("answer", constantBuiltin(7))
+		val, err = session.run(parse("f()", t))
+		if !err.Ok() {
+			t.Fatalf("%s: unexpected error: %s", engine.name, err.Inspect())
+		}
+		testIntegerObject(t, val, 7)
+
+		// functions of earlier programs still refer to the removed builtin
+		builtins.Remove("answer")
+		if _, err := session.run(parse("f()", t)); err.RootCause().Message != "unknown identifier: answer" {
+			t.Errorf("%s: error - expected: unknown identifier: answer - actual: %q", engine.name, err.RootCause().Message)
+		}
+	}
+
+	builtins := evaluator.Prelude()
+	if err := builtins.Add("len", constantBuiltin(0)); err == nil {
+		t.Errorf("error - expected: adding a builtin twice fails")
+	}
+	if err := builtins.Replace("missing", constantBuiltin(0)); err == nil {
+		t.Errorf("error - expected: replacing a missing builtin fails")
+	}
+	if err := builtins.Remove("len"); err != nil || builtins.Has("len") {
+		t.Errorf("error - expected: len to be removed - actual: %v", err)
+	}
+	if !evaluator.Prelude().Has("len") {
+		t.Errorf("error - expected: every prelude to be a set of its own")
+	}
+}
+
+func TestIOBuiltins(t *testing.T) {
+	for _, engine := range engines {
+		var out bytes.Buffer
+		session := engine.newSession(evaluator.DefaultMaxCallDepth, evaluator.Prelude())
+		session.setIO(strings.NewReader("ann\r\nbob\nlast"), &out, nil)
+
+		val, err := session.run(parse(`let a = input("who? "); let b = read_line(); print(a, b); print(read_line(), read_line()); input()`, t))
+		if !err.Ok() {
+			t.Fatalf("%s: unexpected error: %s", engine.name, err.Inspect())
+		}
+		if val.Type() != object.NULL_OBJ {
+			t.Errorf("%s: error - expected: null once the input ended - actual: %s", engine.name, val.Inspect())
+		}
+		if expected := "who? ann bob \nlast null \n"; out.String() != expected {
+			t.Errorf("%s: error - expected: output %q - actual: %q", engine.name, expected, out.String())
 		}
 	}
 }
@@ -0,0 +1,196 @@
+package evaluator_test
+
+import (
+	"context"
+	"io"
+	"main/ast"
+	"main/benchmarks"
+	"main/compiler"
+	"main/evaluator"
+	"main/lexer"
+	"main/object"
+	"main/parser"
+	"main/vm"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// session runs programs one after the other on one engine, like a REPL does
+type session interface {
+	run(program ast.Program) (object.Object, object.ErrorObj)
+	callStack() []object.Frame
+	setIO(in io.Reader, out io.Writer, errOut io.Writer)
+	setLimits(limits evaluator.Limits)
+	setContext(ctx context.Context)
+}
+
+type evalSession struct {
+	env evaluator.Environment
+}
+
+func (s *evalSession) run(program ast.Program) (object.Object, object.ErrorObj) {
+	return evaluator.Eval(program, s.env)
+}
+
+func (s *evalSession) callStack() []object.Frame { return s.env.CallStack() }
+
+func (s *evalSession) setIO(in io.Reader, out io.Writer, errOut io.Writer) {
+	s.env.SetIO(in, out, errOut)
+}
+
+func (s *evalSession) setLimits(limits evaluator.Limits) { s.env.SetLimits(limits) }
+
+func (s *evalSession) setContext(ctx context.Context) { s.env.SetContext(ctx) }
+
+type vmSession struct {
+	compiler *compiler.Compiler
+	machine  *vm.VM
+}
+
+func (s *vmSession) run(program ast.Program) (object.Object, object.ErrorObj) {
+	bytecode, err := s.compiler.Compile(program)
+	if !err.Ok() {
+		return object.NullObj{}, err
+	}
+	return s.machine.Run(bytecode)
+}
+
+func (s *vmSession) callStack() []object.Frame { return s.machine.CallStack() }
+
+func (s *vmSession) setIO(in io.Reader, out io.Writer, errOut io.Writer) {
+	s.machine.SetIO(in, out, errOut)
+}
+
+func (s *vmSession) setLimits(limits evaluator.Limits) { s.machine.SetLimits(limits) }
+
+func (s *vmSession) setContext(ctx context.Context) { s.machine.SetContext(ctx) }
+
+// engines are the ways to run a program, every test program runs on all of them and they have to agree
+var engines = []struct {
+	name       string
+	newSession func(maxCallDepth int, builtins *evaluator.Builtins) session
+}{
+	{"eval", func(maxCallDepth int, builtins *evaluator.Builtins) session {
+		env := evaluator.NewEnvironment(builtins)
+		env.SetMaxCallDepth(maxCallDepth)
+		return &evalSession{env: env}
+	}},
+	{"vm", func(maxCallDepth int, builtins *evaluator.Builtins) session {
+		machine := vm.New(builtins)
+		machine.SetMaxCallDepth(maxCallDepth)
+		return &vmSession{compiler: compiler.New(builtins), machine: machine}
+	}},
+}
+
+func parse(input string, t *testing.T) ast.Program {
+	l := lexer.CreateLexer(input)
+	p := parser.CreateParser(l)
+	program, errs := p.ParseProgram()
+
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	return program
+}
+
+func testEval(input string, t *testing.T) object.Object {
+	return testEvalWithDepth(input, evaluator.DefaultMaxCallDepth, t)
+}
+
+// testEvalWithDepth runs a program that must not fail on every engine, and returns what the evaluator got
+func testEvalWithDepth(input string, maxCallDepth int, t *testing.T) object.Object {
+	program := parse(input, t)
+
+	results := []object.Object{}
+	for _, engine := range engines {
+		val, err := engine.newSession(maxCallDepth, evaluator.Prelude()).run(program)
+		if !err.Ok() {
+			t.Fatalf("%s: %q returned an error: %s", engine.name, input, err.Inspect())
+		}
+		results = append(results, val)
+	}
+
+	for i := 1; i < len(results); i++ {
+		if expected, got := inspect(results[0]), inspect(results[i]); got != expected {
+			t.Errorf("%q: %s evaluates to %s, but %s evaluates to %s", input, engines[0].name, expected, engines[i].name, got)
+		}
+	}
+	return results[0]
+}
+
+// testEvalError runs a program that must fail on every engine, and returns the error of the evaluator
+func testEvalError(input string, t *testing.T) object.ErrorObj {
+	program := parse(input, t)
+
+	errs := []object.ErrorObj{}
+	for _, engine := range engines {
+		_, err := engine.newSession(evaluator.DefaultMaxCallDepth, evaluator.Prelude()).run(program)
+		if err.Ok() {
+			t.Fatalf("%s: expected an error evaluating %q", engine.name, input)
+		}
+		errs = append(errs, err)
+	}
+
+	for i := 1; i < len(errs); i++ {
+		if expected, got := describeError(errs[0]), describeError(errs[i]); got != expected {
+			t.Errorf("%q: %s fails with %s, but %s fails with %s", input, engines[0].name, expected, engines[i].name, got)
+		}
+	}
+	return errs[0]
+}
+
+// describeError is what engines have to agree on about an error: what was raised, where and in which calls
+func describeError(err object.ErrorObj) string {
+	raised := err.Raised()
+	frames := []string{}
+	for _, frame := range err.CallStack() {
+		frames = append(frames, frame.Function+"@"+frame.CallSite.String())
+	}
+	return raised.Kind + ": " + raised.Message + " at " + err.Location().String() + " in [" + strings.Join(frames, " ") + "]"
+}
+
+// inspect shows a value along with its type, hash pairs are sorted so equal hashes look the same
+func inspect(obj object.Object) string {
+	switch o := obj.(type) {
+	case *object.ArrayObj:
+		elements := []string{}
+		for _, element := range o.Elements {
+			elements = append(elements, inspect(element))
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case *object.HashObj:
+		pairs := []string{}
+		for _, pair := range o.Pairs {
+			pairs = append(pairs, inspect(pair.Key)+": "+inspect(pair.Value))
+		}
+		sort.Strings(pairs)
+		return "{" + strings.Join(pairs, ", ") + "}"
+	default:
+		return string(obj.Type()) + " " + obj.Inspect()
+	}
+}
+
+// BenchmarkEval runs the corpus on every engine, from a parsed program to its result
+func BenchmarkEval(b *testing.B) {
+	for _, bench := range benchmarks.Corpus() {
+		p := parser.CreateParser(lexer.CreateLexer(bench.Source))
+		program, errs := p.ParseProgram()
+		if len(errs) > 0 {
+			b.Fatalf("%s: unexpected errors: %v", bench.Name, errs)
+		}
+
+		for _, engine := range engines {
+			b.Run(bench.Name+"/"+engine.name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					session := engine.newSession(evaluator.DefaultMaxCallDepth, evaluator.Prelude())
+					// scripts print, their output would drown the results
+					session.setIO(nil, io.Discard, nil)
+					if _, err := session.run(program); !err.Ok() {
+						b.Fatalf("unexpected error: %s", err.Inspect())
+					}
+				}
+			})
+		}
+	}
+}
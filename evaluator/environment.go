@@ -1,55 +1,292 @@
 package evaluator
 
 import (
+	"bufio"
+	"context"
+	"io"
+	"main/ast"
 	"main/object"
+	"main/resolver"
+	"main/token"
+	"os"
+	"strings"
 )
 
+// Environment is one scope of variables. The resolver decides which scope and slot every
+// name refers to before a program runs, globals and builtins are kept by the state
 type Environment struct {
-	Store map[string]object.Object
-	Outer *Environment
+	vars      []object.Object // by the slots the resolver gave them, nil until declared
+	Outer     *Environment
+	state     *state // shared by every scope of the same interpreter
+	tailCalls bool   // whether a return of a call may leave the call to the caller
 }
 
-func NewEnvironment() Environment {
-	return Environment{Store: make(map[string]object.Object), Outer: nil}
+// DefaultMaxCallDepth is how deep calls may nest unless changed with SetMaxCallDepth
+const DefaultMaxCallDepth = 10000
+
+// state is what a running program keeps track of besides variables
+type state struct {
+	frames       []object.Frame // the call stack, innermost call last
+	maxCallDepth int            // 0 for no limit
+	callFunc     CallFunc       // calls functions for builtins, nil for the functions of this package
+
+	resolver     *resolver.Resolver // remembers the globals of every program run so far
+	globals      []object.Object    // by the slots the resolver gave them, nil until declared
+	constGlobals []bool             // whether the global in the same slot was declared with const
+	available    *Builtins          // the builtins programs can call
+	builtins     []*Builtin         // by the indexes the resolver gave them, nil once removed
+
+	budget Budget // what the current run used of its limits
+
+	in     *bufio.Reader // where builtins read lines from, os.Stdin once first read if nil
+	out    io.Writer     // where builtins write to
+	errOut io.Writer     // where builtins report problems
+}
+
+// CallFunc calls a function value with already evaluated arguments
+type CallFunc func(fn object.Callable, args []object.Object) (object.Object, object.ErrorObj)
+
+// SetCallFunc makes builtins like map() call the functions they are given through call,
+// so an engine with functions of its own can share the builtins
+func (e *Environment) SetCallFunc(call CallFunc) {
+	e.state.callFunc = call
+}
+
+// call calls a function value for a builtin
+func (e *Environment) call(fn object.Callable, args []object.Object) (object.Object, object.ErrorObj) {
+	if e.state != nil && e.state.callFunc != nil {
+		return e.state.callFunc(fn, args)
+	}
+
+	switch function := fn.(type) {
+	case object.FunctionObj:
+		return applyFunction(function, args, *e, e.callSite())
+	case *Builtin:
+		if err := e.Budget().Step(); !err.Ok() {
+			return object.NullObj{}, err
+		}
+		return function.Fn(*e, args...)
+	default:
+		return object.NullObj{}, object.NewErrorObj("not a function: " + string(fn.Type()))
+	}
+}
+
+// NewEnvironment returns the top level scope of an interpreter whose programs can call builtins,
+// nil for none. Prelude() has the builtins of the language
+func NewEnvironment(builtins *Builtins) Environment {
+	if builtins == nil {
+		builtins = NewBuiltins()
+	}
+	return Environment{
+		state: &state{
+			maxCallDepth: DefaultMaxCallDepth,
+			resolver:     resolver.New(builtins.Has),
+			available:    builtins,
+			out:          os.Stdout,
+			errOut:       os.Stderr,
+		},
+	}
+}
+
+// Builtins returns the builtins programs can call, programs see the changes made to them before they run
+func (e *Environment) Builtins() *Builtins {
+	return e.state.available
+}
+
+// NewEnclosedEnvironment returns a scope inside env with room for slots variables
+func NewEnclosedEnvironment(env Environment, slots int) Environment {
+	return Environment{
+		vars:      make([]object.Object, slots),
+		Outer:     &env,
+		state:     env.state,
+		tailCalls: env.tailCalls,
+	}
+}
+
+// SetIO makes builtins read from in, write to out and report problems to errOut. A nil one is left as it is.
+// Lines are read through a buffer, a *bufio.Reader is used as it is so its owner can share it
+func (e *Environment) SetIO(in io.Reader, out io.Writer, errOut io.Writer) {
+	if in != nil {
+		e.state.in = bufio.NewReader(in)
+	}
+	if out != nil {
+		e.state.out = out
+	}
+	if errOut != nil {
+		e.state.errOut = errOut
+	}
+}
+
+// Out is where builtins write to, os.Stdout unless changed with SetIO
+func (e *Environment) Out() io.Writer {
+	if e.state == nil || e.state.out == nil {
+		return os.Stdout
+	}
+	return e.state.out
+}
+
+// Err is where builtins report problems, os.Stderr unless changed with SetIO. The prelude never
+// does, it is there for the builtins a host adds and for the host reporting the errors of its runs
+func (e *Environment) Err() io.Writer {
+	if e.state == nil || e.state.errOut == nil {
+		return os.Stderr
+	}
+	return e.state.errOut
+}
+
+// ReadLine reads the next line of the input without its line ending, false once the input ended
+func (e *Environment) ReadLine() (string, bool, error) {
+	if e.state == nil {
+		e.state = &state{}
+	}
+	if e.state.in == nil {
+		e.state.in = bufio.NewReader(os.Stdin)
+	}
+
+	line, err := e.state.in.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return "", false, nil
+	}
+	if err != nil && err != io.EOF {
+		return "", false, err
+	}
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r"), true, nil
+}
+
+// SetMaxCallDepth limits how deep calls may nest, deeper calls raise a RecursionError.
+// The limit applies to every scope of the program, 0 removes it
+func (e *Environment) SetMaxCallDepth(depth int) {
+	e.state.maxCallDepth = depth
+}
+
+// SetLimits limits the steps and elements of every run from now on
+func (e *Environment) SetLimits(limits Limits) {
+	e.state.budget.limits = limits
+}
+
+// SetContext makes runs fail with a LimitError once ctx is done, it is checked at calls and loop iterations
+func (e *Environment) SetContext(ctx context.Context) {
+	e.state.budget.ctx = ctx
 }
 
-func NewEnclosedEnvironment(env Environment) Environment {
-	return Environment{Store: make(map[string]object.Object), Outer: &env}
+// Budget returns what the current run used of its limits, builtins creating arrays, hashes and strings count them with it
+func (e *Environment) Budget() *Budget {
+	if e.state == nil {
+		e.state = &state{}
+	}
+	return &e.state.budget
+}
+
+// startRun gives a run the whole budget, unless it is a call the host made while a program runs
+func (e *Environment) startRun() {
+	if len(e.state.frames) == 0 {
+		e.state.budget.Reset()
+	}
 }
 
-func (e *Environment) Create(name string, value object.Object) {
-	if val := e.getInCurrEnv(name); val != nil {
-		panic("variable: " + name + " already exists")
+// callDepthExceeded reports whether one more call would nest deeper than allowed
+func (e *Environment) callDepthExceeded() bool {
+	return e.state != nil && e.state.maxCallDepth > 0 && len(e.state.frames) >= e.state.maxCallDepth
+}
+
+// pushFrame adds a call to the stack, the returned function removes it again
+func (e *Environment) pushFrame(function string, callSite token.Position) func() {
+	if e.state == nil {
+		e.state = &state{}
+	}
+	e.state.frames = append(e.state.frames, object.Frame{Function: function, CallSite: callSite})
+	depth := len(e.state.frames)
+	return func() { e.state.frames = e.state.frames[:depth-1] }
+}
+
+// CallStack returns a copy of the current call stack, outermost call first
+func (e *Environment) CallStack() []object.Frame {
+	if e.state == nil {
+		return nil
+	}
+	return append([]object.Frame{}, e.state.frames...)
+}
+
+// callSite is where the innermost call was made from, builtins calling functions pass it on
+func (e *Environment) callSite() token.Position {
+	if e.state == nil || len(e.state.frames) == 0 {
+		return token.Position{}
+	}
+	return e.state.frames[len(e.state.frames)-1].CallSite
+}
+
+// resolve finds the variables and builtins of a program, and makes room for the globals it declares
+func (e *Environment) resolve(program ast.Program) (ast.Program, object.ErrorObj) {
+	resolved, err := e.state.resolver.Resolve(program)
+	if !err.Ok() {
+		return resolved, err
+	}
+
+	for len(e.state.globals) < len(e.state.resolver.Globals()) {
+		e.state.globals = append(e.state.globals, nil)
+		e.state.constGlobals = append(e.state.constGlobals, false)
+	}
+	// builtins may have been replaced or removed since the last program, every one is looked up again
+	e.state.builtins = e.state.builtins[:0]
+	for _, name := range e.state.resolver.Builtins() {
+		builtin, _ := e.state.available.Lookup(name)
+		e.state.builtins = append(e.state.builtins, builtin)
+	}
+	return resolved, object.EmptyErrorObj()
+}
+
+// Global returns the value of a top level variable, false if it was never declared
+func (e *Environment) Global(name string) (object.Object, bool) {
+	slot, ok := e.state.resolver.Global(name)
+	if !ok || slot >= len(e.state.globals) || e.state.globals[slot] == nil {
+		return nil, false
+	}
+	return e.state.globals[slot], true
+}
+
+// SetGlobal assigns to a top level variable, declaring it if no program did. Constants cannot be assigned to
+func (e *Environment) SetGlobal(name string, value object.Object) object.ErrorObj {
+	slot := e.state.resolver.DeclareGlobal(name)
+	for len(e.state.globals) <= slot {
+		e.state.globals = append(e.state.globals, nil)
+		e.state.constGlobals = append(e.state.constGlobals, false)
+	}
+	if e.state.constGlobals[slot] {
+		return object.NewErrorObj("cannot assign to constant: " + name)
 	}
-	e.Store[name] = value
+	e.state.globals[slot] = value
+	return object.EmptyErrorObj()
 }
 
-func (e *Environment) Set(name string, value object.Object) {
-	if val := e.Get(name); val != nil {
-		e.Store[name] = value
-	} else if e.Outer != nil {
-		e.Outer.Set(name, value)
-	} else {
-		panic("variable not found")
+// variable returns the slot of a variable, nil for builtins. The slot is nil until the variable is declared
+func (e *Environment) variable(binding ast.Binding) *object.Object {
+	switch binding.Scope {
+	case ast.Local:
+		env := e
+		for i := 0; i < binding.Depth; i++ {
+			env = env.Outer
+		}
+		return &env.vars[binding.Slot]
+	case ast.Global:
+		return &e.state.globals[binding.Slot]
+	default:
+		return nil
 	}
 }
 
-func (e *Environment) Get(name string) object.Object {
-	if value, ok := e.Store[name]; ok {
-		return value
-	} else if e.Outer != nil {
-		return e.Outer.Get(name)
-	} else if builtins[name] != nil {
-		return builtins[name]
+// builtin returns the builtin of a binding, nil if it is not one
+func (e *Environment) builtin(binding ast.Binding) *Builtin {
+	if binding.Scope != ast.Builtin {
+		return nil
 	}
-	return nil
+	return e.state.builtins[binding.Slot]
 }
 
-func (e *Environment) getInCurrEnv(name string) object.Object {
-	if value, ok := e.Store[name]; ok {
-		return value
-	} else if builtins[name] != nil {
-		return builtins[name]
+// isConst reports whether a declared variable cannot be assigned to
+func (e *Environment) isConst(binding ast.Binding) bool {
+	if binding.Scope == ast.Global {
+		return e.state.constGlobals[binding.Slot]
 	}
-	return nil
+	return binding.Const
 }
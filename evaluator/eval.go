@@ -1,25 +1,85 @@
 package evaluator
 
 import (
+	"fmt"
 	"main/ast"
 	"main/object"
 )
 
-func Eval(p ast.Program, env Environment) (object.Object, object.ErrorObj) {
-	var lastStatement object.Object = object.NullObj{} // we return the value of the last statement in the program
+// Eval runs a program, after finding the variable every name refers to. A name that refers to nothing
+// fails the program before it starts. A bug in the interpreter that makes Go panic is returned as an
+// internal error, so a script can never take down the program embedding it
+func Eval(p ast.Program, env Environment) (result object.Object, evalErr object.ErrorObj) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, evalErr = object.NullObj{}, object.NewErrorObj(fmt.Sprintf("internal error: %v", r))
+			evalErr.Kind = object.INTERNAL_ERROR
+		}
+	}()
+
+	p, err := env.resolve(p)
+	if !err.Ok() {
+		return object.NullObj{}, err
+	}
+	env.startRun()
+
+	lastStatement, err := evalStatements(p.Statements, env)
+	if !err.Ok() {
+		return object.NullObj{}, err
+	}
+
+	// a top level return ends the program with the returned value
+	if returned, ok := lastStatement.(*object.ReturnObj); ok {
+		return returned.Value, object.EmptyErrorObj()
+	}
+
+	return lastStatement, object.EmptyErrorObj()
+}
+
+// Call calls a function value from outside of any program, like the function a program
+// embedding the interpreter looked up. As with Eval a panic is returned as an internal error
+func Call(fn object.Object, args []object.Object, env Environment) (result object.Object, callErr object.ErrorObj) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, callErr = object.NullObj{}, object.NewErrorObj(fmt.Sprintf("internal error: %v", r))
+			callErr.Kind = object.INTERNAL_ERROR
+		}
+	}()
+
+	env.startRun()
+	switch funcObj := fn.(type) {
+	case object.FunctionObj:
+		return applyFunction(funcObj, args, env, env.callSite())
+	case *Builtin:
+		return funcObj.Fn(env, args...)
+	default:
+		return object.NullObj{}, object.NewErrorObj("not a function: " + string(fn.Type()))
+	}
+}
+
+func evalStatements(statements []ast.Statement, env Environment) (object.Object, object.ErrorObj) {
+	var lastStatement object.Object = object.NullObj{} // we return the value of the last statement
 	var err object.ErrorObj
 
-	for _, statement := range p.Statements {
+	for _, statement := range statements {
 		lastStatement, err = EvalStatement(statement, env)
 		if !err.Ok() {
 			return object.NullObj{}, err
 		}
 
-		// halt if statement is a return statement
-		if _, ok := statement.(ast.ReturnStatement); ok {
+		// halt if a return, break or continue is unwinding through this block
+		if isSignal(lastStatement) {
 			return lastStatement, object.EmptyErrorObj()
 		}
 	}
 
 	return lastStatement, object.EmptyErrorObj()
 }
+
+func isSignal(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.ReturnObj, *object.BreakObj, *object.ContinueObj:
+		return true
+	}
+	return false
+}
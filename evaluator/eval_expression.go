@@ -1,21 +1,38 @@
 package evaluator
 
 import (
+	"fmt"
 	"main/ast"
 	"main/object"
+	"main/token"
+	"math"
 	"strconv"
 )
 
 func EvalExpression(n ast.Expression, env Environment) (object.Object, object.ErrorObj) {
+	val, err := evalExpression(n, env)
+	if !err.Ok() {
+		return val, err.At(n.Pos())
+	}
+	return val, err
+}
+
+func evalExpression(n ast.Expression, env Environment) (object.Object, object.ErrorObj) {
 	switch exp := n.(type) {
 	case ast.IntExpression:
 		return evalInteger(exp)
+	case ast.FloatExpression:
+		return evalFloat(exp)
 	case ast.BooleanExpression:
 		return evalBoolean(exp)
 	case ast.StringExpression:
 		return evalString(exp)
 	case ast.PrefixExpression:
 		return evalPrefix(exp, env)
+	case ast.PostfixExpression:
+		return evalPostfix(exp, env)
+	case ast.AssignExpression:
+		return evalAssign(exp, env)
 	case ast.InfixExpression:
 		return evalInfix(exp, env)
 	case ast.IfExpression:
@@ -23,7 +40,7 @@ func EvalExpression(n ast.Expression, env Environment) (object.Object, object.Er
 	case ast.IdentifierExpression:
 		return evalIdentifier(exp, env)
 	case ast.FunctionExpression:
-		return evalFunction(exp)
+		return evalFunction(exp, env)
 	case ast.CallExpression:
 		return evalCall(exp, env)
 	case ast.ArrayExpression:
@@ -33,7 +50,7 @@ func EvalExpression(n ast.Expression, env Environment) (object.Object, object.Er
 	case ast.HashExpression:
 		return evalHash(exp, env)
 	default:
-		panic("unknown expression type")
+		return object.NullObj{}, object.NewErrorObj(fmt.Sprintf("unknown expression type: %T", exp))
 	}
 }
 
@@ -46,6 +63,15 @@ func evalInteger(node ast.IntExpression) (object.Object, object.ErrorObj) {
 	return &object.IntegerObj{Value: value}, object.EmptyErrorObj()
 }
 
+func evalFloat(node ast.FloatExpression) (object.Object, object.ErrorObj) {
+	value, err := strconv.ParseFloat(node.TokenLiteral(), 64) // highly unlikely to fail
+	if err != nil {
+		return object.NullObj{}, object.NewErrorObj("failed to parse float: " + err.Error())
+	}
+
+	return &object.FloatObj{Value: value}, object.EmptyErrorObj()
+}
+
 func evalBoolean(node ast.BooleanExpression) (object.Object, object.ErrorObj) {
 	if node.TokenLiteral() == "true" {
 		return &object.BooleanObj{Value: true}, object.EmptyErrorObj()
@@ -60,35 +86,247 @@ func evalString(node ast.StringExpression) (object.Object, object.ErrorObj) {
 }
 
 func evalPrefix(node ast.PrefixExpression, env Environment) (object.Object, object.ErrorObj) {
+	// ++x and --x on a variable or element store the result, and evaluate to the new value
+	if isStep(node.Token.Type) && isAssignable(node.Expression) {
+		_, updated, err := assign(node.Expression, env, StepUpdate(node.TokenLiteral()))
+		if !err.Ok() {
+			return object.NullObj{}, object.NewErrorObj("failed to evaluate prefix expression", err.RaisedAt(node.Pos()))
+		}
+		return updated, object.EmptyErrorObj()
+	}
+
 	exp, err := EvalExpression(node.Expression, env)
 	if !err.Ok() {
 		return object.NullObj{}, object.NewErrorObj("failed to evaluate prefix expression", err)
 	}
 
-	if intexp, ok := exp.(*object.IntegerObj); ok {
-		switch node.TokenLiteral() {
+	return EvalPrefixOperator(node.TokenLiteral(), exp)
+}
+
+// EvalPrefixOperator applies a prefix operator to a value, ++ and -- only compute the stepped value
+func EvalPrefixOperator(operator string, operand object.Object) (object.Object, object.ErrorObj) {
+	if intexp, ok := operand.(*object.IntegerObj); ok {
+		switch operator {
 		case "-":
-			intexp.Value = -intexp.Value
+			return &object.IntegerObj{Value: -intexp.Value}, object.EmptyErrorObj()
 		case "++":
-			intexp.Value += 1
+			return &object.IntegerObj{Value: intexp.Value + 1}, object.EmptyErrorObj()
 		case "--":
-			intexp.Value -= 1
+			return &object.IntegerObj{Value: intexp.Value - 1}, object.EmptyErrorObj()
 		default:
-			return object.NullObj{}, object.NewErrorObj("unknown int prefix operator: " + node.TokenLiteral())
+			return object.NullObj{}, object.NewErrorObj("unknown int prefix operator: " + operator)
 		}
-
-		return intexp, object.EmptyErrorObj()
-	} else if boolExp, ok := exp.(*object.BooleanObj); ok {
-		switch node.TokenLiteral() {
+	} else if floatExp, ok := operand.(*object.FloatObj); ok {
+		switch operator {
+		case "-":
+			return &object.FloatObj{Value: -floatExp.Value}, object.EmptyErrorObj()
+		case "++":
+			return &object.FloatObj{Value: floatExp.Value + 1}, object.EmptyErrorObj()
+		case "--":
+			return &object.FloatObj{Value: floatExp.Value - 1}, object.EmptyErrorObj()
+		default:
+			return object.NullObj{}, object.NewErrorObj("unknown float prefix operator: " + operator)
+		}
+	} else if boolExp, ok := operand.(*object.BooleanObj); ok {
+		switch operator {
 		case "!":
-			boolExp.Value = !boolExp.Value
+			return &object.BooleanObj{Value: !boolExp.Value}, object.EmptyErrorObj()
 		default:
-			return object.NullObj{}, object.NewErrorObj("unknown bool prefix operator: " + node.TokenLiteral())
+			return object.NullObj{}, object.NewErrorObj("unknown bool prefix operator: " + operator)
 		}
-
-		return boolExp, object.EmptyErrorObj()
 	} else {
-		return object.NullObj{}, object.NewErrorObj("unknown prefix expression type: " + node.TokenLiteral())
+		return object.NullObj{}, object.NewErrorObj("unknown prefix expression type: " + operator)
+	}
+}
+
+func evalPostfix(node ast.PostfixExpression, env Environment) (object.Object, object.ErrorObj) {
+	// x++ and x-- store the result, but evaluate to the value before the update
+	old, _, err := assign(node.Expression, env, StepUpdate(node.TokenLiteral()))
+	if !err.Ok() {
+		return object.NullObj{}, object.NewErrorObj("failed to evaluate postfix expression", err.RaisedAt(node.Pos()))
+	}
+	return old, object.EmptyErrorObj()
+}
+
+func evalAssign(node ast.AssignExpression, env Environment) (object.Object, object.ErrorObj) {
+	update := func(current object.Object) (object.Object, object.ErrorObj) {
+		value, err := EvalExpression(node.Value, env)
+		if !err.Ok() {
+			return object.NullObj{}, object.NewErrorObj("failed to evaluate assigned value", err)
+		}
+
+		switch node.Token.Type {
+		case token.PLUS_EQUAL:
+			updated, err := CompoundOperator("+", current, value)
+			if !err.Ok() {
+				return updated, err
+			}
+			return updated, env.Budget().AllocateString(updated)
+		case token.MINUS_EQUAL:
+			return CompoundOperator("-", current, value)
+		default:
+			return value, object.EmptyErrorObj()
+		}
+	}
+
+	_, updated, err := assign(node.Target, env, update)
+	if !err.Ok() {
+		return object.NullObj{}, object.NewErrorObj("failed to evaluate assignment to "+node.Target.String(), err.RaisedAt(node.Pos()))
+	}
+	return updated, object.EmptyErrorObj()
+}
+
+func CompoundOperator(operator string, current object.Object, value object.Object) (object.Object, object.ErrorObj) {
+	if current == nil {
+		return object.NullObj{}, object.NewErrorObj("cannot use " + operator + "= on a missing value")
+	}
+	return EvalInfixOperator(operator, current, value)
+}
+
+func isStep(t token.TokenType) bool {
+	return t == token.INCREMENT || t == token.DECREMENT
+}
+
+// StepUpdate is the update used by ++ and --, both prefix and postfix
+func StepUpdate(operator string) func(object.Object) (object.Object, object.ErrorObj) {
+	return func(current object.Object) (object.Object, object.ErrorObj) {
+		step := int64(1)
+		if operator == "--" {
+			step = -1
+		}
+
+		switch obj := current.(type) {
+		case *object.IntegerObj:
+			return &object.IntegerObj{Value: obj.Value + step}, object.EmptyErrorObj()
+		case *object.FloatObj:
+			return &object.FloatObj{Value: obj.Value + float64(step)}, object.EmptyErrorObj()
+		case nil:
+			return object.NullObj{}, object.NewErrorObj("cannot use " + operator + " on missing value")
+		default:
+			return object.NullObj{}, object.NewErrorObj("cannot use " + operator + " on " + string(current.Type()))
+		}
+	}
+}
+
+func isAssignable(exp ast.Expression) bool {
+	switch exp.(type) {
+	case ast.IdentifierExpression, ast.IndexExpression:
+		return true
+	}
+	return false
+}
+
+// assign writes update(current value) into a variable or a container element.
+// the target's sub expressions are evaluated exactly once, so compound
+// assignments like arr[f()] += 1 only call f once.
+// current is nil when assigning a new key to a hash.
+func assign(
+	target ast.Expression,
+	env Environment,
+	update func(current object.Object) (object.Object, object.ErrorObj),
+) (object.Object, object.Object, object.ErrorObj) {
+	switch t := target.(type) {
+	case ast.IdentifierExpression:
+		name := t.TokenLiteral()
+
+		// the update still runs, its errors come first
+		if builtin := env.builtin(t.Binding); builtin != nil {
+			if _, err := update(builtin); !err.Ok() {
+				return nil, nil, err
+			}
+			return nil, nil, object.NewErrorObj("cannot assign to builtin: " + name)
+		}
+
+		slot := env.variable(t.Binding)
+		if slot == nil || *slot == nil {
+			return nil, nil, object.NewErrorObj("cannot assign to undeclared variable: " + name)
+		}
+
+		if env.isConst(t.Binding) {
+			return nil, nil, object.NewErrorObj("cannot assign to constant: " + name)
+		}
+
+		current := *slot
+		updated, err := update(current)
+		if !err.Ok() {
+			return nil, nil, err
+		}
+
+		*slot = updated
+		return current, updated, object.EmptyErrorObj()
+	case ast.IndexExpression:
+		container, err := EvalExpression(t.Exp, env)
+		if !err.Ok() {
+			return nil, nil, object.NewErrorObj("failed to evaluate container identifier", err)
+		}
+
+		index, err := EvalExpression(t.Index, env)
+		if !err.Ok() {
+			return nil, nil, object.NewErrorObj("failed to evaluate container index", err)
+		}
+
+		return AssignIndex(container, index, update, env.Budget())
+	default:
+		return nil, nil, object.NewErrorObj("invalid assignment target: " + target.String())
+	}
+}
+
+// AssignIndex writes the result of update to an element of an array or hash, a new key of a hash counts against the budget
+func AssignIndex(
+	container object.Object,
+	index object.Object,
+	update func(current object.Object) (object.Object, object.ErrorObj),
+	budget *Budget,
+) (object.Object, object.Object, object.ErrorObj) {
+	switch containerObj := container.(type) {
+	case *object.ArrayObj:
+		intIndex, ok := index.(*object.IntegerObj)
+		if !ok {
+			return nil, nil, object.NewErrorObj("array index must be an integer, got " + string(index.Type()))
+		}
+		if intIndex.Value < 0 || intIndex.Value >= int64(len(containerObj.Elements)) {
+			return nil, nil, object.NewErrorObj(
+				"index out of bounds, attempted to assign " + intIndex.Inspect() +
+					" in array of length " + strconv.Itoa(len(containerObj.Elements)),
+			)
+		}
+
+		current := containerObj.Elements[intIndex.Value]
+		updated, err := update(current)
+		if !err.Ok() {
+			return nil, nil, err
+		}
+
+		containerObj.Elements[intIndex.Value] = updated
+		return current, updated, object.EmptyErrorObj()
+	case *object.HashObj:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return nil, nil, object.NewErrorObj("unhashable key type: " + string(index.Type()))
+		}
+
+		var current object.Object
+		pair, exists := containerObj.Pairs[key.HashKey()]
+		if exists {
+			current = pair.Value
+		}
+
+		updated, err := update(current)
+		if !err.Ok() {
+			return nil, nil, err
+		}
+		if !exists {
+			if err := budget.Allocate(1); !err.Ok() {
+				return nil, nil, err
+			}
+		}
+
+		containerObj.Pairs[key.HashKey()] = object.HashPair{Key: index, Value: updated}
+		return current, updated, object.EmptyErrorObj()
+	case *object.StringObj:
+		return nil, nil, object.NewErrorObj("strings are immutable, cannot assign to an index")
+	default:
+		return nil, nil, object.NewErrorObj("unassignable data type: " + string(container.Type()))
 	}
 }
 
@@ -103,10 +341,18 @@ func evalInfix(node ast.InfixExpression, env Environment) (object.Object, object
 		return object.NullObj{}, object.NewErrorObj("failed to evaluate infix right expression", err)
 	}
 
+	result, err := EvalInfixOperator(node.TokenLiteral(), left, right)
+	if !err.Ok() {
+		return result, err
+	}
+	return result, env.Budget().AllocateString(result)
+}
+
+func EvalInfixOperator(operator string, left object.Object, right object.Object) (object.Object, object.ErrorObj) {
 	leftInt, leftOk := left.(*object.IntegerObj)
 	rightInt, rightOk := right.(*object.IntegerObj)
 	if leftOk && rightOk {
-		switch node.TokenLiteral() {
+		switch operator {
 		case "+":
 			return &object.IntegerObj{Value: leftInt.Value + rightInt.Value}, object.EmptyErrorObj()
 		case "-":
@@ -114,8 +360,14 @@ func evalInfix(node ast.InfixExpression, env Environment) (object.Object, object
 		case "*":
 			return &object.IntegerObj{Value: leftInt.Value * rightInt.Value}, object.EmptyErrorObj()
 		case "/":
+			if rightInt.Value == 0 {
+				return &object.NullObj{}, object.NewErrorObj("division by zero")
+			}
 			return &object.IntegerObj{Value: leftInt.Value / rightInt.Value}, object.EmptyErrorObj()
 		case "%":
+			if rightInt.Value == 0 {
+				return &object.NullObj{}, object.NewErrorObj("division by zero")
+			}
 			return &object.IntegerObj{Value: leftInt.Value % rightInt.Value}, object.EmptyErrorObj()
 		case "<":
 			return &object.BooleanObj{Value: leftInt.Value < rightInt.Value}, object.EmptyErrorObj()
@@ -134,14 +386,21 @@ func evalInfix(node ast.InfixExpression, env Environment) (object.Object, object
 		case "|":
 			return &object.IntegerObj{Value: leftInt.Value | rightInt.Value}, object.EmptyErrorObj()
 		default:
-			return &object.NullObj{}, object.NewErrorObj("unknown int infix operator: " + node.TokenLiteral())
+			return &object.NullObj{}, object.NewErrorObj("unknown int infix operator: " + operator)
 		}
 	}
 
+	// an int mixed with a float is promoted to float
+	leftFloat, leftOk := toFloat(left)
+	rightFloat, rightOk := toFloat(right)
+	if leftOk && rightOk {
+		return evalFloatInfixOperator(operator, leftFloat, rightFloat)
+	}
+
 	leftBool, leftOk := left.(*object.BooleanObj)
 	rightBool, rightOk := right.(*object.BooleanObj)
 	if leftOk && rightOk {
-		switch node.TokenLiteral() {
+		switch operator {
 		case "==":
 			return &object.BooleanObj{Value: leftBool.Value == rightBool.Value}, object.EmptyErrorObj()
 		case "!=":
@@ -151,14 +410,14 @@ func evalInfix(node ast.InfixExpression, env Environment) (object.Object, object
 		case "||":
 			return &object.BooleanObj{Value: leftBool.Value || rightBool.Value}, object.EmptyErrorObj()
 		default:
-			return &object.NullObj{}, object.NewErrorObj("unknown bool infix operator: " + node.TokenLiteral())
+			return &object.NullObj{}, object.NewErrorObj("unknown bool infix operator: " + operator)
 		}
 	}
 
 	leftStr, leftOk := left.(*object.StringObj)
 	rightStr, rightOk := right.(*object.StringObj)
 	if leftOk && rightOk {
-		switch node.TokenLiteral() {
+		switch operator {
 		case "==":
 			return &object.BooleanObj{Value: leftStr.Value == rightStr.Value}, object.EmptyErrorObj()
 		case "!=":
@@ -166,19 +425,64 @@ func evalInfix(node ast.InfixExpression, env Environment) (object.Object, object
 		case "+":
 			return &object.StringObj{Value: leftStr.Value + rightStr.Value}, object.EmptyErrorObj()
 		default:
-			return &object.NullObj{}, object.NewErrorObj("unknown string infix operator: " + node.TokenLiteral())
+			return &object.NullObj{}, object.NewErrorObj("unknown string infix operator: " + operator)
 		}
 	}
 
 	lts := string(left.Type())
 	rts := string(right.Type())
 	return &object.NullObj{}, object.NewErrorObj("unknown infix expression types: " +
-		node.TokenLiteral() + " between " + lts + " and " + rts)
+		operator + " between " + lts + " and " + rts)
 }
 
-func evalIf(node ast.IfExpression, env Environment) (object.Object, object.ErrorObj) {
-	tempEnv := NewEnclosedEnvironment(env)
+func evalFloatInfixOperator(operator string, left float64, right float64) (object.Object, object.ErrorObj) {
+	switch operator {
+	case "+":
+		return &object.FloatObj{Value: left + right}, object.EmptyErrorObj()
+	case "-":
+		return &object.FloatObj{Value: left - right}, object.EmptyErrorObj()
+	case "*":
+		return &object.FloatObj{Value: left * right}, object.EmptyErrorObj()
+	case "/":
+		if right == 0 {
+			return &object.NullObj{}, object.NewErrorObj("division by zero")
+		}
+		return &object.FloatObj{Value: left / right}, object.EmptyErrorObj()
+	case "%":
+		// same as ints, the result takes the sign of the left operand
+		if right == 0 {
+			return &object.NullObj{}, object.NewErrorObj("division by zero")
+		}
+		return &object.FloatObj{Value: math.Mod(left, right)}, object.EmptyErrorObj()
+	case "<":
+		return &object.BooleanObj{Value: left < right}, object.EmptyErrorObj()
+	case "<=":
+		return &object.BooleanObj{Value: left <= right}, object.EmptyErrorObj()
+	case ">":
+		return &object.BooleanObj{Value: left > right}, object.EmptyErrorObj()
+	case ">=":
+		return &object.BooleanObj{Value: left >= right}, object.EmptyErrorObj()
+	case "==":
+		return &object.BooleanObj{Value: left == right}, object.EmptyErrorObj()
+	case "!=":
+		return &object.BooleanObj{Value: left != right}, object.EmptyErrorObj()
+	default:
+		return &object.NullObj{}, object.NewErrorObj("unknown float infix operator: " + operator)
+	}
+}
+
+// toFloat reads ints and floats as a float64
+func toFloat(obj object.Object) (float64, bool) {
+	switch num := obj.(type) {
+	case *object.IntegerObj:
+		return float64(num.Value), true
+	case *object.FloatObj:
+		return num.Value, true
+	}
+	return 0, false
+}
 
+func evalIf(node ast.IfExpression, env Environment) (object.Object, object.ErrorObj) {
 	// looping over the conditions, return the block of the first condition that evaluates to true
 	for i, condition := range node.Conditions {
 		cond, err := EvalExpression(condition, env)
@@ -187,7 +491,7 @@ func evalIf(node ast.IfExpression, env Environment) (object.Object, object.Error
 		}
 
 		if boolCond, ok := cond.(*object.BooleanObj); ok && boolCond.Value {
-			body, err := EvalStatement(node.Blocks[i], tempEnv)
+			body, err := EvalStatement(node.Blocks[i], NewEnclosedEnvironment(env, node.Blocks[i].Slots))
 			if !err.Ok() {
 				return object.NullObj{}, object.NewErrorObj("failed to evaluate if block", err)
 			}
@@ -197,7 +501,8 @@ func evalIf(node ast.IfExpression, env Environment) (object.Object, object.Error
 
 	// the else condition
 	if len(node.Blocks) > len(node.Conditions) {
-		body, err := EvalStatement(node.Blocks[len(node.Blocks)-1], tempEnv)
+		elseBlock := node.Blocks[len(node.Blocks)-1]
+		body, err := EvalStatement(elseBlock, NewEnclosedEnvironment(env, elseBlock.Slots))
 		if !err.Ok() {
 			return object.NullObj{}, object.NewErrorObj("failed to evaluate else block", err)
 		}
@@ -208,73 +513,195 @@ func evalIf(node ast.IfExpression, env Environment) (object.Object, object.Error
 }
 
 func evalIdentifier(node ast.IdentifierExpression, env Environment) (object.Object, object.ErrorObj) {
-	// check if the identifier is a variable in the environment
-	if obj := env.Get(node.TokenLiteral()); obj != nil {
-		return obj, object.EmptyErrorObj()
+	if builtin := env.builtin(node.Binding); builtin != nil {
+		return builtin, object.EmptyErrorObj()
+	}
+
+	// a variable used before it is declared is still empty
+	if slot := env.variable(node.Binding); slot != nil && *slot != nil {
+		return *slot, object.EmptyErrorObj()
 	}
 
 	return &object.NullObj{}, object.NewErrorObj("unknown identifier: " + node.TokenLiteral())
 }
 
-func evalFunction(node ast.FunctionExpression) (object.Object, object.ErrorObj) {
+func evalFunction(node ast.FunctionExpression, env Environment) (object.Object, object.ErrorObj) {
 	args := []string{}
+	slots := []int{}
 	for _, arg := range node.Args {
 		args = append(args, arg.TokenLiteral())
+		slots = append(slots, arg.Binding.Slot)
 	}
 
+	// the function closes over the scope it's defined in, not the one it's called from
 	return object.FunctionObj{
 		Parameters: args,
+		ParamSlots: slots,
 		Body:       node.Body,
+		Env:        &env,
 	}, object.EmptyErrorObj()
 }
 
 func evalCall(node ast.CallExpression, env Environment) (object.Object, object.ErrorObj) {
-	obj := env.Get(node.Identifier.TokenLiteral())
-	if obj == nil {
-		return &object.NullObj{}, object.NewErrorObj("unknown function: " + node.Identifier.TokenLiteral())
+	obj, args, err := evalCallOperands(node, env)
+	if !err.Ok() {
+		return &object.NullObj{}, err
 	}
+	return callObject(node, obj, args, env)
+}
 
+// callObject calls the result of evaluating node.Function with already evaluated arguments
+func callObject(node ast.CallExpression, obj object.Object, args []object.Object, env Environment) (object.Object, object.ErrorObj) {
 	switch funcObj := obj.(type) {
 	case object.FunctionObj:
-		funcEnv := NewEnclosedEnvironment(env)
+		return applyFunction(funcObj, args, env, node.Function.Pos())
+	case *Builtin:
+		if err := env.Budget().Step(); !err.Ok() {
+			return &object.NullObj{}, err
+		}
+		defer env.pushFrame(node.Function.String(), node.Function.Pos())()
+		return funcObj.Fn(env, args...)
+	default:
+		return &object.NullObj{}, object.NewErrorObj("not a function: " + string(obj.Type()))
+	}
+}
 
+// evalCallOperands evaluates the function being called and then its arguments, left to right
+func evalCallOperands(node ast.CallExpression, env Environment) (object.Object, []object.Object, object.ErrorObj) {
+	obj, err := EvalExpression(node.Function, env)
+	if !err.Ok() {
+		return nil, nil, object.NewErrorObj("failed to evaluate function '"+node.Function.String()+"'", err)
+	}
+
+	kind := "function"
+	switch funcObj := obj.(type) {
+	case object.FunctionObj:
 		if len(node.Args) != len(funcObj.Parameters) {
-			return &object.NullObj{}, object.NewErrorObj(
+			return nil, nil, object.NewErrorObj(
 				"wrong number of arguments: expected " + strconv.Itoa(len(funcObj.Parameters)) +
 					", got " + strconv.Itoa(len(node.Args)),
 			)
 		}
+	case *Builtin:
+		kind = "builtin function"
+	default:
+		return nil, nil, object.NewErrorObj("not a function: " + string(obj.Type()))
+	}
 
-		for i, arg := range node.Args {
-			exp, err := EvalExpression(arg, env)
-			if !err.Ok() {
-				return &object.NullObj{}, object.NewErrorObj(
-					"failed to evaluate argument for function '"+node.Identifier.TokenLiteral()+"'", err,
-				)
-			}
+	args := []object.Object{}
+	for _, arg := range node.Args {
+		val, err := EvalExpression(arg, env)
+		if !err.Ok() {
+			return nil, nil, object.NewErrorObj(
+				"failed to evaluate argument for "+kind+" '"+node.Function.String()+"'", err,
+			)
+		}
+
+		args = append(args, val)
+	}
+
+	return obj, args, object.EmptyErrorObj()
+}
+
+// tailCall is what returning a call to a user function evaluates to inside a function body,
+// applyFunction makes the call in place of the returning one so tail recursion runs in constant space
+type tailCall struct {
+	fn       object.FunctionObj
+	args     []object.Object
+	callSite token.Position
+}
 
-			funcEnv.Create(funcObj.Parameters[i], exp)
+func (t *tailCall) Type() object.ObjectType { return object.TAIL_CALL_OBJ }
+func (t *tailCall) Inspect() string         { return "tail call" }
+
+// applyFunction calls a user function with already evaluated arguments,
+// the body runs in a new scope enclosed by the scope the function was defined in.
+// env is the scope of the caller, the call is on its stack while the body runs.
+// A call the body returns is made here, replacing the frame of the returning call
+func applyFunction(fn object.FunctionObj, args []object.Object, env Environment, callSite token.Position) (object.Object, object.ErrorObj) {
+	for {
+		val, err := applyFunctionOnce(fn, args, env, callSite)
+		call, ok := val.(*tailCall)
+		if !ok || !err.Ok() {
+			return val, err
 		}
+		fn, args, callSite = call.fn, call.args, call.callSite
+	}
+}
 
-		return EvalStatement(funcObj.Body, funcEnv)
-	case *Builtin:
-		args := []object.Object{}
-		for _, arg := range node.Args {
-			val, err := EvalExpression(arg, env)
-			if !err.Ok() {
-				return &object.NullObj{}, object.NewErrorObj(
-					"failed to evaluate argument for builtin function '"+node.Identifier.TokenLiteral()+"'", err,
-				)
-			}
+// applyFunctionOnce runs the body of fn, a returned call is left to applyFunction
+func applyFunctionOnce(fn object.FunctionObj, args []object.Object, env Environment, callSite token.Position) (object.Object, object.ErrorObj) {
+	if len(args) != len(fn.Parameters) {
+		return &object.NullObj{}, object.NewErrorObj(
+			"wrong number of arguments: expected " + strconv.Itoa(len(fn.Parameters)) +
+				", got " + strconv.Itoa(len(args)),
+		)
+	}
+
+	defEnv, ok := fn.Env.(*Environment)
+	if !ok {
+		return &object.NullObj{}, object.NewErrorObj("function has no defining environment")
+	}
+
+	// raised before the call is made, so the stack shows the calls that led to it
+	if env.callDepthExceeded() {
+		err := object.NewErrorObj("maximum recursion depth exceeded")
+		err.Kind = object.RECURSION_ERROR
+		err.Pos = callSite
+		err.Stack = env.CallStack()
+		return &object.NullObj{}, err
+	}
+	if err := env.Budget().Step(); !err.Ok() {
+		err.Pos = callSite
+		err.Stack = env.CallStack()
+		return &object.NullObj{}, err
+	}
 
-			args = append(args, val)
+	name := fn.Name
+	if name == "" {
+		name = "<anonymous>"
+	}
+	defer env.pushFrame(name, callSite)()
+
+	funcEnv := NewEnclosedEnvironment(*defEnv, fn.Body.Slots)
+	funcEnv.state = env.state
+	funcEnv.tailCalls = true
+	for i, param := range fn.Parameters {
+		slot := &funcEnv.vars[fn.ParamSlots[i]]
+		if *slot != nil {
+			err := object.NewErrorObj("duplicate parameter: " + param)
+			err.Stack = env.CallStack()
+			return &object.NullObj{}, err
 		}
+		*slot = args[i]
+	}
 
-		return funcObj.Fn(env, args...)
-	default:
-		return &object.NullObj{}, object.NewErrorObj("unknown function type (what the shit?)")
+	val, err := evalFunctionBody(fn.Body, funcEnv)
+
+	// the innermost call an error leaves is the first to see it, the whole stack is still there.
+	// Outer calls keep the stack on top of the chain, so they find it without walking the whole chain
+	if !err.Ok() {
+		err.Stack = err.CallStack()
+		if err.Stack == nil {
+			err.Stack = env.CallStack()
+		}
+	}
+	return val, err
+}
+
+// evalFunctionBody runs the body of a user function, a return ends the call with its value.
+// break and continue never leave a function, the resolver rejects them outside of a loop
+func evalFunctionBody(body ast.BlockStatement, env Environment) (object.Object, object.ErrorObj) {
+	val, err := EvalStatement(body, env)
+	if !err.Ok() {
+		return object.NullObj{}, err
+	}
+
+	if returned, ok := val.(*object.ReturnObj); ok {
+		return returned.Value, object.EmptyErrorObj()
 	}
 
+	return val, object.EmptyErrorObj()
 }
 
 func evalArray(node ast.ArrayExpression, env Environment) (object.Object, object.ErrorObj) {
@@ -287,6 +714,9 @@ func evalArray(node ast.ArrayExpression, env Environment) (object.Object, object
 		elems = append(elems, obj)
 	}
 
+	if err := env.Budget().Allocate(len(elems)); !err.Ok() {
+		return &object.NullObj{}, err
+	}
 	return &object.ArrayObj{Elements: elems}, object.EmptyErrorObj()
 }
 
@@ -301,22 +731,29 @@ func evalIndex(node ast.IndexExpression, env Environment) (object.Object, object
 		return &object.NullObj{}, object.NewErrorObj("failed to evaluate container index", err)
 	}
 
+	return EvalIndexOperator(exp, index)
+}
+
+// EvalIndexOperator reads the element of a container at index
+func EvalIndexOperator(exp object.Object, index object.Object) (object.Object, object.ErrorObj) {
 	switch indexObj := index.(type) {
 	case *object.IntegerObj:
 		return evalIntegerIndex(exp, indexObj)
 	case *object.BooleanObj:
 		return evalBoolIndex(exp, indexObj)
+	case *object.FloatObj:
+		return evalFloatIndex(exp, indexObj)
 	case *object.StringObj:
 		return evalStringIndex(exp, indexObj)
 	default:
-		panic("unsupported index data type")
+		return &object.NullObj{}, object.NewErrorObj("unsupported index data type: " + string(index.Type()))
 	}
 }
 
 func evalIntegerIndex(exp object.Object, index *object.IntegerObj) (object.Object, object.ErrorObj) {
 	switch expObj := exp.(type) {
 	case *object.ArrayObj:
-		if index.Value >= int64(len(expObj.Elements)) {
+		if index.Value < 0 || index.Value >= int64(len(expObj.Elements)) {
 			return &object.NullObj{}, object.NewErrorObj(
 				"index out of bounds, attempted to access " + index.Inspect() +
 					" in array of length " + strconv.Itoa(len(expObj.Elements)),
@@ -324,13 +761,15 @@ func evalIntegerIndex(exp object.Object, index *object.IntegerObj) (object.Objec
 		}
 		return expObj.Elements[index.Value], object.EmptyErrorObj()
 	case *object.StringObj:
-		if index.Value >= int64(len(expObj.Value)) {
+		// strings are indexed by character, not by byte
+		runes := []rune(expObj.Value)
+		if index.Value < 0 || index.Value >= int64(len(runes)) {
 			return &object.NullObj{}, object.NewErrorObj(
 				"index out of bounds, attempted to access " + index.Inspect() +
-					" in a string of length " + strconv.Itoa(len(expObj.Value)),
+					" in a string of length " + strconv.Itoa(len(runes)),
 			)
 		}
-		return &object.StringObj{Value: string(expObj.Value[index.Value])}, object.EmptyErrorObj()
+		return &object.StringObj{Value: string(runes[index.Value])}, object.EmptyErrorObj()
 	case *object.HashObj:
 		if pair, ok := expObj.Pairs[index.HashKey()]; ok {
 			return pair.Value, object.EmptyErrorObj()
@@ -354,8 +793,26 @@ func evalBoolIndex(exp object.Object, index *object.BooleanObj) (object.Object,
 	}
 }
 
+// evalFloatIndex only looks up hashes, floats are keys there but never positions
+func evalFloatIndex(exp object.Object, index *object.FloatObj) (object.Object, object.ErrorObj) {
+	switch expObj := exp.(type) {
+	case *object.HashObj:
+		if pair, ok := expObj.Pairs[index.HashKey()]; ok {
+			return pair.Value, object.EmptyErrorObj()
+		}
+		return &object.NullObj{}, object.NewErrorObj("key " + index.Inspect() + " not found in hash")
+	default:
+		return &object.NullObj{}, object.NewErrorObj("unindexable data type using float: " + string(exp.Type()))
+	}
+}
+
 func evalStringIndex(exp object.Object, index *object.StringObj) (object.Object, object.ErrorObj) {
 	switch expObj := exp.(type) {
+	case *object.ErrorValueObj:
+		if field, ok := expObj.Field(index.Value); ok {
+			return field, object.EmptyErrorObj()
+		}
+		return &object.NullObj{}, object.NewErrorObj("errors have no field '" + index.Value + "'")
 	case *object.HashObj:
 		if pair, ok := expObj.Pairs[index.HashKey()]; ok {
 			return pair.Value, object.EmptyErrorObj()
@@ -376,7 +833,7 @@ func evalHash(node ast.HashExpression, env Environment) (object.Object, object.E
 
 		hashKey, ok := key.(object.Hashable)
 		if !ok {
-			panic("unhashable key type")
+			return &object.NullObj{}, object.NewErrorObj("unhashable key type: " + string(key.Type()))
 		}
 
 		value, err := EvalExpression(kvp.Value, env)
@@ -387,5 +844,8 @@ func evalHash(node ast.HashExpression, env Environment) (object.Object, object.E
 		elems[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
 	}
 
+	if err := env.Budget().Allocate(len(node.Elems)); !err.Ok() {
+		return &object.NullObj{}, err
+	}
 	return &object.HashObj{Pairs: elems}, object.EmptyErrorObj()
 }
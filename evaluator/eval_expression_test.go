@@ -1,11 +1,15 @@
-package evaluator
+package evaluator_test
 
 import (
+	"context"
+	"main/evaluator"
 	"main/object"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
-	"main/lexer"
-	"main/parser"
+	"main/token"
 )
 
 func TestEvalIntegerExpression(t *testing.T) {
@@ -15,6 +19,14 @@ func TestEvalIntegerExpression(t *testing.T) {
 	}{
 		{"5", 5},
 		{"10", 10},
+		{"0xFF", 255},
+		{"0Xff", 255},
+		{"0o755", 493},
+		{"0b1010", 10},
+		{"1_000_000", 1000000},
+		{"0x_FF_FF", 65535},
+		{"0", 0},
+		{"0b11 + 0o7", 10},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input, t)
@@ -22,6 +34,104 @@ func TestEvalIntegerExpression(t *testing.T) {
 	}
 }
 
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14", 3.14},
+		{"1e-9", 1e-9},
+		{"1_000.5", 1000.5},
+		{"-2.5", -2.5},
+		{"1.5 + 1.5", 3},
+		{"1 + 0.5", 1.5},
+		{"0.5 + 1", 1.5},
+		{"10 / 4.0", 2.5},
+		{"7.5 % 2", 1.5},
+		{"-7.5 % 2", -1.5},
+		{"2 * 1.5 - 1", 2},
+		{"let x = 1; x += 0.5; x", 1.5},
+		{"let x = 1.5; x++; x", 2.5},
+		{"float(7) / 2", 3.5},
+		{"float(\"2.25\")", 2.25},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input, t)
+		testFloatObject(t, evaluated, tt.expected)
+	}
+
+	intTests := []struct {
+		input    string
+		expected int64
+	}{
+		{"7 / 2", 3},
+		{"floor(2.7)", 2},
+		{"floor(-2.5)", -3},
+		{"ceil(2.1)", 3},
+		{"round(2.5)", 3},
+		{"round(2.4)", 2},
+		{"round(-2.5)", -3},
+		{"floor(4)", 4},
+		{"int(2.9)", 2},
+		{"int(-2.9)", -2},
+		{"int(\"42\")", 42},
+		{"let total = 10; let count = 4; round(float(total) / count * 10)", 25},
+	}
+	for _, tt := range intTests {
+		evaluated := testEval(tt.input, t)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+
+	boolTests := []struct {
+		input    string
+		expected bool
+	}{
+		{"1 == 1.0", true},
+		{"1.5 > 1", true},
+		{"2 <= 1.5", false},
+		{"0.1 + 0.2 != 0.3", true},
+		{"1.0 != 2", true},
+	}
+	for _, tt := range boolTests {
+		evaluated := testEval(tt.input, t)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 / 0", "division by zero"},
+		{"1 % 0", "division by zero"},
+		{"1.5 / 0", "division by zero"},
+		{"1.5 & 1", "unknown float infix operator: &"},
+		{"int(\"x\")", "int() could not parse"},
+	}
+	for _, tt := range errTests {
+		err := testEvalError(tt.input, t)
+		if !strings.Contains(err.Inspect(), tt.expected) {
+			t.Errorf("wrong error for %q. expected to contain %q, got=%q", tt.input, tt.expected, err.Inspect())
+		}
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{3, "3.0"},
+		{2.5, "2.5"},
+		{-0.25, "-0.25"},
+		{1e21, "1e+21"},
+	}
+	for _, tt := range tests {
+		if actual := (&object.FloatObj{Value: tt.value}).Inspect(); actual != tt.expected {
+			t.Errorf("wrong inspect for %v. expected %q, got=%q", tt.value, tt.expected, actual)
+		}
+	}
+}
+
 func TestEvalBooleanExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -204,7 +314,70 @@ func TestFunctionApplication(t *testing.T) {
 		{"let double = fn(x) { x * 2; }; double(5);", 10},
 		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
 		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
-		// {"fn(x) { x; }(5)", 5},
+		{"fn(x) { x; }(5)", 5},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input, t)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestCallExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let make_adder = fn(x) { fn(y) { x + y } }; make_adder(2)(3)", 5},
+		{`let handlers = {"save": fn(doc) { doc * 2 }}; handlers["save"](21)`, 42},
+		{"[fn(x) { x + 1 }][0](1)", 2},
+		{"fn() { fn() { 3 } }()()", 3},
+		{"let apply = fn(f, x) { f(x) }; apply(fn(x) { x * x }, 4)", 16},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input, t)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 5; x()", "not a function: INT_OBJ"},
+		{"missing(1)", "unknown identifier: missing"},
+		{"fn(x) { x }(1, 2)", "wrong number of arguments: expected 1, got 2"},
+	}
+	for _, tt := range errTests {
+		err := testEvalError(tt.input, t)
+		if !strings.Contains(err.Inspect(), tt.expected) {
+			t.Errorf("wrong error for %q. expected to contain %q, got=%q", tt.input, tt.expected, err.Inspect())
+		}
+	}
+}
+
+func TestClosures(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		// adders
+		{"let adder = fn(x) { fn(y) { x + y } }; let add2 = adder(2); add2(3)", 5},
+		{"let adder = fn(x) { fn(y) { x + y } }; let add2 = adder(2); let add5 = adder(5); add2(1) + add5(1)", 9},
+
+		// counters keep their own state
+		{"let counter = fn() { let n = 0; fn() { n += 1; n } }; let c = counter(); c(); c(); c()", 3},
+		{"let counter = fn() { let n = 0; fn() { n += 1; n } }; let a = counter(); let b = counter(); a(); a(); b()", 1},
+
+		// recursive inner functions
+		{"let outer = fn() { let fact = fn(n) { if (n <= 1) { 1 } else { n * fact(n - 1) } }; fact(5) }; outer()", 120},
+		{"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(10)", 55},
+
+		// lexical, not dynamic, scope
+		{"let x = 1; let f = fn() { x }; let g = fn(x) { f() }; g(2)", 1},
+		{"let make = fn(x) { fn() { x } }; let f = make(7); let g = fn(x) { f() }; g(1)", 7},
+
+		// closures passed to builtins
+		{"let scale = fn(k) { fn(arr) { map(arr, fn(x) { x * k }) } }; let triple = scale(3); triple([1, 2])[1]", 6},
+		{"let total = fn(arr, base) { reduce(arr, 0, fn(acc, x) { acc + x + base }) }; total([1, 2, 3], 1)", 9},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input, t)
@@ -212,6 +385,291 @@ func TestFunctionApplication(t *testing.T) {
 	}
 }
 
+func TestCallStack(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []object.Frame
+	}{
+		// raised at the top level
+		{"1 / 0", nil},
+
+		// named after the variable the function is bound to
+		{"let f = fn() { 1 / 0 }; f()", []object.Frame{frame("f", 1, 25)}},
+		{"const f = fn() { 1 / 0 }\nlet g = f\ng()", []object.Frame{frame("f", 3, 1)}},
+		{"let f = fn() { 1 / 0 }\nlet g = fn() { f() }\ng()", []object.Frame{frame("g", 3, 1), frame("f", 2, 16)}},
+
+		// unnamed functions
+		{"fn() { 1 / 0 }()", []object.Frame{frame("<anonymous>", 1, 1)}},
+		{"let make = fn() { fn() { 1 / 0 } }; make()()", []object.Frame{frame("<anonymous>", 1, 41)}},
+
+		// recursion keeps a frame per call
+		{"let f = fn(n) { if (n == 0) { 1 / 0 } else { f(n - 1) } }; f(2)", []object.Frame{
+			frame("f", 1, 60), frame("f", 1, 46), frame("f", 1, 46),
+		}},
+
+		// a returned call replaces the frame of the returning one
+		{"let g = fn() { 1 / 0 }\nlet f = fn() { return g() }\nf()", []object.Frame{frame("g", 2, 23)}},
+		{"let g = fn() { 1 / 0 }\nlet f = fn() { return 1 + g() }\nf()", []object.Frame{frame("f", 3, 1), frame("g", 2, 27)}},
+
+		// builtins calling functions
+		{"filter([1], fn(x) { x / 0 })", []object.Frame{frame("filter", 1, 1), frame("<anonymous>", 1, 1)}},
+
+		// a caught error raised again keeps the stack it was raised in
+		{"let e = fn() { try { error(\"x\") } catch (e) { e } }(); error(e)", []object.Frame{frame("<anonymous>", 1, 9)}},
+		{"let f = fn() { try { error(\"x\") } catch (e) { error(e) } }; f()", []object.Frame{frame("f", 1, 61)}},
+
+		// the stack stays with the error when more context is added on the way out
+		{"let f = fn() { let x = [1][5] }; let g = fn() { let y = f() }; g()", []object.Frame{
+			frame("g", 1, 64), frame("f", 1, 57),
+		}},
+	}
+
+	for _, tt := range tests {
+		err := testEvalError(tt.input, t)
+		stack := err.CallStack()
+		if len(stack) != len(tt.expected) {
+			t.Errorf("%q: expected a stack of %d frames, got=%v", tt.input, len(tt.expected), stack)
+			continue
+		}
+		for i, frame := range stack {
+			if frame != tt.expected[i] {
+				t.Errorf("%q: frame %d: expected=%v, got=%v", tt.input, i, tt.expected[i], frame)
+			}
+		}
+	}
+}
+
+func TestCallStackUnwinds(t *testing.T) {
+	for _, engine := range engines {
+		session := engine.newSession(evaluator.DefaultMaxCallDepth, evaluator.Prelude())
+		for _, input := range []string{
+			"let f = fn() { 1 / 0 }",
+			"f()",
+			"try { f() } catch (e) { e }",
+			"map([1, 2], fn(x) { x })",
+		} {
+			session.run(parse(input, t))
+			if stack := session.callStack(); len(stack) != 0 {
+				t.Fatalf("%s: %q: expected an empty stack, got=%v", engine.name, input, stack)
+			}
+		}
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// deeper than the limit, but every call is in return position
+		{"let count = fn(n, acc) { if (n == 0) { return acc } return count(n - 1, acc + 1) }; count(1000, 0)", 1000},
+		{"let even = fn(n) { if (n == 0) { return true } return odd(n - 1) }; let odd = fn(n) { if (n == 0) { return false } return even(n - 1) }; even(1001)", false},
+		{"let loop = fn(n) { for (x in [1]) { if (n > 0) { return loop(n - 1) } } n }; loop(500)", 0},
+		{"let down = fn(n) { let r = if (n > 0) { return down(n - 1) } else { n }; r }; down(500)", 0},
+		{"let step = fn(xs, n) { if (n == 0) { return len(xs) } return step(push(xs, n), n - 1) }; step([], 500)", 500},
+
+		// a returned builtin call is made once
+		{"let a = []; let f = fn() { return push(a, 1) }; f(); len(a)", 1},
+		{"let f = fn(x) { return len(x) }; f([1, 2])", 2},
+
+		// a returned call in try is made before leaving it, so its errors are caught
+		{`let fail = fn() { 1 / 0 }; let f = fn() { try { return fail() } catch (e) { return "caught" } }; f()`, "caught"},
+		{`let fail = fn() { 1 / 0 }; let f = fn() { try { fail() } catch (e) { return fail() } }; try { f() } catch (e) { e["message"] }`, "division by zero"},
+		{`let fail = fn() { 1 / 0 }; let f = fn() { try { let g = fn() { return fail() }; return g() } catch (e) { "caught" } }; f()`, "caught"},
+	}
+	for _, tt := range tests {
+		evaluated := testEvalWithDepth(tt.input, 100, t)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			testStringObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestMaxCallDepth(t *testing.T) {
+	input := "let deep = fn(n) { if (n == 0) { return 0 } return 1 + deep(n - 1) }\n"
+	tests := []struct {
+		call     string
+		maxDepth int
+		expected interface{}
+	}{
+		{"deep(9)", 10, 9},
+		{"deep(10)", 10, "maximum recursion depth exceeded"},
+		{"deep(200)", 0, 200},
+		{"deep(DefaultMaxCallDepth - 1)", evaluator.DefaultMaxCallDepth, evaluator.DefaultMaxCallDepth - 1},
+
+		// builtins count, their calls are on the stack too
+		{"map([8], deep)[0]", 10, 8},
+		{"map([9], deep)[0]", 10, "maximum recursion depth exceeded"},
+
+		// catchable like any other error
+		{`try { deep(50) } catch (e) { e["kind"] }`, 10, "RecursionError"},
+		{`try { deep(50) } catch (e) { e["line"] }`, 10, 1},
+		{`try { deep(50) } catch (e) { 1 }; deep(5)`, 10, 5},
+	}
+	for _, tt := range tests {
+		call := strings.Replace(tt.call, "DefaultMaxCallDepth", strconv.Itoa(evaluator.DefaultMaxCallDepth), 1)
+		program := parse(input+call, t)
+
+		for _, engine := range engines {
+			session := engine.newSession(tt.maxDepth, evaluator.Prelude())
+			evaluated, err := session.run(program)
+			expected, isError := tt.expected.(string)
+			if !isError || strings.HasPrefix(tt.call, "try") {
+				if !err.Ok() {
+					t.Errorf("%s: %s: unexpected error: %s", engine.name, tt.call, err.Inspect())
+					continue
+				}
+				if isError {
+					testStringObject(t, evaluated, expected)
+				} else {
+					testIntegerObject(t, evaluated, int64(tt.expected.(int)))
+				}
+				continue
+			}
+
+			raised := err.Raised()
+			if raised.Kind != object.RECURSION_ERROR || raised.Message != expected {
+				t.Errorf("%s: %s: expected a RecursionError, got=%s", engine.name, tt.call, err.Inspect())
+			}
+			if len(err.CallStack()) != tt.maxDepth {
+				t.Errorf("%s: %s: expected a stack of %d frames, got %d", engine.name, tt.call, tt.maxDepth, len(err.CallStack()))
+			}
+			if stack := session.callStack(); len(stack) != 0 {
+				t.Errorf("%s: %s: expected the stack to unwind, got %d frames", engine.name, tt.call, len(stack))
+			}
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	steps := evaluator.Limits{Steps: 10}
+	elements := evaluator.Limits{Elements: 10}
+	tests := []struct {
+		input    string
+		limits   evaluator.Limits
+		expected interface{}
+	}{
+		{"let i = 0; for (i < 10) { i++ }; i", steps, 10},
+		{"let i = 0; for (true) { i++ }", steps, "step limit exceeded: more than 10 calls and loop iterations"},
+		{"for (x in [1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11]) { x }", steps, "step limit exceeded: more than 10 calls and loop iterations"},
+		{"let f = fn(n) { f(n + 1) }; f(0)", steps, "step limit exceeded: more than 10 calls and loop iterations"},
+		{"let f = fn(n) { return f(n + 1) }; f(0)", steps, "step limit exceeded: more than 10 calls and loop iterations"},
+		{"reduce([1, 2, 3, 4, 5, 6, 7, 8, 9, 10], 0, fn(a, b) { a + b })", steps, "step limit exceeded: more than 10 calls and loop iterations"},
+		{"reduce([1, 2, 3, 4, 5, 6, 7, 8, 9], 0, fn(a, b) { a + b })", steps, 45},
+
+		{"len([1, 2, 3, 4, 5, 6, 7, 8, 9, 10])", elements, 10},
+		{"[1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11]", elements, "allocation limit exceeded: more than 10 elements"},
+		{`{1: 1, 2: 2, 3: 3, 4: 4, 5: 5, 6: 6}; {7: 7, 8: 8, 9: 9, 10: 10, 11: 11}`, elements, "allocation limit exceeded: more than 10 elements"},
+		{`"hello" + "world!"`, elements, "allocation limit exceeded: more than 10 elements"},
+		{`let s = "hello"; s += "world!"`, elements, "allocation limit exceeded: more than 10 elements"},
+		{"let a = []; for (true) { push(a, 1) }", elements, "allocation limit exceeded: more than 10 elements"},
+		{"let h = {}; let i = 0; for (i < 11) { h[i] = i; i++ }", elements, "allocation limit exceeded: more than 10 elements"},
+		{"let h = {}; let i = 0; for (i < 10) { h[i] = i; h[i] += 1; i++ }; len(h)", elements, 10},
+		{"map([1, 2, 3, 4, 5, 6], fn(x) { x }); map([1, 2, 3, 4, 5], fn(x) { x })", elements, "allocation limit exceeded: more than 10 elements"},
+		{`len(bytes("hello world"))`, elements, "allocation limit exceeded: more than 10 elements"},
+
+		// catchable like any other error
+		{`try { for (true) { 1 } } catch (e) { e["kind"] }`, steps, "LimitError"},
+		{`try { "hello" + "world!" } catch (e) { e["message"] }`, elements, "allocation limit exceeded: more than 10 elements"},
+		// but the budget stays used up, the handler fails at its first step or allocation
+		{`let f = fn() { 1 }; try { for (true) { 1 } } catch (e) { f() }`, steps, "step limit exceeded: more than 10 calls and loop iterations"},
+		{`let n = 0; try { for (true) { 1 } } catch (e) { for (true) { n++ } }`, steps, "step limit exceeded: more than 10 calls and loop iterations"},
+		{`let s = ""; try { "hello" + "world!" } catch (e) { [1] }`, elements, "allocation limit exceeded: more than 10 elements"},
+	}
+	for _, tt := range tests {
+		program := parse(tt.input, t)
+
+		errs := []object.ErrorObj{}
+		for _, engine := range engines {
+			session := engine.newSession(evaluator.DefaultMaxCallDepth, evaluator.Prelude())
+			session.setLimits(tt.limits)
+			evaluated, err := session.run(program)
+
+			expected, isError := tt.expected.(string)
+			if !isError || strings.HasPrefix(tt.input, "try") {
+				if !err.Ok() {
+					t.Errorf("%s: %s: unexpected error: %s", engine.name, tt.input, err.Inspect())
+				} else if isError {
+					testStringObject(t, evaluated, expected)
+				} else {
+					testIntegerObject(t, evaluated, int64(tt.expected.(int)))
+				}
+				continue
+			}
+
+			raised := err.Raised()
+			if raised.Kind != object.LIMIT_ERROR || raised.Message != expected {
+				t.Errorf("%s: %s: expected a LimitError, got=%s", engine.name, tt.input, err.Inspect())
+			}
+			errs = append(errs, err)
+		}
+
+		for i := 1; i < len(errs); i++ {
+			if expected, got := describeError(errs[0]), describeError(errs[i]); got != expected {
+				t.Errorf("%q: %s fails with %s, but %s fails with %s", tt.input, engines[0].name, expected, engines[i].name, got)
+			}
+		}
+	}
+}
+
+// every run starts with the whole budget
+func TestLimitsPerRun(t *testing.T) {
+	program := parse("i = 0; for (i < 8) { i++ }; i", t)
+	for _, engine := range engines {
+		session := engine.newSession(evaluator.DefaultMaxCallDepth, evaluator.Prelude())
+		session.setLimits(evaluator.Limits{Steps: 10})
+		if _, err := session.run(parse("let i = 0", t)); !err.Ok() {
+			t.Fatalf("%s: unexpected error: %s", engine.name, err.Inspect())
+		}
+		for run := 0; run < 3; run++ {
+			evaluated, err := session.run(program)
+			if !err.Ok() {
+				t.Fatalf("%s: run %d: unexpected error: %s", engine.name, run, err.Inspect())
+			}
+			testIntegerObject(t, evaluated, 8)
+		}
+	}
+}
+
+func TestContext(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, engine := range engines {
+		session := engine.newSession(evaluator.DefaultMaxCallDepth, evaluator.Prelude())
+		session.setContext(cancelled)
+		_, err := session.run(parse("let f = fn() { 1 }; f()", t))
+		if raised := err.Raised(); raised.Kind != object.LIMIT_ERROR || raised.Message != "execution cancelled: context canceled" {
+			t.Errorf("%s: expected the run to be cancelled, got=%s", engine.name, err.Inspect())
+		}
+
+		// a program that never ends is stopped once the deadline passes
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		session.setContext(ctx)
+		_, err = session.run(parse("for (true) { 1 }", t))
+		cancel()
+		if raised := err.Raised(); raised.Kind != object.LIMIT_ERROR || raised.Message != "execution cancelled: context deadline exceeded" {
+			t.Errorf("%s: expected the run to time out, got=%s", engine.name, err.Inspect())
+		}
+
+		session.setContext(nil)
+		evaluated, err := session.run(parse("f()", t))
+		if !err.Ok() {
+			t.Fatalf("%s: unexpected error: %s", engine.name, err.Inspect())
+		}
+		testIntegerObject(t, evaluated, 1)
+	}
+}
+
+func frame(function string, line, column int) object.Frame {
+	return object.Frame{Function: function, CallSite: token.Position{Line: line, Column: column}}
+}
+
 func TestArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 	evaluated := testEval(input, t)
@@ -280,6 +738,25 @@ func TestArrayIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestStringIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"abc"[1]`, "b"},
+		{`"héllo"[1]`, "é"},
+		{`"héllo"[2]`, "l"},
+		{`"a😀b"[1]`, "😀"},
+		{`"a😀b"[2]`, "b"},
+		{`"中文字"[2]`, "字"},
+		{`let 名前 = "山田"; 名前[0]`, "山"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input, t)
+		testStringObject(t, evaluated, tt.expected)
+	}
+}
+
 func TestHashLiterals(t *testing.T) {
 	input := `let two = "two";
 	{
@@ -341,6 +818,14 @@ func TestHashIndexExpressions(t *testing.T) {
 			`{false: 5}[false]`,
 			5,
 		},
+		{
+			`{1.0: 5}[1.0]`,
+			5,
+		},
+		{
+			`let h = {}; h[1.5] = 5; h[1.5]`,
+			5,
+		},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input, t)
@@ -353,6 +838,154 @@ func TestHashIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let x = 1; x = 5; x", 5},
+		{"let x = 1; x = 5", 5},
+		{"let x = 1; x += 4; x", 5},
+		{"let x = 10; x -= 4; x", 6},
+		{"let x = 1; let y = 2; x = y = 7; x + y", 14},
+		{"let x = 1; x++; x", 2},
+		{"let x = 1; x++", 1},
+		{"let x = 1; x--; x", 0},
+		{"let x = 1; ++x", 2},
+		{"let x = 1; --x; x", 0},
+		{"let arr = [1, 2, 3]; arr[0] = 10; arr[0]", 10},
+		{"let arr = [1, 2, 3]; arr[1] += 10; arr[1]", 12},
+		{"let arr = [1, 2, 3]; arr[2]++; arr[2]", 4},
+		{`let h = {"k": 1}; h["k"] += 2; h["k"]`, 3},
+		{`let h = {}; h["new"] = 4; h["new"]`, 4},
+		{"let x = 1; let f = fn() { x = 3; }; f(); x", 3},
+		{"let x = 1; if (true) { x = 2; }; x", 2},
+		{"let i = 0; let n = 0; for (i < 4) { n += i; i++; }; n", 6},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input, t)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestAssignDoesNotAlias(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = 1; let b = a; ++a; b", 1},
+		{"let a = 1; let b = a; a++; b", 1},
+		{"let a = 1; let b = a; a += 1; b", 1},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input, t)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+// integers, floats, booleans and strings are immutable, no operator may change
+// a value another variable holds
+func TestOperatorsDoNotAlias(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// prefix
+		{"let a = 5; -a; a", 5},
+		{"let a = 5; let b = -a; -b; a", 5},
+		{"let a = 5; let b = a; -a; b", 5},
+		{"let a = 1.5; -a; a", 1.5},
+		{"let a = true; !a; a", true},
+		{"let a = true; let b = a; !a; b", true},
+		{"let a = false; !!a; a", false},
+		{"let a = 5; ++a; -a; a", 6},
+
+		// step and compound assignment
+		{"let a = 1; let b = a; --a; b", 1},
+		{"let a = 1; let b = a; a--; b", 1},
+		{"let a = 1; let b = a; a -= 1; b", 1},
+		{"let a = 1.5; let b = a; a++; b", 1.5},
+		{`let a = "x"; let b = a; a += "y"; b`, "x"},
+
+		// infix
+		{"let a = 2; let b = 3; a + b; a - b; a * b; a / b; a % b; a", 2},
+		{"let a = 2; let b = 3; a + b; a - b; a * b; a / b; a % b; b", 3},
+		{"let a = 2.5; let b = 0.5; a + b; a - b; a * b; a / b; a", 2.5},
+		{"let a = 2; let b = 3; a == b; a != b; a < b; a > b; a <= b; a >= b; a", 2},
+		{"let a = true; let b = false; a && b; a || b; a == b; a != b; a", true},
+		{"let a = true; let b = false; a && b; a || b; a == b; a != b; b", false},
+		{`let a = "x"; let b = "y"; a + b; a == b; a`, "x"},
+
+		// values put into arrays and hashes are not changed through them
+		{"let a = 5; let arr = [a]; arr[0] += 1; a", 5},
+		{"let a = 5; let arr = [a]; -arr[0]; arr[0]", 5},
+		{"let a = true; let h = {1: a}; !h[1]; h[1]", true},
+		{"let a = 5; let h = {1: a}; h[1]++; a", 5},
+
+		// arguments
+		{"let neg = fn(x) { -x }; let a = 5; neg(a); a", 5},
+		{"let inc = fn(x) { x += 1 }; let a = 5; inc(a); a", 5},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input, t)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			testStringObject(t, evaluated, expected)
+		}
+	}
+}
+
+// arrays and hashes are reference types, changes are seen through every variable holding them
+func TestReferenceTypesAlias(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = [1, 2]; let b = a; b[0] = 5; a[0]", 5},
+		{"let a = [1, 2]; let b = a; b[1] += 5; a[1]", 7},
+		{"let a = [1, 2]; let b = a; b[0]++; a[0]", 2},
+		{"let a = {1: 1}; let b = a; b[1] = 5; a[1]", 5},
+		{"let a = {1: 1}; let b = a; b[2] = 5; a[2]", 5},
+		{"let set = fn(arr) { arr[0] = 9 }; let a = [1]; set(a); a[0]", 9},
+		{"let a = [[1]]; let b = a[0]; b[0] = 3; a[0][0]", 3},
+
+		// builtins returning arrays return new ones
+		{"let a = [1, 2, 3]; let b = rest(a); b[0] = 9; a[1]", 2},
+		{"let a = [1, 2]; let b = map(a, fn(x) { x }); b[0] = 9; a[0]", 1},
+		{"let a = [1, 2]; let b = filter(a, fn(x) { true }); b[0] = 9; a[0]", 1},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input, t)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestAssignExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"y = 5", "cannot assign to undeclared variable: y"},
+		{"len = 5", "cannot assign to builtin: len"},
+		{"let arr = [1]; arr[3] = 1", "index out of bounds"},
+		{`let s = "abc"; s[0] = "x"`, "strings are immutable"},
+		{`let h = {}; h["k"] += 1`, "cannot use += on a missing value"},
+		{`let s = "a"; s++`, "cannot use ++ on STRING_OBJ"},
+	}
+	for _, tt := range tests {
+		err := testEvalError(tt.input, t)
+		if !strings.Contains(err.Inspect(), tt.expected) {
+			t.Errorf("wrong error for %q. expected to contain %q, got=%q", tt.input, tt.expected, err.Inspect())
+		}
+	}
+}
+
 func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 	result, ok := obj.(*object.BooleanObj)
 	if !ok {
@@ -381,29 +1014,39 @@ func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	return true
 }
 
-func testNullObject(t *testing.T, obj object.Object) bool {
-	_, ok := obj.(*object.NullObj)
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.FloatObj)
 	if !ok {
-		t.Errorf("object is not Null. got=%T (%+v)", obj, obj)
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%g, want=%g",
+			result.Value, expected)
 		return false
 	}
 	return true
 }
 
-func testEval(input string, t *testing.T) object.Object {
-	l := lexer.CreateLexer(input)
-	p := parser.CreateParser(l)
-	program, errs := p.ParseProgram()
-
-	if len(errs) > 0 {
-		t.Fatalf("unexpected errors: %v", errs)
+func testStringObject(t *testing.T, obj object.Object, expected string) bool {
+	result, ok := obj.(*object.StringObj)
+	if !ok {
+		t.Errorf("object is not String. got=%T (%+v)", obj, obj)
+		return false
 	}
-
-	env := NewEnvironment()
-	val, err := Eval(program, env)
-	if !err.Ok() {
-		panic("Eval returned an error: " + err.Inspect())
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%q, want=%q",
+			result.Value, expected)
+		return false
 	}
+	return true
+}
 
-	return val
+func testNullObject(t *testing.T, obj object.Object) bool {
+	_, ok := obj.(*object.NullObj)
+	if !ok {
+		t.Errorf("object is not Null. got=%T (%+v)", obj, obj)
+		return false
+	}
+	return true
 }
@@ -4,9 +4,18 @@ import (
 	"fmt"
 	"main/ast"
 	"main/object"
+	"sort"
 )
 
 func EvalStatement(s ast.Statement, env Environment) (object.Object, object.ErrorObj) {
+	val, err := evalStatement(s, env)
+	if !err.Ok() {
+		return val, err.At(s.Pos())
+	}
+	return val, err
+}
+
+func evalStatement(s ast.Statement, env Environment) (object.Object, object.ErrorObj) {
 	switch stmt := s.(type) {
 	case ast.BlockStatement:
 		return evalBlockStatement(stmt, env)
@@ -16,6 +25,16 @@ func EvalStatement(s ast.Statement, env Environment) (object.Object, object.Erro
 		return evalLetStatement(stmt, env)
 	case ast.ReturnStatement:
 		return evalReturnStatement(stmt, env)
+	case ast.ForStatement:
+		return evalForStatement(stmt, env)
+	case ast.ForInStatement:
+		return evalForInStatement(stmt, env)
+	case ast.TryStatement:
+		return evalTryStatement(stmt, env)
+	case ast.BreakStatement:
+		return &object.BreakObj{}, object.EmptyErrorObj()
+	case ast.ContinueStatement:
+		return &object.ContinueObj{}, object.EmptyErrorObj()
 	default:
 		return object.NullObj{}, object.NewErrorObj(fmt.Sprintf("unknown statement type: %T", stmt))
 
@@ -23,8 +42,7 @@ func EvalStatement(s ast.Statement, env Environment) (object.Object, object.Erro
 }
 
 func evalBlockStatement(block ast.BlockStatement, env Environment) (object.Object, object.ErrorObj) {
-	prog := ast.Program{Statements: block.Statements}
-	val, err := Eval(prog, env)
+	val, err := evalStatements(block.Statements, env)
 	if !err.Ok() {
 		return object.NullObj{}, object.NewErrorObj("error evaluating block statement", err)
 	}
@@ -32,12 +50,13 @@ func evalBlockStatement(block ast.BlockStatement, env Environment) (object.Objec
 	return val, object.EmptyErrorObj()
 }
 
+// evalLetStatement evaluates let and const statements, both create a new variable in the current
+// scope that may shadow a variable of an outer scope, but not one of the same scope
 func evalLetStatement(stmt ast.LetStatement, env Environment) (object.Object, object.ErrorObj) {
-	// Check if the variable already exists in the environment
 	ident := stmt.Identifier.TokenLiteral()
-	existingVar := env.Get(ident)
-	if existingVar != nil {
-		return object.NullObj{}, object.NewErrorObj(fmt.Sprintf("variable '%s' already exists", ident))
+	slot := env.variable(stmt.Identifier.Binding)
+	if *slot != nil {
+		return object.NullObj{}, object.NewErrorObj(fmt.Sprintf("variable '%s' already exists in this scope", ident))
 	}
 
 	val, err := EvalExpression(stmt.Expression, env)
@@ -46,18 +65,206 @@ func evalLetStatement(stmt ast.LetStatement, env Environment) (object.Object, ob
 			fmt.Sprintf("error evaluating expression for variable '%s'", ident), err,
 		)
 	}
-	env.Create(ident, val)
+
+	// e.g. let x = if (c) { return 1 } else { 2 }, the return wins over the binding
+	if isSignal(val) {
+		return val, object.EmptyErrorObj()
+	}
+
+	// functions are named after the variable they are first bound to, for stack traces
+	if fn, ok := val.(object.FunctionObj); ok && fn.Name == "" {
+		fn.Name = ident
+		val = fn
+	}
+
+	// a host function the expression called may have set the global, like hydrogen's SetGlobal does
+	if *slot != nil {
+		return object.NullObj{}, object.NewErrorObj(fmt.Sprintf("variable '%s' already exists in this scope", ident))
+	}
+	*slot = val
+	if stmt.IsConst() && stmt.Identifier.Binding.Scope == ast.Global {
+		env.state.constGlobals[stmt.Identifier.Binding.Slot] = true
+	}
 	return object.NullObj{}, object.EmptyErrorObj()
 }
 
+// evalReturnExpression evaluates what a return statement returns. Nothing is left to do in
+// the function once a returned call is made, so calls to user functions are left to the caller
+func evalReturnExpression(exp ast.Expression, env Environment) (object.Object, object.ErrorObj) {
+	call, ok := exp.(ast.CallExpression)
+	if !ok || !env.tailCalls {
+		return EvalExpression(exp, env)
+	}
+
+	obj, args, err := evalCallOperands(call, env)
+	if !err.Ok() {
+		return object.NullObj{}, err
+	}
+	if fn, ok := obj.(object.FunctionObj); ok {
+		return &tailCall{fn: fn, args: args, callSite: call.Function.Pos()}, object.EmptyErrorObj()
+	}
+	return callObject(call, obj, args, env)
+}
+
 func evalReturnStatement(stmt ast.ReturnStatement, env Environment) (object.Object, object.ErrorObj) {
 	if stmt.Expression == nil {
-		return object.NullObj{}, object.EmptyErrorObj()
+		return &object.ReturnObj{Value: &object.NullObj{}}, object.EmptyErrorObj()
 	}
 
-	val, err := EvalExpression(stmt.Expression, env)
+	val, err := evalReturnExpression(stmt.Expression, env)
 	if !err.Ok() {
 		return object.NullObj{}, object.NewErrorObj("error evaluating return expression", err)
 	}
-	return val, object.EmptyErrorObj()
+
+	if isSignal(val) {
+		return val, object.EmptyErrorObj()
+	}
+	return &object.ReturnObj{Value: val}, object.EmptyErrorObj()
+}
+
+func evalForStatement(stmt ast.ForStatement, env Environment) (object.Object, object.ErrorObj) {
+	for {
+		cond, err := EvalExpression(stmt.Condition, env)
+		if !err.Ok() {
+			return object.NullObj{}, object.NewErrorObj("failed to evaluate for condition", err)
+		}
+
+		// same as if, anything that isn't a true boolean ends the loop
+		if boolCond, ok := cond.(*object.BooleanObj); !ok || !boolCond.Value {
+			break
+		}
+		if err := env.Budget().Step(); !err.Ok() {
+			return object.NullObj{}, err
+		}
+
+		body, err := evalBlockStatement(stmt.Body, NewEnclosedEnvironment(env, stmt.Body.Slots))
+		if !err.Ok() {
+			return object.NullObj{}, object.NewErrorObj("failed to evaluate for body", err)
+		}
+
+		if _, ok := body.(*object.BreakObj); ok {
+			break
+		} else if _, ok := body.(*object.ReturnObj); ok {
+			return body, object.EmptyErrorObj()
+		}
+	}
+
+	return &object.NullObj{}, object.EmptyErrorObj()
+}
+
+func evalForInStatement(stmt ast.ForInStatement, env Environment) (object.Object, object.ErrorObj) {
+	// the loop variable lives in the scope of each iteration, shadowing any outer one
+	iterable, err := EvalExpression(stmt.Iterable, env)
+	if !err.Ok() {
+		return object.NullObj{}, object.NewErrorObj("failed to evaluate for iterable", err)
+	}
+
+	items, err := IterableItems(iterable)
+	if !err.Ok() {
+		return object.NullObj{}, err
+	}
+
+	for _, item := range items {
+		if err := env.Budget().Step(); !err.Ok() {
+			return object.NullObj{}, err
+		}
+		loopEnv := NewEnclosedEnvironment(env, stmt.Body.Slots)
+		*loopEnv.variable(stmt.Identifier.Binding) = item
+
+		body, err := evalBlockStatement(stmt.Body, loopEnv)
+		if !err.Ok() {
+			return object.NullObj{}, object.NewErrorObj("failed to evaluate for body", err)
+		}
+
+		if _, ok := body.(*object.BreakObj); ok {
+			break
+		} else if _, ok := body.(*object.ReturnObj); ok {
+			return body, object.EmptyErrorObj()
+		}
+	}
+
+	return &object.NullObj{}, object.EmptyErrorObj()
+}
+
+// evalTryStatement runs the try block, and the catch block with the error if it fails.
+// finally always runs last, an error or a return, break or continue from it replaces the outcome
+// of the other blocks, otherwise the outcome of try or catch goes on, errors included
+func evalTryStatement(stmt ast.TryStatement, env Environment) (object.Object, object.ErrorObj) {
+	// calls returned from the body or catch have to be made here, or their errors would escape the try
+	bodyEnv := NewEnclosedEnvironment(env, stmt.Body.Slots)
+	bodyEnv.tailCalls = false
+	val, err := evalBlockStatement(stmt.Body, bodyEnv)
+
+	if !err.Ok() && err.Catchable() && stmt.Catch != nil {
+		// a caught error keeps the calls it was raised in, error() may raise it again anywhere
+		if stack := env.CallStack(); err.CallStack() == nil && len(stack) > 0 {
+			err.Stack = stack
+		}
+		catchEnv := NewEnclosedEnvironment(env, stmt.Catch.Slots)
+		catchEnv.tailCalls = false
+		*catchEnv.variable(stmt.CatchParam.Binding) = &object.ErrorValueObj{Err: err}
+		val, err = evalBlockStatement(*stmt.Catch, catchEnv)
+	}
+
+	if stmt.Finally != nil {
+		finallyVal, finallyErr := evalBlockStatement(*stmt.Finally, NewEnclosedEnvironment(env, stmt.Finally.Slots))
+		if !finallyErr.Ok() {
+			return object.NullObj{}, finallyErr
+		}
+		if isSignal(finallyVal) {
+			return finallyVal, object.EmptyErrorObj()
+		}
+	}
+
+	return val, err
+}
+
+// IterableItems returns a snapshot of the values a for-in loop walks over,
+// so modifying the container inside the loop does not affect the iteration
+func IterableItems(obj object.Object) ([]object.Object, object.ErrorObj) {
+	switch iterable := obj.(type) {
+	case *object.ArrayObj:
+		items := make([]object.Object, len(iterable.Elements))
+		copy(items, iterable.Elements)
+		return items, object.EmptyErrorObj()
+	case *object.StringObj:
+		items := []object.Object{}
+		for _, ch := range iterable.Value {
+			items = append(items, &object.StringObj{Value: string(ch)})
+		}
+		return items, object.EmptyErrorObj()
+	case *object.HashObj:
+		return sortedHashKeys(iterable), object.EmptyErrorObj()
+	default:
+		return nil, object.NewErrorObj("cannot iterate over data type: " + string(obj.Type()))
+	}
+}
+
+// hashes have no order of their own, so keys are sorted to make loops deterministic
+func sortedHashKeys(hash *object.HashObj) []object.Object {
+	keys := make([]object.Object, 0, len(hash.Pairs))
+	for _, pair := range hash.Pairs {
+		keys = append(keys, pair.Key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Type() != keys[j].Type() {
+			return keys[i].Type() < keys[j].Type()
+		}
+
+		switch left := keys[i].(type) {
+		case *object.IntegerObj:
+			return left.Value < keys[j].(*object.IntegerObj).Value
+		case *object.FloatObj:
+			return left.Value < keys[j].(*object.FloatObj).Value
+		case *object.StringObj:
+			return left.Value < keys[j].(*object.StringObj).Value
+		case *object.BooleanObj:
+			return !left.Value && keys[j].(*object.BooleanObj).Value
+		default:
+			return false
+		}
+	})
+
+	return keys
 }
@@ -1,6 +1,14 @@
-package evaluator
+package evaluator_test
 
-import "testing"
+import (
+	"fmt"
+	"main/ast"
+	"main/evaluator"
+	"main/object"
+	"main/token"
+	"strings"
+	"testing"
+)
 
 func TestLetStatements(t *testing.T) {
 	tests := []struct {
@@ -17,3 +25,345 @@ func TestLetStatements(t *testing.T) {
 		testIntegerObject(t, obj, tt.expected)
 	}
 }
+
+func TestLetShadowing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let x = 1; let f = fn() { let x = 2; x }; f() + x", 3},
+		{"let x = 1; if (true) { let x = 5; x }", 5},
+		{"let x = 1; if (true) { let x = 5; }; x", 1},
+		{"let x = 1; let f = fn() { let x = x + 1; x }; f()", 2},
+		{"let x = 1; let f = fn(x) { x * 10 }; f(2)", 20},
+		{"let len = 3; len", 3},
+		{"let f = fn() { let map = 2; map }; f() + len([1])", 3},
+		{"let x = 0; for (x in [7, 8]) { }; x", 0},
+		{"let x = 1; if (true) { x = 2; }; x", 2},
+		{"const x = 1; let f = fn() { let x = 2; x = 3; x }; f() + x", 4},
+		{"const arr = [1]; push(arr, 2); arr[0] = 5; arr[0] + len(arr)", 7},
+	}
+	for _, tt := range tests {
+		obj := testEval(tt.input, t)
+		testIntegerObject(t, obj, tt.expected)
+	}
+}
+
+func TestLetErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1; let x = 2;", "variable 'x' already exists in this scope"},
+		{"const x = 1; let x = 2;", "variable 'x' already exists in this scope"},
+		// checked before the value is computed
+		{`let x = 1; let x = print("side effect")`, "variable 'x' already exists in this scope"},
+		{"let x = 1; let x = 1 / 0", "variable 'x' already exists in this scope"},
+		{"let f = fn() { let y = 1; let y = 2; }; f()", "variable 'y' already exists in this scope"},
+		{"let f = fn(a) { let a = 1; }; f(2)", "variable 'a' already exists in this scope"},
+		{"let f = fn(a, a) { a }; f(1, 2)", "duplicate parameter: a"},
+		{"const x = 1; x = 2", "cannot assign to constant: x"},
+		{"const x = 1; x += 2", "cannot assign to constant: x"},
+		{"const x = 1; x++", "cannot assign to constant: x"},
+		{"const x = 1; ++x", "cannot assign to constant: x"},
+		{"const x = 1; let f = fn() { x = 2 }; f()", "cannot assign to constant: x"},
+		{"let len = 1; len = 2; const len2 = len; len2 = 3", "cannot assign to constant: len2"},
+	}
+	for _, tt := range tests {
+		err := testEvalError(tt.input, t)
+		if !strings.Contains(err.Inspect(), tt.expected) {
+			t.Errorf("wrong error for %q. expected to contain %q, got=%q", tt.input, tt.expected, err.Inspect())
+		}
+	}
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"return 10; 9;", 10},
+		{"if (true) { return 3; } 4", 3},
+		{"if (true) { if (true) { return 3; } 4 } 5", 3},
+		{"let f = fn(x) { if (x > 0) { return 1; } return 2; }; f(5)", 1},
+		{"let f = fn(x) { if (x > 0) { return 1; } return 2; }; f(-5)", 2},
+		{"let f = fn() { if (true) { if (true) { return 10; } } 20 }; f()", 10},
+		{"let f = fn(x) { if (x < 0) { return 0; } else if (x < 10) { return 1; } else { return 2; } 3 }; f(5)", 1},
+		{"let f = fn(xs) { for (x in xs) { if (x > 2) { return x; } } return -1; }; f([1, 2, 3, 4])", 3},
+		{"let f = fn() { let i = 0; for (true) { i++; if (i == 5) { return i * 10; } } }; f()", 50},
+		{"let f = fn() { for (x in [1]) { for (y in [2]) { return x + y; } } 0 }; f()", 3},
+		{"let f = fn() { let g = fn() { return 1; }; g(); 2 }; f()", 2},
+		{"let f = fn() { let x = if (true) { return 7; } else { 1 }; x + 100 }; f()", 7},
+		{"let f = fn(x) { return x * 2; }; f(2) + f(3)", 10},
+		{"map([1, 2], fn(x) { if (x == 1) { return 10; } x })[0]", 10},
+	}
+	for _, tt := range tests {
+		obj := testEval(tt.input, t)
+		testIntegerObject(t, obj, tt.expected)
+	}
+
+	nullTests := []string{
+		"let f = fn() { return; 5 }; f()",
+		"let f = fn() { if (true) { return; } 5 }; f()",
+	}
+	for _, input := range nullTests {
+		obj := testEval(input, t)
+		testNullObject(t, obj)
+	}
+}
+
+func TestForStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let i = 0; for (i < 5) { ++i; }; i", 5},
+		{"let n = 0; for (x in [1, 2, 3]) { ++n; }; n", 3},
+		{"let n = 0; for (c in \"abc\") { ++n; }; n", 3},
+		{"let n = 0; for (c in \"a😀中\") { ++n; }; n", 3},
+		{"let n = 0; for (k in {1: 2, 3: 4}) { ++n; }; n", 2},
+		{"let n = 0; for (true) { if (n == 3) { break; } ++n; }; n", 3},
+		{"let out = []; for (x in [1, 2, 3, 4]) { if (x % 2 == 0) { continue; } push(out, x); }; len(out)", 2},
+		{"let n = 0; for (x in [1, 2, 3]) { for (y in [1, 2, 3]) { if (y == 2) { break; } ++n; } }; n", 3},
+		{"let xs = [1, 2]; let n = 0; for (x in xs) { push(xs, x); ++n; }; n", 2},
+		{"let f = fn(xs) { let n = 0; for (x in xs) { ++n; }; n }; f([5, 6, 7])", 3},
+		{"let n = 0; for (false) { ++n; }; n", 0},
+	}
+	for _, tt := range tests {
+		obj := testEval(tt.input, t)
+		testIntegerObject(t, obj, tt.expected)
+	}
+}
+
+func TestForInHashKeyOrder(t *testing.T) {
+	input := `let out = []; for (k in {3: "c", 1: "a", 2: "b"}) { push(out, k); }; out`
+	evaluated := testEval(input, t)
+
+	result, ok := evaluated.(*object.ArrayObj)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+	}
+	if len(result.Elements) != 3 {
+		t.Fatalf("array has wrong num of elements. got=%d", len(result.Elements))
+	}
+	for i, expected := range []int64{1, 2, 3} {
+		testIntegerObject(t, result.Elements[i], expected)
+	}
+}
+
+func TestForStatementErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"break;", "break outside of loop"},
+		{"continue;", "continue outside of loop"},
+		{"let f = fn() { break; }; for (true) { f(); }", "break outside of loop"},
+		{"for (x in 5) { x }", "cannot iterate over data type: INT_OBJ"},
+	}
+	for _, tt := range tests {
+		err := testEvalError(tt.input, t)
+		if !strings.Contains(err.Inspect(), tt.expected) {
+			t.Errorf("wrong error for %q. expected to contain %q, got=%q", tt.input, tt.expected, err.Inspect())
+		}
+	}
+}
+
+func TestTryStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"try { 1 } catch (e) { 2 }", 1},
+		{"try { error(\"bad\") } catch (e) { 2 }", 2},
+		{"try { 1 + true } catch (e) { e[\"kind\"] }", "RuntimeError"},
+		{"try { error(\"bad\") } catch (e) { e[\"message\"] }", "bad"},
+		{"try { error(\"bad\") } catch (e) { e[\"kind\"] }", "Error"},
+		{"try { error(\"bad\", 42) } catch (e) { e[\"data\"] }", 42},
+		{"try { error(\"bad\", {\"id\": 7}) } catch (e) { e[\"data\"][\"id\"] }", 7},
+		{"try { missing; let missing = 1 } catch (e) { e[\"message\"] }", "unknown identifier: missing"},
+		{"let n = 0; for (i in [1, 2]) { try { if (i == 2) { n = x } } catch (e) { n = e[\"message\"] }; let x = i }; n", "unknown identifier: x"},
+		{"let f = fn() { error(\"deep\") }; try { f() } catch (e) { e[\"message\"] }", "deep"},
+		{"let n = 0; try { n = 1 } finally { n = n + 10 }; n", 11},
+		{"let n = 0; try { error(\"x\") } catch (e) { n = 1 } finally { n = n + 10 }; n", 11},
+		{"let f = fn() { try { return 1 } finally { 5 } }; f()", 1},
+		{"let f = fn() { try { return 1 } finally { return 2 } }; f()", 2},
+		{"let n = 0; for (x in [1, 2, 3]) { try { if (x == 2) { error(\"skip\") } n += x } catch (e) { continue } }; n", 4},
+		{"let f = fn() { try { error(\"x\") } catch (e) { return e[\"message\"] } }; f()", "x"},
+		{"try { try { error(\"inner\") } catch (e) { error(e) } } catch (e) { e[\"message\"] }", "inner"},
+		{"try { try { error(\"inner\") } catch (e) { error(\"outer\", e) } } catch (e) { e[\"cause\"][\"message\"] }", "inner"},
+		{"try { error(\"x\") } catch (e) { e[\"cause\"] }", nil},
+		{"let e = 5; try { error(\"x\") } catch (e) { 1 }; e", 5},
+		{"try {\n  error(\"x\")\n} catch (e) { e[\"line\"] * 100 + e[\"column\"] }", 208},
+	}
+	for _, tt := range tests {
+		obj := testEval(tt.input, t)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, obj, int64(expected))
+		case string:
+			testStringObject(t, obj, expected)
+		default:
+			testNullObject(t, obj)
+		}
+	}
+}
+
+func TestTryStatementErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"error(\"bad record\")", "bad record"},
+		{"try { error(\"a\") } catch (e) { error(\"b\") }", "b"},
+		{"try { 1 } finally { error(\"from finally\") }", "from finally"},
+		{"try { error(\"a\") } finally { 1 }", "a"},
+		{"try { error(\"a\") } catch (e) { e[\"nope\"] }", "errors have no field 'nope'"},
+		{"error(5)", "first argument to error() must be a string, got INT_OBJ"},
+		{"error()", "error() requires 1 or 2 arguments, got 0"},
+		{"error(\"\")", ""},
+	}
+	for _, tt := range tests {
+		err := testEvalError(tt.input, t)
+		if err.Raised().Message != tt.expected {
+			t.Errorf("wrong error for %q. expected %q, got=%q", tt.input, tt.expected, err.Raised().Message)
+		}
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input   string
+		message string
+		line    int
+		column  int
+		caught  bool // whether it is raised at run time, where try can catch it
+	}{
+		{"let x = 1;\nlet y = x + missing;", "unknown identifier: missing", 2, 13, false},
+		{"let f = fn(a) {\n  a + true\n};\nf(1)", "unknown infix expression types: + between INT_OBJ and BOOLEAN_OBJ", 2, 5, true},
+		{"let x = 1;\n\n  y = 2", "cannot assign to undeclared variable: y", 3, 5, false},
+		{"let x = 1;\nbreak", "break outside of loop", 2, 1, false},
+		{"let f = fn() {\n  try { continue } catch (e) { 1 } }", "continue outside of loop", 2, 9, false},
+		{"[1, 2](0)", "not a function: ARRAY_OBJ", 1, 7, true},
+
+		// raised by assignments and updates, below the context they add
+		{"let a = [1];\nlet f = fn() {\n  a[5] = 1 };\nf()", "index out of bounds, attempted to assign 5 in array of length 1", 3, 8, true},
+		{"const c = 1;\n c = 2", "cannot assign to constant: c", 2, 4, true},
+		{"let b = true;\nb++", "cannot use ++ on BOOLEAN_OBJ", 2, 2, true},
+		{`let s = "abc"; s -= "d"`, "unknown string infix operator: -", 1, 18, true},
+		{`let h = {}; h["n"] += 1`, "cannot use += on a missing value", 1, 20, true},
+	}
+	for _, tt := range tests {
+		err := testEvalError(tt.input, t)
+		if err.RootCause().Message != tt.message {
+			t.Errorf("wrong root cause for %q. expected %q, got=%q", tt.input, tt.message, err.RootCause().Message)
+		}
+		if pos := err.Location(); pos.Line != tt.line || pos.Column != tt.column {
+			t.Errorf("wrong position for %q. expected %d:%d, got=%s", tt.input, tt.line, tt.column, pos)
+		}
+
+		if !tt.caught {
+			continue
+		}
+		// a caught error tells where it happened too, a line below in the try block
+		caught := testEval(fmt.Sprintf("try {\n%s\n} catch (e) { [e[\"line\"], e[\"column\"]] }", tt.input), t)
+		if got, expected := inspect(caught), fmt.Sprintf("[INT_OBJ %d, INT_OBJ %d]", tt.line+1, tt.column); got != expected {
+			t.Errorf("wrong caught position for %q. expected %s, got=%s", tt.input, expected, got)
+		}
+	}
+}
+
+func TestUndefinedNamesFailBeforeRunning(t *testing.T) {
+	for _, engine := range engines {
+		session := engine.newSession(evaluator.DefaultMaxCallDepth, evaluator.Prelude())
+		if _, err := session.run(parse("let a = 1", t)); !err.Ok() {
+			t.Fatalf("%s: unexpected error: %s", engine.name, err.Inspect())
+		}
+
+		// the assignment would run first, the typo is in code that never runs
+		_, err := session.run(parse("a = 2; if (false) { pritn(a) }", t))
+		if err.Ok() || err.Raised().Message != "unknown identifier: pritn" {
+			t.Fatalf("%s: expected unknown identifier: pritn, got=%q", engine.name, err.Inspect())
+		}
+
+		val, err := session.run(parse("a", t))
+		if !err.Ok() {
+			t.Fatalf("%s: unexpected error: %s", engine.name, err.Inspect())
+		}
+		testIntegerObject(t, val, 1)
+	}
+}
+
+func TestRuntimeErrorsDoNotPanic(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"{[1]: 2}", "unhashable key type: ARRAY_OBJ"},
+		{"{fn() {}: 2}", "unhashable key type: FUNCTION_OBJ"},
+		{"[1][[0]]", "unsupported index data type: ARRAY_OBJ"},
+		{"{1: 2}[fn() {}]", "unsupported index data type: FUNCTION_OBJ"},
+		{"[1][0.0]", "unindexable data type using float: ARRAY_OBJ"},
+		{"{1: 2}[1.0]", "key 1.0 not found in hash"},
+		{`exit("now")`, "argument to exit() must be an integer, got STRING_OBJ"},
+		{"let x = 1; let x = 2;", "variable 'x' already exists in this scope"},
+	}
+	for _, tt := range tests {
+		err := testEvalError(tt.input, t)
+		if err.RootCause().Message != tt.expected {
+			t.Errorf("wrong error for %q. expected %q, got=%q", tt.input, tt.expected, err.RootCause().Message)
+		}
+	}
+}
+
+// panickingExpression stands in for a bug in the evaluator, the embedded
+// interface is only there to satisfy ast.Expression
+type panickingExpression struct{ ast.Expression }
+
+func (panickingExpression) Pos() token.Position { panic("boom") }
+
+func TestEvalRecoversFromPanics(t *testing.T) {
+	program := ast.Program{Statements: []ast.Statement{
+		ast.ExpressionStatement{Expression: panickingExpression{}},
+	}}
+
+	_, err := evaluator.Eval(program, evaluator.NewEnvironment(evaluator.Prelude()))
+	if err.Ok() || err.Message != "internal error: boom" {
+		t.Fatalf("expected internal error: boom, got=%q", err.Inspect())
+	}
+}
+
+// exit() unwinds the whole program, try statements run their finally blocks but never catch it
+func TestExit(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{"exit()", 0},
+		{"exit(3); 1", 3},
+		{"let f = fn() { exit(4) }; f() + 1", 4},
+		{"map([1, 2], fn(x) { exit(x) })", 1},
+		{"try { exit(2) } catch (e) { 1 }", 2},
+	}
+
+	for _, tt := range tests {
+		err := testEvalError(tt.input, t)
+		code, ok := err.ExitCode()
+		if !ok || code != tt.expected {
+			t.Errorf("%q: error - expected: exit code %d - actual: %s", tt.input, tt.expected, err.Inspect())
+		}
+	}
+
+	for _, engine := range engines {
+		session := engine.newSession(evaluator.DefaultMaxCallDepth, evaluator.Prelude())
+		program := parse("let log = []; let f = fn() { try { exit(1) } finally { push(log, 1) } }; f()", t)
+		if _, err := session.run(program); err.Catchable() {
+			t.Fatalf("%s: expected an exit, got: %s", engine.name, err.Inspect())
+		}
+		val, err := session.run(parse("len(log)", t))
+		if !err.Ok() {
+			t.Fatalf("%s: unexpected error: %s", engine.name, err.Inspect())
+		}
+		testIntegerObject(t, val, 1)
+	}
+}
@@ -0,0 +1,69 @@
+package evaluator
+
+import (
+	"context"
+	"main/object"
+	"strconv"
+)
+
+// Limits bound what a run of a program may use, a zero field is no limit.
+// How deep calls may nest is limited with SetMaxCallDepth
+type Limits struct {
+	Steps    int64 // function calls, builtins included, and loop iterations
+	Elements int64 // elements of the arrays and hashes and bytes of the strings created
+}
+
+// Budget keeps track of what a run used of the limits of its interpreter, and of the context that cancels it.
+// Every run of a program, or call from the host, starts with the whole budget. Catching a limit error
+// gives nothing back, the next step or allocation fails again
+type Budget struct {
+	limits   Limits
+	ctx      context.Context // nil for none
+	steps    int64
+	elements int64
+}
+
+func limitError(message string) object.ErrorObj {
+	err := object.NewErrorObj(message)
+	err.Kind = object.LIMIT_ERROR
+	return err
+}
+
+// Step counts a call or a loop iteration, it fails once the steps are used up or the context is done
+func (b *Budget) Step() object.ErrorObj {
+	b.steps++
+	if b.limits.Steps > 0 && b.steps > b.limits.Steps {
+		return limitError("step limit exceeded: more than " + strconv.FormatInt(b.limits.Steps, 10) + " calls and loop iterations")
+	}
+
+	if b.ctx != nil {
+		select {
+		case <-b.ctx.Done():
+			return limitError("execution cancelled: " + b.ctx.Err().Error())
+		default:
+		}
+	}
+	return object.EmptyErrorObj()
+}
+
+// Allocate counts the elements of a new array, hash or string, it fails once the elements are used up
+func (b *Budget) Allocate(elements int) object.ErrorObj {
+	b.elements += int64(elements)
+	if b.limits.Elements > 0 && b.elements > b.limits.Elements {
+		return limitError("allocation limit exceeded: more than " + strconv.FormatInt(b.limits.Elements, 10) + " elements")
+	}
+	return object.EmptyErrorObj()
+}
+
+// Reset starts a run, with nothing used yet
+func (b *Budget) Reset() {
+	b.steps, b.elements = 0, 0
+}
+
+// AllocateString counts the bytes of a string an operator created, other values are not counted
+func (b *Budget) AllocateString(obj object.Object) object.ErrorObj {
+	if s, ok := obj.(*object.StringObj); ok {
+		return b.Allocate(len(s.Value))
+	}
+	return object.EmptyErrorObj()
+}
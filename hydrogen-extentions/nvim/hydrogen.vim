@@ -8,8 +8,8 @@ if exists("b:current_syntax")
 endif
 
 " Keywords
-syn keyword hydrogenKeyword let fn print return
-syn keyword hydrogenBuiltin filter map reduce len
+syn keyword hydrogenKeyword let const fn print return try catch finally
+syn keyword hydrogenBuiltin filter map reduce len error
 
 " Operators
 syn match hydrogenOperator "="
@@ -46,6 +46,7 @@ syn region hydrogenString start='"' end='"' contained
 
 " Comments (if your language supports them)
 syn match hydrogenComment "#.*$"
+syn region hydrogenComment start="#\[" end="\]#"
 
 " Identifiers (variable names, function names)
 syn match hydrogenIdentifier "\<[a-zA-Z_][a-zA-Z0-9_]*\>"
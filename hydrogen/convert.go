@@ -0,0 +1,112 @@
+package hydrogen
+
+import (
+	"fmt"
+	"main/object"
+	"math"
+)
+
+// ToObject converts a Go value to a value of the language: nil, booleans, numbers, strings,
+// []any, map[string]any and Func. Values of the language are left as they are
+func ToObject(value any) (object.Object, error) {
+	switch v := value.(type) {
+	case nil:
+		return &object.NullObj{}, nil
+	case object.Object:
+		return v, nil
+	case bool:
+		return &object.BooleanObj{Value: v}, nil
+	case int:
+		return &object.IntegerObj{Value: int64(v)}, nil
+	case int8:
+		return &object.IntegerObj{Value: int64(v)}, nil
+	case int16:
+		return &object.IntegerObj{Value: int64(v)}, nil
+	case int32:
+		return &object.IntegerObj{Value: int64(v)}, nil
+	case int64:
+		return &object.IntegerObj{Value: v}, nil
+	case uint:
+		return unsignedObject(uint64(v))
+	case uint8:
+		return &object.IntegerObj{Value: int64(v)}, nil
+	case uint16:
+		return &object.IntegerObj{Value: int64(v)}, nil
+	case uint32:
+		return &object.IntegerObj{Value: int64(v)}, nil
+	case uint64:
+		return unsignedObject(v)
+	case float32:
+		return &object.FloatObj{Value: float64(v)}, nil
+	case float64:
+		return &object.FloatObj{Value: v}, nil
+	case string:
+		return &object.StringObj{Value: v}, nil
+	case []any:
+		elements := make([]object.Object, len(v))
+		for i, element := range v {
+			obj, err := ToObject(element)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = obj
+		}
+		return &object.ArrayObj{Elements: elements}, nil
+	case map[string]any:
+		pairs := make(map[object.HashKey]object.HashPair, len(v))
+		for key, element := range v {
+			obj, err := ToObject(element)
+			if err != nil {
+				return nil, err
+			}
+			k := &object.StringObj{Value: key}
+			pairs[k.HashKey()] = object.HashPair{Key: k, Value: obj}
+		}
+		return &object.HashObj{Pairs: pairs}, nil
+	case Func:
+		return builtin(v), nil
+	case func(args ...any) (any, error):
+		return builtin(v), nil
+	default:
+		return nil, fmt.Errorf("cannot convert %T to a hydrogen value", value)
+	}
+}
+
+func unsignedObject(v uint64) (object.Object, error) {
+	if v > math.MaxInt64 {
+		return nil, fmt.Errorf("integer %d overflows int64", v)
+	}
+	return &object.IntegerObj{Value: int64(v)}, nil
+}
+
+// ToGo converts a value of the language to Go: int64, float64, string, bool, nil, []any and map[string]any.
+// Keys of hashes that are not strings become what they look like printed.
+// Values without a Go counterpart, like functions, are returned as they are
+func ToGo(obj object.Object) any {
+	switch o := obj.(type) {
+	case nil, object.NullObj, *object.NullObj:
+		return nil
+	case *object.IntegerObj:
+		return o.Value
+	case *object.FloatObj:
+		return o.Value
+	case *object.StringObj:
+		return o.Value
+	case *object.BooleanObj:
+		return o.Value
+	case *object.ArrayObj:
+		values := make([]any, len(o.Elements))
+		for i, element := range o.Elements {
+			values[i] = ToGo(element)
+		}
+		return values
+	case *object.HashObj:
+		values := make(map[string]any, len(o.Pairs))
+		for _, pair := range o.Pairs {
+			values[pair.Key.Inspect()] = ToGo(pair.Value)
+		}
+		return values
+	default:
+		return obj
+	}
+}
@@ -0,0 +1,115 @@
+package hydrogen
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"main/ast"
+	"main/compiler"
+	"main/evaluator"
+	"main/object"
+	"main/vm"
+)
+
+// engine runs the programs of an interpreter one after the other, later programs see the globals of earlier ones
+type engine interface {
+	run(program ast.Program) (object.Object, object.ErrorObj)
+	call(fn object.Object, args []object.Object) (object.Object, object.ErrorObj)
+	global(name string) (object.Object, bool)
+	setGlobal(name string, value object.Object) object.ErrorObj
+	setIO(in io.Reader, out io.Writer, errOut io.Writer)
+	setLimits(limits evaluator.Limits)
+	setContext(ctx context.Context)
+}
+
+// newEngine returns the engine with the given name, maxCallDepth 0 removes the call depth limit
+func newEngine(name string, maxCallDepth int, builtins *evaluator.Builtins) (engine, error) {
+	switch name {
+	case "", "eval":
+		env := evaluator.NewEnvironment(builtins)
+		env.SetMaxCallDepth(maxCallDepth)
+		return &evalEngine{env: env}, nil
+	case "vm":
+		machine := vm.New(builtins)
+		machine.SetMaxCallDepth(maxCallDepth)
+		return &vmEngine{compiler: compiler.New(builtins), machine: machine}, nil
+	default:
+		return nil, fmt.Errorf("unknown engine %q, expected eval or vm", name)
+	}
+}
+
+// evalEngine walks the syntax tree of programs
+type evalEngine struct {
+	env evaluator.Environment
+}
+
+func (e *evalEngine) run(program ast.Program) (object.Object, object.ErrorObj) {
+	return evaluator.Eval(program, e.env)
+}
+
+func (e *evalEngine) call(fn object.Object, args []object.Object) (object.Object, object.ErrorObj) {
+	return evaluator.Call(fn, args, e.env)
+}
+
+func (e *evalEngine) global(name string) (object.Object, bool) {
+	return e.env.Global(name)
+}
+
+func (e *evalEngine) setGlobal(name string, value object.Object) object.ErrorObj {
+	return e.env.SetGlobal(name, value)
+}
+
+func (e *evalEngine) setIO(in io.Reader, out io.Writer, errOut io.Writer) {
+	e.env.SetIO(in, out, errOut)
+}
+
+func (e *evalEngine) setLimits(limits evaluator.Limits) {
+	e.env.SetLimits(limits)
+}
+
+func (e *evalEngine) setContext(ctx context.Context) {
+	e.env.SetContext(ctx)
+}
+
+// vmEngine compiles programs to bytecode and runs them on a vm
+type vmEngine struct {
+	compiler *compiler.Compiler
+	machine  *vm.VM
+}
+
+func (e *vmEngine) run(program ast.Program) (object.Object, object.ErrorObj) {
+	bytecode, err := e.compiler.Compile(program)
+	if !err.Ok() {
+		return object.NullObj{}, err
+	}
+	return e.machine.Run(bytecode)
+}
+
+func (e *vmEngine) call(fn object.Object, args []object.Object) (object.Object, object.ErrorObj) {
+	return e.machine.Call(fn, args)
+}
+
+func (e *vmEngine) global(name string) (object.Object, bool) {
+	slot, ok := e.compiler.Global(name)
+	if !ok {
+		return nil, false
+	}
+	value := e.machine.Global(slot)
+	return value, value != nil
+}
+
+func (e *vmEngine) setGlobal(name string, value object.Object) object.ErrorObj {
+	return e.machine.SetGlobal(e.compiler.DeclareGlobal(name), value)
+}
+
+func (e *vmEngine) setIO(in io.Reader, out io.Writer, errOut io.Writer) {
+	e.machine.SetIO(in, out, errOut)
+}
+
+func (e *vmEngine) setLimits(limits evaluator.Limits) {
+	e.machine.SetLimits(limits)
+}
+
+func (e *vmEngine) setContext(ctx context.Context) {
+	e.machine.SetContext(ctx)
+}
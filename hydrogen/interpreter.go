@@ -0,0 +1,232 @@
+// Package hydrogen embeds the interpreter in Go programs. An Interpreter runs scripts,
+// calls their functions and shares values with the host, converting them to and from Go
+package hydrogen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"main/ast"
+	"main/evaluator"
+	"main/lexer"
+	"main/object"
+	"main/parser"
+	"os"
+	"strings"
+)
+
+// Options configure a new Interpreter, the zero value runs scripts on the evaluator with the default
+// call depth limit and no builtins
+type Options struct {
+	Engine       string              // eval walks the syntax tree, vm compiles to bytecode first. Empty for eval
+	MaxCallDepth int                 // how deep calls may nest, 0 for evaluator.DefaultMaxCallDepth and negative for no limit
+	Builtins     *evaluator.Builtins // the builtins scripts can call, evaluator.Prelude() has those of the language
+	Limits       evaluator.Limits    // the steps and elements every run may use, the zero value has no limits
+
+	In  io.Reader // where input() and read_line() read from, os.Stdin if nil
+	Out io.Writer // where print() writes to, os.Stdout if nil
+	Err io.Writer // where builtins added to Builtins report problems with Environment.Err, os.Stderr if nil
+}
+
+// Interpreter runs scripts one after the other, later scripts see the globals of earlier ones.
+// Interpreters share nothing, any number of them can be used side by side but each by one goroutine at a time
+type Interpreter struct {
+	engine   engine
+	builtins *evaluator.Builtins
+}
+
+// Func is a Go function scripts can call, arguments and the result are converted like the values of SetGlobal.
+// A returned error is raised in the script as a RuntimeError
+type Func func(args ...any) (any, error)
+
+// Error is an error a script raised and did not catch
+type Error struct {
+	Err object.ErrorObj
+}
+
+func (e *Error) Error() string {
+	raised := e.Err.Raised()
+	message := raised.Kind + ": " + raised.Message
+	if pos := e.Err.Location(); pos.IsValid() {
+		message = pos.String() + ": " + message
+	}
+	return message
+}
+
+// ExitError is a script that ended itself with exit(), the process is left for the host to end
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit with code %d", e.Code)
+}
+
+// ParseError is a script that failed to parse, with every syntax error found
+type ParseError struct {
+	Errors []error
+}
+
+func (e *ParseError) Error() string {
+	messages := []string{}
+	for _, err := range e.Errors {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "\n")
+}
+
+func New(opts Options) (*Interpreter, error) {
+	builtins := opts.Builtins
+	if builtins == nil {
+		builtins = evaluator.NewBuiltins()
+	}
+
+	maxCallDepth := opts.MaxCallDepth
+	if maxCallDepth == 0 {
+		maxCallDepth = evaluator.DefaultMaxCallDepth
+	} else if maxCallDepth < 0 {
+		maxCallDepth = 0
+	}
+
+	engine, err := newEngine(opts.Engine, maxCallDepth, builtins)
+	if err != nil {
+		return nil, err
+	}
+	engine.setIO(opts.In, opts.Out, opts.Err)
+	engine.setLimits(opts.Limits)
+	return &Interpreter{engine: engine, builtins: builtins}, nil
+}
+
+// Builtins returns the builtins scripts can call, scripts see the changes made to them before they run.
+// Builtins are not globals, Call and GetGlobal do not find them
+func (i *Interpreter) Builtins() *evaluator.Builtins {
+	return i.builtins
+}
+
+// SetContext makes the runs and calls from now on fail with a LimitError once ctx is done, nil for none.
+// It is checked at every call and loop iteration, so a script that hangs can be stopped
+func (i *Interpreter) SetContext(ctx context.Context) {
+	i.engine.setContext(ctx)
+}
+
+// Run runs an already parsed program and returns the value of its last statement, or what it returns
+func (i *Interpreter) Run(program ast.Program) (object.Object, object.ErrorObj) {
+	return i.engine.run(program)
+}
+
+// RunString runs the source of a script and returns its value converted to Go
+func (i *Interpreter) RunString(source string) (any, error) {
+	return i.runSource(lexer.CreateLexer(source))
+}
+
+// RunFile runs a script file and returns its value converted to Go, errors point into the file
+func (i *Interpreter) RunFile(path string) (any, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return i.runSource(lexer.CreateFileLexer(path, string(source)))
+}
+
+func (i *Interpreter) runSource(l *lexer.Lexer) (any, error) {
+	p := parser.CreateParser(l)
+	program, errs := p.ParseProgram()
+	if len(errs) != 0 {
+		return nil, &ParseError{Errors: errs}
+	}
+
+	result, err := i.engine.run(program)
+	if !err.Ok() {
+		return nil, scriptError(err)
+	}
+	return ToGo(result), nil
+}
+
+// scriptError returns the Go error for an error a script did not catch
+func scriptError(err object.ErrorObj) error {
+	if code, ok := err.ExitCode(); ok {
+		return &ExitError{Code: code}
+	}
+	return &Error{Err: err}
+}
+
+// Call calls the function in a global variable with arguments converted from Go, and returns its result converted to Go
+func (i *Interpreter) Call(name string, args ...any) (any, error) {
+	fn, ok := i.engine.global(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown function: %s", name)
+	}
+
+	objects := make([]object.Object, len(args))
+	for n, arg := range args {
+		obj, err := ToObject(arg)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d of %s: %w", n+1, name, err)
+		}
+		objects[n] = obj
+	}
+
+	result, err := i.engine.call(fn, objects)
+	if !err.Ok() {
+		return nil, scriptError(err)
+	}
+	return ToGo(result), nil
+}
+
+// SetGlobal assigns a value converted from Go to a global variable, declaring it if no script did.
+// Scripts run after it see the variable, constants cannot be assigned to
+func (i *Interpreter) SetGlobal(name string, value any) error {
+	obj, err := ToObject(value)
+	if err != nil {
+		return fmt.Errorf("global %s: %w", name, err)
+	}
+	if err := i.engine.setGlobal(name, obj); !err.Ok() {
+		return &Error{Err: err}
+	}
+	return nil
+}
+
+// GetGlobal returns the value of a global variable converted to Go, false if it was never declared
+func (i *Interpreter) GetGlobal(name string) (any, bool) {
+	obj, ok := i.engine.global(name)
+	if !ok {
+		return nil, false
+	}
+	return ToGo(obj), true
+}
+
+// RegisterFunc makes a Go function callable from scripts as a global variable
+func (i *Interpreter) RegisterFunc(name string, fn Func) error {
+	return i.SetGlobal(name, fn)
+}
+
+// builtin wraps a Go function so scripts can call it like the builtins of the language
+func builtin(fn Func) *evaluator.Builtin {
+	return &evaluator.Builtin{Fn: func(_ evaluator.Environment, args ...object.Object) (object.Object, object.ErrorObj) {
+		values := make([]any, len(args))
+		for n, arg := range args {
+			values[n] = ToGo(arg)
+		}
+
+		result, err := fn(values...)
+		if err != nil {
+			// an error or exit of a script the function called goes on as it is
+			var scriptErr *Error
+			if errors.As(err, &scriptErr) {
+				return object.NullObj{}, scriptErr.Err
+			}
+			var exitErr *ExitError
+			if errors.As(err, &exitErr) {
+				return object.NullObj{}, object.NewExitErrorObj(int64(exitErr.Code))
+			}
+			return object.NullObj{}, object.NewErrorObj(err.Error())
+		}
+
+		obj, err := ToObject(result)
+		if err != nil {
+			return object.NullObj{}, object.NewErrorObj(err.Error())
+		}
+		return obj, object.EmptyErrorObj()
+	}}
+}
@@ -0,0 +1,339 @@
+package hydrogen
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"main/evaluator"
+	"main/object"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var engines = []string{"eval", "vm"}
+
+func newInterpreter(engine string, t *testing.T) *Interpreter {
+	return newInterpreterWith(engine, nil, t)
+}
+
+func newInterpreterWith(engine string, builtins *evaluator.Builtins, t *testing.T) *Interpreter {
+	interpreter, err := New(Options{Engine: engine, Builtins: builtins})
+	if err != nil {
+		t.Fatalf("%s: %v", engine, err)
+	}
+	return interpreter
+}
+
+func run(interpreter *Interpreter, source string, t *testing.T) any {
+	result, err := interpreter.RunString(source)
+	if err != nil {
+		t.Fatalf("%q: unexpected error: %v", source, err)
+	}
+	return result
+}
+
+func TestRunString(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"1 + 2", int64(3)},
+		{"1.5 * 2", 3.0},
+		{`"a" + "b"`, "ab"},
+		{"1 < 2", true},
+		{"let x = 1", nil},
+		{`[1, "two", [3]]`, []any{int64(1), "two", []any{int64(3)}}},
+		{`{"a": 1, 2: true}`, map[string]any{"a": int64(1), "2": true}},
+	}
+
+	for _, engine := range engines {
+		for _, tt := range tests {
+			if got := run(newInterpreter(engine, t), tt.input, t); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("%s: %q: error - expected: %#v - actual: %#v", engine, tt.input, tt.expected, got)
+			}
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for _, engine := range engines {
+		interpreter := newInterpreter(engine, t)
+
+		_, err := interpreter.RunString("let = 1")
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			t.Errorf("%s: error - expected: a parse error - actual: %v", engine, err)
+		}
+
+		_, err = interpreter.RunString("let x = 1;\nx()")
+		var scriptErr *Error
+		if !errors.As(err, &scriptErr) {
+			t.Fatalf("%s: error - expected: a script error - actual: %v", engine, err)
+		}
+		if expected := "2:2: RuntimeError: not a function: INT_OBJ"; err.Error() != expected {
+			t.Errorf("%s: error - expected: %q - actual: %q", engine, expected, err.Error())
+		}
+	}
+}
+
+func TestCall(t *testing.T) {
+	for _, engine := range engines {
+		interpreter := newInterpreter(engine, t)
+		run(interpreter, `let greet = fn(name, times) { let s = ""; for (i in [1, 2, 3]) { if (i <= times) { s += name } }; s }`, t)
+
+		got, err := interpreter.Call("greet", "ab", 2)
+		if err != nil || got != "abab" {
+			t.Errorf("%s: error - expected: \"abab\" - actual: %#v %v", engine, got, err)
+		}
+		got, err = interpreter.Call("len", []any{1, 2})
+		if err == nil {
+			t.Errorf("%s: error - expected: builtins are not globals - actual: %#v", engine, got)
+		}
+		if _, err := interpreter.Call("greet", "ab"); err == nil || !strings.Contains(err.Error(), "wrong number of arguments") {
+			t.Errorf("%s: error - expected: wrong number of arguments - actual: %v", engine, err)
+		}
+		if _, err := interpreter.Call("missing"); err == nil {
+			t.Errorf("%s: error - expected: unknown function", engine)
+		}
+	}
+}
+
+func TestGlobals(t *testing.T) {
+	for _, engine := range engines {
+		interpreter := newInterpreter(engine, t)
+		config := map[string]any{"name": "hydrogen", "sizes": []any{1, 2, 3}}
+		if err := interpreter.SetGlobal("config", config); err != nil {
+			t.Fatalf("%s: unexpected error: %v", engine, err)
+		}
+
+		run(interpreter, `let total = 0; for (size in config["sizes"]) { total += size }; config["name"] = "h"`, t)
+		if got, ok := interpreter.GetGlobal("total"); !ok || got != int64(6) {
+			t.Errorf("%s: error - expected: 6 - actual: %#v", engine, got)
+		}
+		if got, _ := interpreter.GetGlobal("config"); got.(map[string]any)["name"] != "h" {
+			t.Errorf("%s: error - expected: the script to change the hash - actual: %#v", engine, got)
+		}
+		if _, ok := interpreter.GetGlobal("missing"); ok {
+			t.Errorf("%s: error - expected: no value for a global never declared", engine)
+		}
+
+		run(interpreter, "const limit = 10", t)
+		if err := interpreter.SetGlobal("limit", 11); err == nil {
+			t.Errorf("%s: error - expected: constants cannot be set", engine)
+		}
+		if err := interpreter.SetGlobal("total", struct{}{}); err == nil {
+			t.Errorf("%s: error - expected: values without a conversion are refused", engine)
+		}
+
+		// a global set while the value of its let statement is computed is not overwritten
+		interpreter.RegisterFunc("claim", func(args ...any) (any, error) {
+			return int64(2), interpreter.SetGlobal("claimed", 1)
+		})
+		_, err := interpreter.RunString("let claimed = claim()")
+		if expected := "1:1: RuntimeError: variable 'claimed' already exists in this scope"; err == nil || err.Error() != expected {
+			t.Errorf("%s: error - expected: %q - actual: %v", engine, expected, err)
+		}
+		if got, _ := interpreter.GetGlobal("claimed"); got != int64(1) {
+			t.Errorf("%s: error - expected: 1 - actual: %#v", engine, got)
+		}
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	for _, engine := range engines {
+		interpreter := newInterpreterWith(engine, evaluator.Prelude(), t)
+		interpreter.RegisterFunc("upper", func(args ...any) (any, error) {
+			s, ok := args[0].(string)
+			if !ok {
+				return nil, fmt.Errorf("upper: expected a string, got %T", args[0])
+			}
+			return strings.ToUpper(s), nil
+		})
+		// a Go function may call back into the scripts
+		interpreter.RegisterFunc("twice", func(args ...any) (any, error) {
+			once, err := interpreter.Call("double", args[0])
+			if err != nil {
+				return nil, err
+			}
+			return interpreter.Call("double", once)
+		})
+
+		tests := []struct {
+			input    string
+			expected any
+		}{
+			{`upper("abc")`, "ABC"},
+			{`try { upper(1) } catch (e) { e["message"] }`, "upper: expected a string, got int64"},
+			// Go functions are values like any other
+			{`map(["a", "b"], upper)`, []any{"A", "B"}},
+			{`filter(["a", "b"], fn(s) { upper(s) == "B" })`, []any{"b"}},
+			{`let f = upper; f("c")`, "C"},
+			{`let double = fn(x) { x * 2 }; twice(3)`, int64(12)},
+			{`try { twice("a") } catch (e) { e["message"] }`, "unknown infix expression types: * between STRING_OBJ and INT_OBJ"},
+		}
+		for _, tt := range tests {
+			result, err := interpreter.RunString(tt.input)
+			if err != nil || !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("%s: %q: error - expected: %#v - actual: %#v %v", engine, tt.input, tt.expected, result, err)
+			}
+		}
+	}
+}
+
+func TestBuiltins(t *testing.T) {
+	for _, engine := range engines {
+		bare := newInterpreter(engine, t)
+		if _, err := bare.RunString(`len("abc")`); err == nil {
+			t.Errorf("%s: error - expected: no builtins without the prelude", engine)
+		}
+
+		interpreter := newInterpreterWith(engine, evaluator.Prelude(), t)
+		interpreter.Builtins().Replace("len", func(_ evaluator.Environment, args ...object.Object) (object.Object, object.ErrorObj) {
+			return &object.IntegerObj{Value: -1}, object.EmptyErrorObj()
+		})
+		if got := run(interpreter, `len("abc")`, t); got != int64(-1) {
+			t.Errorf("%s: error - expected: the replaced len - actual: %#v", engine, got)
+		}
+		if got := run(newInterpreterWith(engine, evaluator.Prelude(), t), `len("abc")`, t); got != int64(3) {
+			t.Errorf("%s: error - expected: another interpreter to keep its len - actual: %#v", engine, got)
+		}
+	}
+}
+
+func TestIO(t *testing.T) {
+	for _, engine := range engines {
+		var out bytes.Buffer
+		interpreter, err := New(Options{Engine: engine, Builtins: evaluator.Prelude(), In: strings.NewReader("3\n"), Out: &out})
+		if err != nil {
+			t.Fatalf("%s: %v", engine, err)
+		}
+
+		run(interpreter, `print("twice", int(input("n: ")) * 2)`, t)
+		if expected := "n: twice 6 \n"; out.String() != expected {
+			t.Errorf("%s: error - expected: %q - actual: %q", engine, expected, out.String())
+		}
+	}
+}
+
+func TestExit(t *testing.T) {
+	for _, engine := range engines {
+		interpreter := newInterpreterWith(engine, evaluator.Prelude(), t)
+		run(interpreter, "let cleaned = false; let quit = fn(code) { try { exit(code) } catch (e) { 0 } finally { cleaned = true } }", t)
+		// a Go function may end the script too
+		interpreter.RegisterFunc("stop", func(args ...any) (any, error) {
+			return nil, &ExitError{Code: 9}
+		})
+
+		_, err := interpreter.Call("quit", 3)
+		var exitErr *ExitError
+		if !errors.As(err, &exitErr) || exitErr.Code != 3 {
+			t.Errorf("%s: error - expected: exit with code 3 - actual: %v", engine, err)
+		}
+		if cleaned, _ := interpreter.GetGlobal("cleaned"); cleaned != true {
+			t.Errorf("%s: error - expected: the finally block to run", engine)
+		}
+
+		_, err = interpreter.RunString("try { stop() } catch (e) { 1 }")
+		if !errors.As(err, &exitErr) || exitErr.Code != 9 {
+			t.Errorf("%s: error - expected: exit with code 9 - actual: %v", engine, err)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	for _, engine := range engines {
+		interpreter, err := New(Options{Engine: engine, Limits: evaluator.Limits{Steps: 100, Elements: 100}})
+		if err != nil {
+			t.Fatalf("%s: %v", engine, err)
+		}
+
+		run(interpreter, "let spin = fn(n) { spin(n + 1) }; let count = fn(n) { let i = 0; for (i < n) { i++ }; i }", t)
+		tests := []struct {
+			source   string
+			expected string
+		}{
+			{"spin(0)", "step limit exceeded: more than 100 calls and loop iterations"},
+			{`let s = "x"; for (true) { s += s }`, "allocation limit exceeded: more than 100 elements"},
+		}
+		for _, tt := range tests {
+			_, err := interpreter.RunString(tt.source)
+			var scriptErr *Error
+			if !errors.As(err, &scriptErr) || scriptErr.Err.Raised().Kind != object.LIMIT_ERROR || scriptErr.Err.Raised().Message != tt.expected {
+				t.Errorf("%s: %q: error - expected: LimitError: %s - actual: %v", engine, tt.source, tt.expected, err)
+			}
+		}
+
+		// every call from the host starts with the whole budget
+		for i := 0; i < 3; i++ {
+			if got, err := interpreter.Call("count", 90); err != nil || got != int64(90) {
+				t.Errorf("%s: error - expected: 90 - actual: %v %v", engine, got, err)
+			}
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		interpreter.SetContext(ctx)
+		_, err = interpreter.Call("count", 1)
+		var scriptErr *Error
+		if !errors.As(err, &scriptErr) || scriptErr.Err.Raised().Message != "execution cancelled: context canceled" {
+			t.Errorf("%s: error - expected: the call to be cancelled - actual: %v", engine, err)
+		}
+	}
+}
+
+func TestIsolation(t *testing.T) {
+	for _, engine := range engines {
+		var wg sync.WaitGroup
+		results := make([]any, 8)
+		errs := make([]error, 8)
+		for n := range results {
+			wg.Add(1)
+			go func(n int) {
+				defer wg.Done()
+				interpreter, err := New(Options{Engine: engine})
+				if err != nil {
+					errs[n] = err
+					return
+				}
+				if errs[n] = interpreter.SetGlobal("n", n); errs[n] != nil {
+					return
+				}
+				results[n], errs[n] = interpreter.RunString("let fib = fn(x) { if (x < 2) { x } else { fib(x - 1) + fib(x - 2) } }; fib(10) + n")
+			}(n)
+		}
+		wg.Wait()
+
+		for n := range results {
+			if errs[n] != nil || results[n] != int64(55+n) {
+				t.Errorf("%s: interpreter %d: error - expected: %d - actual: %#v %v", engine, n, 55+n, results[n], errs[n])
+			}
+		}
+	}
+}
+
+func TestConversions(t *testing.T) {
+	values := []any{nil, true, int64(-1), 2.5, "s", []any{int64(1), []any{}}, map[string]any{"k": []any{"v"}}}
+	for _, value := range values {
+		obj, err := ToObject(value)
+		if err != nil {
+			t.Fatalf("%#v: unexpected error: %v", value, err)
+		}
+		if got := ToGo(obj); !reflect.DeepEqual(got, value) {
+			t.Errorf("error - expected: %#v - actual: %#v", value, got)
+		}
+	}
+
+	if obj, err := ToObject(uint8(7)); err != nil || ToGo(obj) != int64(7) {
+		t.Errorf("error - expected: 7 - actual: %v %v", obj, err)
+	}
+	if _, err := ToObject(uint64(math.MaxUint64)); err == nil {
+		t.Errorf("error - expected: an overflow error")
+	}
+	if _, err := ToObject(map[int]any{}); err == nil {
+		t.Errorf("error - expected: an error for a type without a conversion")
+	}
+}
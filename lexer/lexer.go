@@ -1,50 +1,134 @@
 package lexer
 
 import (
+	"fmt"
 	"main/token"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 type Lexer struct {
 	source       string
-	position     int // pointer of current position in input
-	readPosition int // pointer of char we're currently reading
-	ch           byte
+	file         string // name of the source file, used in token positions
+	position     int    // pointer of current position in input
+	readPosition int    // pointer of char we're currently reading
+	ch           rune
+	line         int // line of ch
+	column       int // column of ch, counted in runes
+
+	emitComments bool // return comments as COMMENT tokens instead of skipping them
+
+	illegalReason  string                    // why the token being read is ILLEGAL
+	illegalPos     token.Position            // where the problem is, when it is not at the start of the token
+	illegalReasons map[token.Position]string // why each ILLEGAL token was emitted
 }
 
 func CreateLexer(input string) *Lexer {
-	l := &Lexer{source: input}
+	return CreateFileLexer("", input)
+}
+
+// CreateFileLexer is CreateLexer with the file name stamped on every token position
+func CreateFileLexer(file string, input string) *Lexer {
+	l := &Lexer{source: input, file: file, line: 1, illegalReasons: map[token.Position]string{}}
 	l.readChar()
 	return l
-
 }
 
 func (l *Lexer) readChar() {
-	if l.readPosition >= len(l.source) {
-		l.ch = 0
+	if l.ch == '\n' {
+		l.line++
+		l.column = 1
 	} else {
-		l.ch = l.source[l.readPosition]
+		l.column++
 	}
+
 	l.position = l.readPosition
-	l.readPosition += 1
+	if l.readPosition >= len(l.source) {
+		l.ch = 0
+		l.readPosition += 1
+		return
+	}
+
+	ch, width := utf8.DecodeRuneInString(l.source[l.readPosition:])
+	l.ch = ch
+	l.readPosition += width
+}
+
+// invalidEncoding is true when ch is a byte that is not valid UTF-8,
+// as opposed to a literal U+FFFD in the source
+func (l *Lexer) invalidEncoding() bool {
+	return l.ch == utf8.RuneError && l.readPosition-l.position == 1
+}
+
+func (l *Lexer) currPosition() token.Position {
+	return token.Position{File: l.file, Line: l.line, Column: l.column}
+}
+
+// EmitComments makes the lexer return comments as COMMENT tokens, they are skipped like whitespace otherwise
+func (l *Lexer) EmitComments(emit bool) {
+	l.emitComments = emit
 }
 
 func (l *Lexer) GetNextToken() token.Token {
+	for {
+		t := l.readToken()
+		if t.Type != token.COMMENT || l.emitComments {
+			return t
+		}
+	}
+}
+
+func (l *Lexer) readToken() token.Token {
 	var nextToken token.Token
 
 	l.skipWhitespace()
-	if isNumber(l.ch) {
+	pos := l.currPosition()
+
+	if l.invalidEncoding() {
+		nextToken = l.illegalToken(l.source[l.position:l.readPosition], fmt.Sprintf("invalid UTF-8 encoding: byte %#x", l.source[l.position]))
+		l.readChar()
+	} else if isNumber(l.ch) {
 		nextToken = l.NumberToken()
 	} else if isLetter(l.ch) {
 		nextToken = l.literalToken()
-	} else if l.ch == '"' {
+	} else if l.ch == '"' || l.ch == '`' {
 		nextToken = l.StringToken()
+	} else if l.ch == '#' {
+		nextToken = l.commentToken()
 	} else {
 		nextToken = l.specialToken()
 	}
 
+	if nextToken.Type == token.ILLEGAL && l.illegalPos.IsValid() {
+		pos = l.illegalPos
+	}
+	l.illegalPos = token.Position{}
+
+	nextToken.Pos = pos
+	if nextToken.Type == token.ILLEGAL {
+		if l.illegalReason == "" {
+			l.illegalReason = fmt.Sprintf("unexpected character %q", nextToken.Literal)
+		}
+		l.illegalReasons[pos] = l.illegalReason
+		l.illegalReason = ""
+	}
+
 	return nextToken
 }
 
+// IllegalReason explains why the ILLEGAL token at pos could not be lexed
+func (l *Lexer) IllegalReason(pos token.Position) (string, bool) {
+	reason, ok := l.illegalReasons[pos]
+	return reason, ok
+}
+
+func (l *Lexer) illegalToken(literal string, reason string) token.Token {
+	l.illegalReason = reason
+	return token.Token{Type: token.ILLEGAL, Literal: literal}
+}
+
 func (l *Lexer) skipWhitespace() {
 	for isWhitespace(l.ch) {
 		l.readChar()
@@ -53,7 +137,7 @@ func (l *Lexer) skipWhitespace() {
 
 func (l *Lexer) literalToken() token.Token {
 	p := l.position
-	for isLetter(l.ch) || isNumber(l.ch) {
+	for isLetter(l.ch) || isIdentifierChar(l.ch) {
 		l.readChar()
 	}
 
@@ -68,24 +152,171 @@ func (l *Lexer) literalToken() token.Token {
 	return t
 }
 
+// commentToken reads a # line comment or a #[ ... ]# block comment, the literal is the
+// whole comment. Block comments can be nested, so code containing them can be commented out
+func (l *Lexer) commentToken() token.Token {
+	p := l.position
+	if l.peekChar(0) != '[' {
+		for !l.atEOF() && l.ch != '\n' {
+			l.readChar()
+		}
+		return token.Token{Type: token.COMMENT, Literal: strings.TrimRight(l.source[p:l.position], "\r")}
+	}
+
+	l.readChar()
+	l.readChar()
+	for depth := 1; depth > 0; {
+		switch {
+		case l.atEOF():
+			return l.illegalToken("", "unterminated block comment, expected closing ]#")
+		case l.hasPrefix("#["):
+			depth++
+			l.readChar()
+			l.readChar()
+		case l.hasPrefix("]#"):
+			depth--
+			l.readChar()
+			l.readChar()
+		default:
+			l.readChar()
+		}
+	}
+
+	return token.Token{Type: token.COMMENT, Literal: l.source[p:l.position]}
+}
+
+// StringToken reads "..." strings, """...""" multi-line strings and `...` raw strings,
+// the literal of the token is the string value with escapes already processed
 func (l *Lexer) StringToken() token.Token {
+	if l.ch == '`' {
+		l.readChar()
+		return l.readString("raw string literal", "`", false, true)
+	}
+
+	if l.peekChar(0) == '"' && l.peekChar(1) == '"' {
+		l.readChar()
+		l.readChar()
+		l.readChar()
+		return l.readString("multi-line string literal", `"""`, true, true)
+	}
+
 	l.readChar()
+	return l.readString("string literal", `"`, true, false)
+}
+
+// readString reads up to and including the closing delimiter, the opening one is already read.
+// Reading goes on after a bad escape so the whole string is skipped, and the first problem is reported
+func (l *Lexer) readString(kind string, delimiter string, escapes bool, multiLine bool) token.Token {
+	var sb strings.Builder
+	var reason string
+	var reasonPos token.Position
+
+	for !l.hasPrefix(delimiter) {
+		if l.atEOF() || (!multiLine && l.ch == '\n') {
+			return l.illegalToken("", fmt.Sprintf("unterminated %s, expected closing %s", kind, delimiter))
+		}
+
+		pos := l.currPosition()
+		switch {
+		case l.invalidEncoding():
+			if reason == "" {
+				reason, reasonPos = fmt.Sprintf("invalid UTF-8 encoding in string: byte %#x", l.source[l.position]), pos
+			}
+			l.readChar()
+		case escapes && l.ch == '\\':
+			ch, escapeErr := l.readEscape()
+			if escapeErr != "" && reason == "" {
+				reason, reasonPos = escapeErr, pos
+			}
+			sb.WriteRune(ch)
+		case multiLine && l.ch == '\r' && l.peekChar(0) == '\n':
+			l.readChar() // crlf line endings are read as \n, like in the rest of the source
+		default:
+			sb.WriteRune(l.ch)
+			l.readChar()
+		}
+	}
+
+	for range delimiter {
+		l.readChar()
+	}
+
+	if reason != "" {
+		l.illegalPos = reasonPos
+		return l.illegalToken("", reason)
+	}
+	return token.Token{Type: token.STRING, Literal: sb.String()}
+}
+
+// readEscape reads an escape sequence starting at the backslash, and returns the char it stands for
+func (l *Lexer) readEscape() (rune, string) {
+	l.readChar() // \
+	if l.atEOF() || l.ch == '\n' || l.ch == '\r' {
+		return 0, "invalid escape sequence: '\\' at the end of a line"
+	}
+
+	ch := l.ch
+	l.readChar()
+	switch ch {
+	case 'n':
+		return '\n', ""
+	case 't':
+		return '\t', ""
+	case 'r':
+		return '\r', ""
+	case '0':
+		return 0, ""
+	case '"':
+		return '"', ""
+	case '\\':
+		return '\\', ""
+	case 'u':
+		return l.readUnicodeEscape()
+	}
+	return 0, fmt.Sprintf("invalid escape sequence '\\%c', valid escapes are \\n \\t \\r \\0 \\\" \\\\ and \\u{...}", ch)
+}
+
+// readUnicodeEscape reads the {1F600} part of \u{1F600}
+func (l *Lexer) readUnicodeEscape() (rune, string) {
+	if l.ch != '{' {
+		return 0, "invalid unicode escape: expected '{' after \\u"
+	}
+	l.readChar()
+
 	p := l.position
-	for l.readPosition <= len(l.source) && l.ch != '"' {
+	for isHexDigit(l.ch) {
 		l.readChar()
+	}
+	digits := l.source[p:l.position]
 
-		if l.ch == '\n' {
-			return token.Token{Type: token.ILLEGAL, Literal: ""}
+	if l.ch != '}' {
+		if l.atEOF() || l.ch == '\n' || l.ch == '"' || l.ch == '`' {
+			return 0, "unterminated unicode escape \\u{" + digits + ", expected closing }"
 		}
+		return 0, fmt.Sprintf("invalid unicode escape: %q is not a hexadecimal digit", l.ch)
 	}
+	l.readChar()
 
-	if l.ch == '"' {
-		l.readChar()
-	} else {
-		return token.Token{Type: token.ILLEGAL, Literal: ""} // checking for proper string termination
+	if digits == "" {
+		return 0, "invalid unicode escape \\u{}: missing hexadecimal digits"
+	}
+	if len(digits) > 6 {
+		return 0, "invalid unicode escape \\u{" + digits + "}: at most 6 hexadecimal digits are allowed"
 	}
 
-	return token.Token{Type: token.STRING, Literal: l.source[p : l.position-1]}
+	value, _ := strconv.ParseUint(digits, 16, 32)
+	if value > unicode.MaxRune || (value >= 0xD800 && value <= 0xDFFF) {
+		return 0, "invalid unicode escape \\u{" + digits + "}: not a valid code point"
+	}
+	return rune(value), ""
+}
+
+func (l *Lexer) atEOF() bool {
+	return l.position >= len(l.source)
+}
+
+func (l *Lexer) hasPrefix(s string) bool {
+	return !l.atEOF() && strings.HasPrefix(l.source[l.position:], s)
 }
 
 func (l *Lexer) specialToken() token.Token {
@@ -110,11 +341,125 @@ func (l *Lexer) specialToken() token.Token {
 }
 
 func (l *Lexer) NumberToken() token.Token {
+	// 0x, 0o and 0b integers
+	if l.ch == '0' && isBasePrefix(l.peekChar(0)) {
+		return l.prefixedIntegerToken()
+	}
+
 	p := l.position
-	for isNumber(l.ch) {
+	var tokenType token.TokenType = token.INT
+	l.readDigits()
+
+	// fraction, the dot has to be followed by a digit to be part of the number
+	if l.ch == '.' && isNumber(l.peekChar(0)) {
+		tokenType = token.FLOAT
+		l.readChar()
+		l.readDigits()
+	}
+
+	// exponent: e9, e+9, e-9
+	if l.ch == 'e' || l.ch == 'E' {
+		exponentPos := l.currPosition()
+		next := l.peekChar(0)
+		missingDigits := !isNumber(next) && !((next == '+' || next == '-') && isNumber(l.peekChar(1)))
+		tokenType = token.FLOAT
 		l.readChar()
+		if l.ch == '+' || l.ch == '-' {
+			l.readChar()
+		}
+
+		// reading every alphanumeric char, so 1e or 1ex are reported as a whole instead of a number and a name
+		if missingDigits {
+			for isLetter(l.ch) || isNumber(l.ch) {
+				l.readChar()
+			}
+			n := l.source[p:l.position]
+			l.illegalPos = exponentPos
+			return l.illegalToken(n, fmt.Sprintf("malformed float literal %s: missing exponent digits", n))
+		}
+		l.readDigits()
 	}
 
 	n := l.source[p:l.position]
+	if reason := separatorError(n, isNumber, 0); reason != "" {
+		return l.illegalToken(n, reason)
+	}
+
+	// 0755 used to silently be octal, the prefix makes it explicit
+	if tokenType == token.INT && len(strings.ReplaceAll(n, "_", "")) > 1 && n[0] == '0' {
+		return l.illegalToken(n, fmt.Sprintf("malformed number %s: leading zeros are not allowed, use 0o for octal", n))
+	}
+
+	return token.Token{Type: tokenType, Literal: n}
+}
+
+// readDigits reads decimal digits and the _ separators between them
+func (l *Lexer) readDigits() {
+	for isNumber(l.ch) || l.ch == '_' {
+		l.readChar()
+	}
+}
+
+func (l *Lexer) prefixedIntegerToken() token.Token {
+	p := l.position
+	l.readChar() // 0
+	prefix := l.ch
+	l.readChar()
+
+	// reading every alphanumeric char, so 0b102 or 0xFG are reported as a whole
+	for isLetter(l.ch) || isNumber(l.ch) {
+		l.readChar()
+	}
+
+	n := l.source[p:l.position]
+	name, isDigit := baseDigits(prefix)
+	digits := n[2:]
+	if strings.ReplaceAll(digits, "_", "") == "" {
+		return l.illegalToken(n, fmt.Sprintf("malformed %s literal %s: missing digits", name, n))
+	}
+
+	for _, ch := range digits {
+		if ch != '_' && !isDigit(ch) {
+			return l.illegalToken(n, fmt.Sprintf("malformed %s literal %s: invalid digit %q", name, n, ch))
+		}
+	}
+
+	if reason := separatorError(n, isDigit, 2); reason != "" {
+		return l.illegalToken(n, reason)
+	}
+
 	return token.Token{Type: token.INT, Literal: n}
 }
+
+// separatorError checks that every _ in a number sits between two digits,
+// a _ is also allowed right after a base prefix (0x_FF)
+func separatorError(n string, isDigit func(rune) bool, prefixLen int) string {
+	for i := 0; i < len(n); i++ {
+		if n[i] != '_' {
+			continue
+		}
+
+		afterPrefix := prefixLen != 0 && i == prefixLen
+		prevOk := i > 0 && (isDigit(rune(n[i-1])) || afterPrefix)
+		nextOk := i+1 < len(n) && isDigit(rune(n[i+1]))
+		if !prevOk || !nextOk {
+			return fmt.Sprintf("malformed number %s: '_' must separate successive digits", n)
+		}
+	}
+	return ""
+}
+
+// peekChar returns the char offset places after the next one, without moving
+func (l *Lexer) peekChar(offset int) rune {
+	p := l.readPosition
+	for ; offset > 0 && p < len(l.source); offset-- {
+		_, width := utf8.DecodeRuneInString(l.source[p:])
+		p += width
+	}
+
+	if p >= len(l.source) {
+		return 0
+	}
+	ch, _ := utf8.DecodeRuneInString(l.source[p:])
+	return ch
+}
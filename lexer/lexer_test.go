@@ -1,6 +1,7 @@
 package lexer
 
 import (
+	"main/benchmarks"
 	"main/token"
 	"testing"
 )
@@ -165,3 +166,404 @@ for
 		}
 	}
 }
+
+func TestGetNextTokenLoopKeywords(t *testing.T) {
+	input := "try catch finally const for (x in xs) { break; continue; } inside"
+
+	expected := []token.Token{
+		{Type: token.TRY, Literal: "try"},
+		{Type: token.CATCH, Literal: "catch"},
+		{Type: token.FINALLY, Literal: "finally"},
+		{Type: token.CONST, Literal: "const"},
+		{Type: token.FOR, Literal: "for"},
+		{Type: token.LPAREN, Literal: "("},
+		{Type: token.IDENTIFIER, Literal: "x"},
+		{Type: token.IN, Literal: "in"},
+		{Type: token.IDENTIFIER, Literal: "xs"},
+		{Type: token.RPAREN, Literal: ")"},
+		{Type: token.LBRACKET, Literal: "{"},
+		{Type: token.BREAK, Literal: "break"},
+		{Type: token.SEMICOLON, Literal: ";"},
+		{Type: token.CONTINUE, Literal: "continue"},
+		{Type: token.SEMICOLON, Literal: ";"},
+		{Type: token.RBRACKET, Literal: "}"},
+		{Type: token.IDENTIFIER, Literal: "inside"},
+		{Type: token.EOF, Literal: ""},
+	}
+
+	l := CreateLexer(input)
+	for i, et := range expected {
+		nt := l.GetNextToken()
+		if !(nt.Type == et.Type && nt.Literal == et.Literal) {
+			t.Fatalf("test[%d] - mismatch between expected and actual token - expected: %s, %s - actual: %s, %s", i, et.Type, et.Literal, nt.Type, nt.Literal)
+		}
+	}
+}
+
+func TestGetNextTokenPositions(t *testing.T) {
+	input := `let x = 5;
+  if (x) {
+	return "s";
+}`
+
+	expected := []struct {
+		literal string
+		line    int
+		column  int
+	}{
+		{"let", 1, 1},
+		{"x", 1, 5},
+		{"=", 1, 7},
+		{"5", 1, 9},
+		{";", 1, 10},
+		{"if", 2, 3},
+		{"(", 2, 6},
+		{"x", 2, 7},
+		{")", 2, 8},
+		{"{", 2, 10},
+		{"return", 3, 2},
+		{"s", 3, 9},
+		{";", 3, 12},
+		{"}", 4, 1},
+		{"", 4, 2},
+	}
+
+	l := CreateFileLexer("test.hy", input)
+	for i, et := range expected {
+		nt := l.GetNextToken()
+		want := token.Position{File: "test.hy", Line: et.line, Column: et.column}
+		if nt.Literal != et.literal || nt.Pos != want {
+			t.Fatalf("test[%d] - expected: %q at %s - actual: %q at %s", i, et.literal, want, nt.Literal, nt.Pos)
+		}
+	}
+}
+
+func TestGetNextTokenNumbers(t *testing.T) {
+	input := "3.14 10 1e-9 2.5E+3 7e2 1.x 5e"
+
+	expected := []token.Token{
+		{Type: token.FLOAT, Literal: "3.14"},
+		{Type: token.INT, Literal: "10"},
+		{Type: token.FLOAT, Literal: "1e-9"},
+		{Type: token.FLOAT, Literal: "2.5E+3"},
+		{Type: token.FLOAT, Literal: "7e2"},
+		{Type: token.INT, Literal: "1"},
+		{Type: token.ILLEGAL, Literal: "."},
+		{Type: token.IDENTIFIER, Literal: "x"},
+		{Type: token.ILLEGAL, Literal: "5e"},
+		{Type: token.EOF, Literal: ""},
+	}
+
+	l := CreateLexer(input)
+	for i, et := range expected {
+		nt := l.GetNextToken()
+		if !(nt.Type == et.Type && nt.Literal == et.Literal) {
+			t.Fatalf("test[%d] - mismatch between expected and actual token - expected: %s, %s - actual: %s, %s", i, et.Type, et.Literal, nt.Type, nt.Literal)
+		}
+	}
+}
+
+func TestGetNextTokenPrefixedNumbers(t *testing.T) {
+	input := "0xFF 0o755 0b1010 1_000_000 0x_dead_BEEF 0B1 3.141_592"
+
+	expected := []token.Token{
+		{Type: token.INT, Literal: "0xFF"},
+		{Type: token.INT, Literal: "0o755"},
+		{Type: token.INT, Literal: "0b1010"},
+		{Type: token.INT, Literal: "1_000_000"},
+		{Type: token.INT, Literal: "0x_dead_BEEF"},
+		{Type: token.INT, Literal: "0B1"},
+		{Type: token.FLOAT, Literal: "3.141_592"},
+		{Type: token.EOF, Literal: ""},
+	}
+
+	l := CreateLexer(input)
+	for i, et := range expected {
+		nt := l.GetNextToken()
+		if !(nt.Type == et.Type && nt.Literal == et.Literal) {
+			t.Fatalf("test[%d] - mismatch between expected and actual token - expected: %s, %s - actual: %s, %s", i, et.Type, et.Literal, nt.Type, nt.Literal)
+		}
+	}
+}
+
+func TestGetNextTokenMalformedNumbers(t *testing.T) {
+	tests := []struct {
+		input  string
+		reason string
+	}{
+		{"0x", "malformed hexadecimal literal 0x: missing digits"},
+		{"0b_", "malformed binary literal 0b_: missing digits"},
+		{"0b102", "malformed binary literal 0b102: invalid digit '2'"},
+		{"0o78", "malformed octal literal 0o78: invalid digit '8'"},
+		{"0xFG", "malformed hexadecimal literal 0xFG: invalid digit 'G'"},
+		{"0x1__2", "malformed number 0x1__2: '_' must separate successive digits"},
+		{"0xF_", "malformed number 0xF_: '_' must separate successive digits"},
+		{"1__000", "malformed number 1__000: '_' must separate successive digits"},
+		{"1000_", "malformed number 1000_: '_' must separate successive digits"},
+		{"1_.5", "malformed number 1_.5: '_' must separate successive digits"},
+		{"1e5_", "malformed number 1e5_: '_' must separate successive digits"},
+		{"1e", "malformed float literal 1e: missing exponent digits"},
+		{"2.5E+", "malformed float literal 2.5E+: missing exponent digits"},
+		{"1ex", "malformed float literal 1ex: missing exponent digits"},
+		{"0755", "malformed number 0755: leading zeros are not allowed, use 0o for octal"},
+		{"0_7", "malformed number 0_7: leading zeros are not allowed, use 0o for octal"},
+		{"^", "unexpected character \"^\""},
+	}
+
+	for i, tt := range tests {
+		l := CreateLexer(tt.input)
+		nt := l.GetNextToken()
+		if nt.Type != token.ILLEGAL {
+			t.Fatalf("test[%d] - expected ILLEGAL token for %q - got: %s, %s", i, tt.input, nt.Type, nt.Literal)
+		}
+
+		reason, ok := l.IllegalReason(nt.Pos)
+		if !ok || reason != tt.reason {
+			t.Fatalf("test[%d] - expected reason: %q - got: %q", i, tt.reason, reason)
+		}
+	}
+}
+
+// a malformed exponent is reported at the e, not where the number starts
+func TestGetNextTokenMalformedExponent(t *testing.T) {
+	l := CreateLexer("print(1e)")
+	for _, expected := range []token.TokenType{token.IDENTIFIER, token.LPAREN, token.ILLEGAL, token.RPAREN} {
+		nt := l.GetNextToken()
+		if nt.Type != expected {
+			t.Fatalf("expected: %s - got: %s, %s", expected, nt.Type, nt.Literal)
+		}
+		if nt.Type == token.ILLEGAL && (nt.Pos.Line != 1 || nt.Pos.Column != 8) {
+			t.Errorf("expected the error at 1:8 - got: %s", nt.Pos)
+		}
+	}
+}
+
+func TestGetNextTokenUnicode(t *testing.T) {
+	input := `let café = "héllo 😀";
+let 变量 = "中文"; नमस्ते_1 + x`
+
+	expected := []struct {
+		tokenType token.TokenType
+		literal   string
+		line      int
+		column    int
+	}{
+		{token.LET, "let", 1, 1},
+		{token.IDENTIFIER, "café", 1, 5},
+		{token.EQUAL, "=", 1, 10},
+		{token.STRING, "héllo 😀", 1, 12},
+		{token.SEMICOLON, ";", 1, 21},
+		{token.LET, "let", 2, 1},
+		{token.IDENTIFIER, "变量", 2, 5},
+		{token.EQUAL, "=", 2, 8},
+		{token.STRING, "中文", 2, 10},
+		{token.SEMICOLON, ";", 2, 14},
+		{token.IDENTIFIER, "नमस्ते_1", 2, 16},
+		{token.PLUS, "+", 2, 25},
+		{token.IDENTIFIER, "x", 2, 27},
+		{token.EOF, "", 2, 28},
+	}
+
+	l := CreateLexer(input)
+	for i, et := range expected {
+		nt := l.GetNextToken()
+		if nt.Type != et.tokenType || nt.Literal != et.literal || nt.Pos.Line != et.line || nt.Pos.Column != et.column {
+			t.Fatalf("test[%d] - expected: %s %q at %d:%d - actual: %s %q at %s", i, et.tokenType, et.literal, et.line, et.column, nt.Type, nt.Literal, nt.Pos)
+		}
+	}
+}
+
+func TestGetNextTokenIllegalUnicode(t *testing.T) {
+	tests := []struct {
+		input  string
+		reason string
+	}{
+		{"😀", "unexpected character \"😀\""},
+		{"\xff", "invalid UTF-8 encoding: byte 0xff"},
+		{"\"a\xffb\"", "invalid UTF-8 encoding in string: byte 0xff"},
+	}
+
+	for i, tt := range tests {
+		l := CreateLexer(tt.input)
+		nt := l.GetNextToken()
+		if nt.Type != token.ILLEGAL {
+			t.Fatalf("test[%d] - expected ILLEGAL token for %q - got: %s, %s", i, tt.input, nt.Type, nt.Literal)
+		}
+
+		reason, ok := l.IllegalReason(nt.Pos)
+		if !ok || reason != tt.reason {
+			t.Fatalf("test[%d] - expected reason: %q - got: %q", i, tt.reason, reason)
+		}
+	}
+}
+
+func TestGetNextTokenStrings(t *testing.T) {
+	input := "\"a\\nb\\tc\" \"say \\\"hi\\\"\" \"C:\\\\dir\" \"\\u{1F600} \\u{4e2d}\" \"\" " +
+		"`raw \\n ${x}` `two\nlines` `crlf\r\nline` \"\"\"multi\n\"line\"\\t\"\"\" \"\"\"\"\"\" 1"
+
+	expected := []token.Token{
+		{Type: token.STRING, Literal: "a\nb\tc"},
+		{Type: token.STRING, Literal: "say \"hi\""},
+		{Type: token.STRING, Literal: "C:\\dir"},
+		{Type: token.STRING, Literal: "😀 中"},
+		{Type: token.STRING, Literal: ""},
+		{Type: token.STRING, Literal: "raw \\n ${x}"},
+		{Type: token.STRING, Literal: "two\nlines"},
+		{Type: token.STRING, Literal: "crlf\nline"},
+		{Type: token.STRING, Literal: "multi\n\"line\"\t"},
+		{Type: token.STRING, Literal: ""},
+		{Type: token.INT, Literal: "1"},
+		{Type: token.EOF, Literal: ""},
+	}
+
+	l := CreateLexer(input)
+	for i, et := range expected {
+		nt := l.GetNextToken()
+		if !(nt.Type == et.Type && nt.Literal == et.Literal) {
+			t.Fatalf("test[%d] - mismatch between expected and actual token - expected: %s, %q - actual: %s, %q", i, et.Type, et.Literal, nt.Type, nt.Literal)
+		}
+	}
+}
+
+func TestGetNextTokenMalformedStrings(t *testing.T) {
+	tests := []struct {
+		input  string
+		reason string
+		line   int
+		column int
+	}{
+		{`"abc`, "unterminated string literal, expected closing \"", 1, 1},
+		{"x = \"abc\nd\"", "unterminated string literal, expected closing \"", 1, 5},
+		{"`abc", "unterminated raw string literal, expected closing `", 1, 1},
+		{"\"\"\"abc\n\"", "unterminated multi-line string literal, expected closing \"\"\"", 1, 1},
+		{`"ab\qc"`, "invalid escape sequence '\\q', valid escapes are \\n \\t \\r \\0 \\\" \\\\ and \\u{...}", 1, 4},
+		{"\"\"\"ok\n  \\x\"\"\"", "invalid escape sequence '\\x', valid escapes are \\n \\t \\r \\0 \\\" \\\\ and \\u{...}", 2, 3},
+		{`"\u1F600"`, "invalid unicode escape: expected '{' after \\u", 1, 2},
+		{`"\u{}"`, "invalid unicode escape \\u{}: missing hexadecimal digits", 1, 2},
+		{`"\u{12G4}"`, "invalid unicode escape: 'G' is not a hexadecimal digit", 1, 2},
+		{`"\u{1F600"`, "unterminated unicode escape \\u{1F600, expected closing }", 1, 2},
+		{`"\u{1234567}"`, "invalid unicode escape \\u{1234567}: at most 6 hexadecimal digits are allowed", 1, 2},
+		{`"\u{110000}"`, "invalid unicode escape \\u{110000}: not a valid code point", 1, 2},
+		{`"\u{D800}"`, "invalid unicode escape \\u{D800}: not a valid code point", 1, 2},
+		{"\"\"\"a\\\n\"\"\"", "invalid escape sequence: '\\' at the end of a line", 1, 5},
+	}
+
+	for i, tt := range tests {
+		l := CreateLexer(tt.input)
+		nt := l.GetNextToken()
+		for nt.Type != token.ILLEGAL && nt.Type != token.EOF {
+			nt = l.GetNextToken()
+		}
+		if nt.Type != token.ILLEGAL {
+			t.Fatalf("test[%d] - expected ILLEGAL token for %q", i, tt.input)
+		}
+
+		reason, ok := l.IllegalReason(nt.Pos)
+		if !ok || reason != tt.reason {
+			t.Fatalf("test[%d] - expected reason: %q - got: %q", i, tt.reason, reason)
+		}
+		if nt.Pos.Line != tt.line || nt.Pos.Column != tt.column {
+			t.Fatalf("test[%d] - expected error at %d:%d - got: %s", i, tt.line, tt.column, nt.Pos)
+		}
+	}
+}
+
+func TestGetNextTokenAfterMalformedString(t *testing.T) {
+	// the whole bad string is skipped, so lexing picks up right after it
+	l := CreateLexer(`"a\qb" + 1`)
+
+	expected := []token.TokenType{token.ILLEGAL, token.PLUS, token.INT, token.EOF}
+	for i, et := range expected {
+		nt := l.GetNextToken()
+		if nt.Type != et {
+			t.Fatalf("test[%d] - expected: %s - got: %s, %q", i, et, nt.Type, nt.Literal)
+		}
+	}
+}
+
+func TestGetNextTokenComments(t *testing.T) {
+	input := `# line comment
+let x = 1; # trailing
+#[ block
+   #[ nested ]# still in block
+]# x #[inline]# "# not a comment"
+#[]#`
+
+	skipped := []token.Token{
+		{Type: token.LET, Literal: "let"},
+		{Type: token.IDENTIFIER, Literal: "x"},
+		{Type: token.EQUAL, Literal: "="},
+		{Type: token.INT, Literal: "1"},
+		{Type: token.SEMICOLON, Literal: ";"},
+		{Type: token.IDENTIFIER, Literal: "x"},
+		{Type: token.STRING, Literal: "# not a comment"},
+		{Type: token.EOF, Literal: ""},
+	}
+
+	l := CreateLexer(input)
+	for i, et := range skipped {
+		nt := l.GetNextToken()
+		if !(nt.Type == et.Type && nt.Literal == et.Literal) {
+			t.Fatalf("test[%d] - mismatch between expected and actual token - expected: %s, %q - actual: %s, %q", i, et.Type, et.Literal, nt.Type, nt.Literal)
+		}
+	}
+
+	emitted := []struct {
+		tokenType token.TokenType
+		literal   string
+		line      int
+		column    int
+	}{
+		{token.COMMENT, "# line comment", 1, 1},
+		{token.LET, "let", 2, 1},
+		{token.IDENTIFIER, "x", 2, 5},
+		{token.EQUAL, "=", 2, 7},
+		{token.INT, "1", 2, 9},
+		{token.SEMICOLON, ";", 2, 10},
+		{token.COMMENT, "# trailing", 2, 12},
+		{token.COMMENT, "#[ block\n   #[ nested ]# still in block\n]#", 3, 1},
+		{token.IDENTIFIER, "x", 5, 4},
+		{token.COMMENT, "#[inline]#", 5, 6},
+		{token.STRING, "# not a comment", 5, 17},
+		{token.COMMENT, "#[]#", 6, 1},
+		{token.EOF, "", 6, 5},
+	}
+
+	l = CreateLexer(input)
+	l.EmitComments(true)
+	for i, et := range emitted {
+		nt := l.GetNextToken()
+		if nt.Type != et.tokenType || nt.Literal != et.literal || nt.Pos.Line != et.line || nt.Pos.Column != et.column {
+			t.Fatalf("test[%d] - expected: %s %q at %d:%d - actual: %s %q at %s", i, et.tokenType, et.literal, et.line, et.column, nt.Type, nt.Literal, nt.Pos)
+		}
+	}
+}
+
+func TestGetNextTokenUnterminatedComment(t *testing.T) {
+	l := CreateLexer("let x = 1;\n  #[ open #[ nested ]#\n")
+	nt := l.GetNextToken()
+	for nt.Type != token.ILLEGAL && nt.Type != token.EOF {
+		nt = l.GetNextToken()
+	}
+
+	reason, _ := l.IllegalReason(nt.Pos)
+	if nt.Type != token.ILLEGAL || reason != "unterminated block comment, expected closing ]#" {
+		t.Fatalf("expected unterminated block comment error - got: %s %q", nt.Type, reason)
+	}
+	if nt.Pos.Line != 2 || nt.Pos.Column != 3 {
+		t.Fatalf("expected error at 2:3 - got: %s", nt.Pos)
+	}
+}
+
+func BenchmarkLex(b *testing.B) {
+	for _, bench := range benchmarks.Corpus() {
+		b.Run(bench.Name, func(b *testing.B) {
+			b.SetBytes(int64(len(bench.Source)))
+			for i := 0; i < b.N; i++ {
+				l := CreateLexer(bench.Source)
+				for tok := l.GetNextToken(); tok.Type != token.EOF; tok = l.GetNextToken() {
+				}
+			}
+		})
+	}
+}
@@ -1,13 +1,47 @@
 package lexer
 
-func isLetter(ch byte) bool {
-	return (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || ch == '_'
+import "unicode"
+
+// isLetter is true for any unicode letter, so identifiers like café or 变量 are allowed
+func isLetter(ch rune) bool {
+	return unicode.IsLetter(ch) || ch == '_'
+}
+
+// isIdentifierChar is true for chars that may follow the first letter of an identifier,
+// combining marks are needed to write identifiers in scripts like Devanagari
+func isIdentifierChar(ch rune) bool {
+	return isNumber(ch) || unicode.IsDigit(ch) || unicode.In(ch, unicode.Mn, unicode.Mc)
 }
 
-func isNumber(ch byte) bool {
+// isNumber is ascii only, number literals are always written with 0-9
+func isNumber(ch rune) bool {
 	return ch >= '0' && ch <= '9'
 }
 
-func isWhitespace(ch byte) bool {
+func isWhitespace(ch rune) bool {
 	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r'
 }
+
+func isBasePrefix(ch rune) bool {
+	switch ch {
+	case 'x', 'X', 'o', 'O', 'b', 'B':
+		return true
+	}
+	return false
+}
+
+// baseDigits returns the name of the base a prefix stands for, and the digits it allows
+func baseDigits(prefix rune) (string, func(rune) bool) {
+	switch prefix {
+	case 'x', 'X':
+		return "hexadecimal", isHexDigit
+	case 'o', 'O':
+		return "octal", func(ch rune) bool { return ch >= '0' && ch <= '7' }
+	default:
+		return "binary", func(ch rune) bool { return ch == '0' || ch == '1' }
+	}
+}
+
+func isHexDigit(ch rune) bool {
+	return isNumber(ch) || (ch >= 'a' && ch <= 'f') || (ch >= 'A' && ch <= 'F')
+}
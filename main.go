@@ -8,118 +8,85 @@ import (
 	"os"
 	"os/user"
 
+	"main/diagnostics"
 	"main/evaluator"
 	"main/lexer"
-	"main/object"
 	"main/parser"
+	"main/repl"
 )
 
-// to do:
-// - support unicode
-// - add file name and line
-// - support float, hex, oct, bin numbers
-// - postfix in parser
-
-const PROMPT = ">> "
+var maxCallDepth int
+var limits evaluator.Limits
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		os.Exit(bench(os.Args[2:]))
+	}
+
 	var filepath string
 	flag.StringVar(&filepath, "file", "", "Specify entry point")
+	flag.IntVar(&maxCallDepth, "max-depth", evaluator.DefaultMaxCallDepth, "Maximum depth of nested calls, 0 for no limit")
+	flag.Int64Var(&limits.Steps, "max-steps", 0, "Maximum calls and loop iterations of a run, 0 for no limit")
+	flag.Int64Var(&limits.Elements, "max-elements", 0, "Maximum elements of the arrays, hashes and strings a run creates, 0 for no limit")
+	flag.BoolVar(&diagnostics.Verbose, "verbose-errors", false, "Show the full chain of what was being evaluated instead of a traceback on runtime errors")
+	flag.StringVar(&engine, "engine", "eval", "Engine that runs programs: eval walks the syntax tree, vm compiles to bytecode first")
 	flag.Parse()
 
-	evaluator.InitBuiltins() // initialize built-in functions
+	// the REPL and input() share one buffer, so neither reads ahead of the other
+	stdin := bufio.NewReader(os.Stdin)
+	run, err := newRunner(stdin, os.Stdout, os.Stderr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 
+	// the only place a script ends the process, exit() leaves the code to the caller of the interpreter
 	if filepath != "" {
-		interpretFile(filepath)
-	} else {
-		repl()
+		os.Exit(interpretFile(filepath, run, os.Stderr))
 	}
-
+	os.Exit(runRepl(stdin, os.Stdout, os.Stderr, run))
 }
 
-func interpretFile(filepath string) {
+// interpretFile runs a script file and returns the code the process exits with: the one the script
+// passed to exit(), 0 once it ran to the end and 1 if it could not be read, parsed or run.
+// Errors are reported to errOut, like the runner's problems
+func interpretFile(filepath string, run runner, errOut io.Writer) int {
 	bytes, err := os.ReadFile(filepath)
 	if err != nil {
-		fmt.Println("Error reading file:", err)
+		fmt.Fprintln(errOut, "Error reading file:", err)
+		return 1
 	}
 
-	data := removeHashComments(string(bytes)) // remove hash comments
-
 	// tokenizing
-	l := lexer.CreateLexer(data)
+	l := lexer.CreateFileLexer(filepath, string(bytes))
 
 	// parsing
 	p := parser.CreateParser(l)
 	program, errs := p.ParseProgram()
 	if len(errs) != 0 {
-		for _, e := range errs {
-			fmt.Println(e.Error())
-		}
-		return
+		diagnostics.WriteParserErrors(errOut, string(bytes), errs)
+		return 1
 	}
 
 	// interpreting
-	env := evaluator.NewEnvironment()
-	evaluator.Eval(program, env)
-}
-
-func repl() {
-	user, err := user.Current()
-	if err != nil {
-		panic(err)
+	_, evalErr := run(program)
+	if code, ok := evalErr.ExitCode(); ok {
+		return code
 	}
-	fmt.Printf("Hello %s! This is the Monkey programming language!\n", user.Username)
-	fmt.Printf("Feel free to type in commands\n")
-	StartRepl(os.Stdin, os.Stdout)
-}
-
-func StartRepl(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	env := evaluator.NewEnvironment()
-	for {
-		// prompt user for input
-		fmt.Print(PROMPT)
-
-		// reading user input
-		scanned := scanner.Scan()
-		if !scanned {
-			return
-		}
-		line := scanner.Text()
-		line = removeHashComments(line) // remove hash comments
-
-		// lexing
-		l := lexer.CreateLexer(line)
-
-		// parsing
-		p := parser.CreateParser(l)
-		program, errs := p.ParseProgram()
-		if len(errs) != 0 {
-			printParserErrors(out, errs)
-			continue
-		}
-
-		// interpreting
-		evaluated, err := evaluator.Eval(program, env)
-		if !err.Ok() {
-			if err.Type() == object.ERROR_OBJ {
-				io.WriteString(out, "Error: "+err.Inspect()+"\n")
-			} else {
-				io.WriteString(out, "Unknown error occurred\n")
-			}
-			continue
-		}
-
-		if evaluated != nil && evaluated.Type() != object.NULL_OBJ {
-			io.WriteString(out, evaluated.Inspect())
-			io.WriteString(out, "\n")
-		}
+	if !evalErr.Ok() {
+		io.WriteString(errOut, diagnostics.RuntimeError(diagnostics.Sources{filepath: string(bytes)}, evalErr))
+		return 1
 	}
+	return 0
 }
 
-func printParserErrors(out io.Writer, errors []error) {
-	for _, msg := range errors {
-		str := fmt.Sprintf("%v", msg)
-		io.WriteString(out, "\t"+str+"\n")
+func runRepl(in io.Reader, out io.Writer, errOut io.Writer, run runner) int {
+	// the greeting is not worth failing over, e.g. when running in a container without a passwd entry
+	name := "there"
+	if user, err := user.Current(); err == nil {
+		name = user.Username
 	}
+	fmt.Fprintf(out, "Hello %s! This is the Monkey programming language!\n", name)
+	fmt.Fprintf(out, "Feel free to type in commands\n")
+	return repl.Start(in, out, errOut, repl.Runner(run))
 }
@@ -1,12 +1,22 @@
 package object
 
 import (
+	"fmt"
 	"hash/fnv"
 	"main/ast"
+	"main/code"
+	"main/token"
+	"math"
 	"strconv"
 	"strings"
 )
 
+// Object is a value of the language.
+//
+// Integers, floats, booleans, strings, null and functions are immutable: operators
+// and builtins always return fresh objects, so variables that share one never see
+// each other change. Arrays and hashes are reference types: assigning one shares
+// it, and element assignment or push() is seen through every variable holding it.
 type Object interface {
 	Type() ObjectType
 	Inspect() string
@@ -37,6 +47,23 @@ func (i *IntegerObj) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+type FloatObj struct {
+	Value float64
+}
+
+func (f FloatObj) Type() ObjectType { return FLOAT_OBJ }
+func (f FloatObj) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	// always showing that it's a float, 3.0 shouldn't look like the int 3
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+func (f *FloatObj) HashKey() HashKey {
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
 type BooleanObj struct {
 	Value bool
 }
@@ -77,8 +104,11 @@ func (n NullObj) Type() ObjectType { return NULL_OBJ }
 func (n NullObj) Inspect() string  { return "null" }
 
 type FunctionObj struct {
+	Name       string // name of the variable the function was first bound to, empty if never bound
 	Parameters []string
+	ParamSlots []int // where each parameter goes in the scope of a call
 	Body       ast.BlockStatement
+	Env        interface{} // *evaluator.Environment the function was defined in (untyped to avoid an import cycle)
 }
 
 func (f FunctionObj) Type() ObjectType { return FUNCTION_OBJ }
@@ -86,6 +116,43 @@ func (f FunctionObj) Inspect() string {
 	return "fn(" + strings.Join(f.Parameters, ", ") + ")"
 }
 
+func (f FunctionObj) Arity() int { return len(f.Parameters) }
+
+// Callable is a function value builtins can call, whichever engine created it
+type Callable interface {
+	Object
+	Arity() int // how many arguments it takes, -1 for any number
+}
+
+// CompiledFunctionObj is a function literal compiled to bytecode, it lives in the constant pool
+// and becomes a value when a ClosureObj is made of it
+type CompiledFunctionObj struct {
+	Name         string // name of the variable the literal is bound to, empty if none
+	Parameters   []string
+	NumLocals    int // size of the scope of a call, the parameters come first
+	Instructions code.Instructions
+	SourceMap    code.SourceMap
+	CallSites    []code.CallSite
+}
+
+func (cf *CompiledFunctionObj) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunctionObj) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// ClosureObj is a compiled function along with the scope it was created in
+type ClosureObj struct {
+	Name string // as for FunctionObj
+	Fn   *CompiledFunctionObj
+	Env  interface{} // the vm scope the closure was created in (untyped to avoid an import cycle)
+}
+
+func (c *ClosureObj) Type() ObjectType { return FUNCTION_OBJ }
+func (c *ClosureObj) Inspect() string {
+	return "fn(" + strings.Join(c.Fn.Parameters, ", ") + ")"
+}
+func (c *ClosureObj) Arity() int { return len(c.Fn.Parameters) }
+
 type ArrayObj struct {
 	Elements []Object
 }
@@ -112,9 +179,42 @@ func (h HashObj) Inspect() string {
 	return "{" + strings.Join(pairs, ", ") + "}"
 }
 
+// ReturnObj carries a returned value while the evaluation unwinds up to the
+// closest function call (or the top of the program)
+type ReturnObj struct {
+	Value Object
+}
+
+func (r ReturnObj) Type() ObjectType { return RETURN_OBJ }
+func (r ReturnObj) Inspect() string  { return r.Value.Inspect() }
+
+// break and continue are not values, they are signals that unwind the
+// evaluation of blocks up to the closest enclosing loop
+type BreakObj struct{}
+
+func (b BreakObj) Type() ObjectType { return BREAK_OBJ }
+func (b BreakObj) Inspect() string  { return "break" }
+
+type ContinueObj struct{}
+
+func (c ContinueObj) Type() ObjectType { return CONTINUE_OBJ }
+func (c ContinueObj) Inspect() string  { return "continue" }
+
+// ErrorObj is a runtime error along with the errors that add context to it on the way up.
+// The error that was actually raised has a Kind, the ones wrapping it for context do not
 type ErrorObj struct {
 	Message   string
 	SubErrors []ErrorObj
+	Pos       token.Position // where in the source the error happened
+	Kind      string         // RUNTIME_ERROR, USER_ERROR, ... empty for context errors
+	Data      Object         // extra data attached by error(), nil if none
+	Stack     []Frame        // the calls the error was raised in, outermost first, nil at the top level
+}
+
+// Frame is a function call on the call stack
+type Frame struct {
+	Function string         // name of the function, <anonymous> for unnamed ones
+	CallSite token.Position // where the function was called from
 }
 
 func (e ErrorObj) Type() ObjectType { return ERROR_OBJ }
@@ -126,14 +226,152 @@ func (e ErrorObj) Inspect() string {
 	return output
 }
 func (e ErrorObj) Ok() bool {
-	return len(e.SubErrors) == 0 && e.Message == ""
+	return len(e.SubErrors) == 0 && e.Message == "" && e.Kind == ""
+}
+
+// At sets the position of the error, unless it already knows where it happened
+func (e ErrorObj) At(pos token.Position) ErrorObj {
+	if !e.Pos.IsValid() {
+		e.Pos = pos
+	}
+	return e
+}
+
+// RaisedAt sets the position of the raised error, unless it already knows where it happened.
+// For errors wrapped in context before the node that raised them could set its position
+func (e ErrorObj) RaisedAt(pos token.Position) ErrorObj {
+	if e.Kind != "" || len(e.SubErrors) == 0 {
+		return e.At(pos)
+	}
+	subErrors := append([]ErrorObj{e.SubErrors[0].RaisedAt(pos)}, e.SubErrors[1:]...)
+	e.SubErrors = subErrors
+	return e
 }
 
+// RootCause follows the first sub error down to the error that started the chain
+func (e ErrorObj) RootCause() ErrorObj {
+	if len(e.SubErrors) == 0 {
+		return e
+	}
+	return e.SubErrors[0].RootCause()
+}
+
+// Raised returns the error that was raised, skipping the context errors wrapping it.
+// A raised error's own sub errors are its cause
+func (e ErrorObj) Raised() ErrorObj {
+	if e.Kind != "" || len(e.SubErrors) == 0 {
+		return e
+	}
+	return e.SubErrors[0].Raised()
+}
+
+// CallStack returns the calls the raised error happened in, the stacks of its causes are not included.
+// The stack is kept on the raised error or the errors wrapping it
+func (e ErrorObj) CallStack() []Frame {
+	if e.Stack != nil || e.Kind != "" || len(e.SubErrors) == 0 {
+		return e.Stack
+	}
+	return e.SubErrors[0].CallStack()
+}
+
+// Location is where the raised error happened
+func (e ErrorObj) Location() token.Position {
+	raised := e.Raised()
+	if raised.Pos.IsValid() {
+		return raised.Pos
+	}
+	return raised.Position()
+}
+
+// Position returns the most precise known position, the deepest one along the root cause chain
+func (e ErrorObj) Position() token.Position {
+	if len(e.SubErrors) > 0 {
+		if pos := e.SubErrors[0].Position(); pos.IsValid() {
+			return pos
+		}
+	}
+	return e.Pos
+}
+
+// NewErrorObj creates an error, without sub errors it is a newly raised runtime error,
+// with sub errors it adds context to them
 func NewErrorObj(message string, subErrors ...ErrorObj) ErrorObj {
-	return ErrorObj{
+	err := ErrorObj{
 		Message:   message,
 		SubErrors: subErrors,
 	}
+	if len(subErrors) == 0 {
+		err.Kind = RUNTIME_ERROR
+	}
+	return err
+}
+
+// NewExitErrorObj creates the error exit() ends a program with, it unwinds every call and only runs finally blocks
+func NewExitErrorObj(code int64) ErrorObj {
+	return ErrorObj{
+		Message: "exit with code " + strconv.FormatInt(code, 10),
+		Kind:    EXIT,
+		Data:    &IntegerObj{Value: code},
+	}
+}
+
+// ExitCode returns the code a program passed to exit(), false for errors that are not an exit
+func (e ErrorObj) ExitCode() (int, bool) {
+	raised := e.Raised()
+	if raised.Kind != EXIT {
+		return 0, false
+	}
+	code, _ := raised.Data.(*IntegerObj)
+	if code == nil {
+		return 0, true
+	}
+	return int(code.Value), true
+}
+
+// Catchable reports whether a try statement may catch the error
+func (e ErrorObj) Catchable() bool {
+	return e.Raised().Kind != EXIT
+}
+
+// ErrorValueObj is a caught error, scripts read its fields by indexing it with a string
+type ErrorValueObj struct {
+	Err ErrorObj
+}
+
+func (ev *ErrorValueObj) Type() ObjectType { return ERROR_VALUE_OBJ }
+func (ev *ErrorValueObj) Inspect() string {
+	raised := ev.Err.Raised()
+	return raised.Kind + ": " + raised.Message
+}
+
+// Field returns message, kind, data, cause, file, line or column of the raised error.
+// The cause is the error passed to error() along with a message, null for any other error
+func (ev *ErrorValueObj) Field(name string) (Object, bool) {
+	raised := ev.Err.Raised()
+	pos := ev.Err.Location()
+	switch name {
+	case "message":
+		return &StringObj{Value: raised.Message}, true
+	case "kind":
+		return &StringObj{Value: raised.Kind}, true
+	case "data":
+		if raised.Data == nil {
+			return &NullObj{}, true
+		}
+		return raised.Data, true
+	case "cause":
+		if len(raised.SubErrors) == 0 {
+			return &NullObj{}, true
+		}
+		return &ErrorValueObj{Err: raised.SubErrors[0]}, true
+	case "file":
+		return &StringObj{Value: pos.File}, true
+	case "line":
+		return &IntegerObj{Value: int64(pos.Line)}, true
+	case "column":
+		return &IntegerObj{Value: int64(pos.Column)}, true
+	}
+	return nil, false
 }
 
 func EmptyErrorObj() ErrorObj {
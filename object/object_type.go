@@ -3,13 +3,33 @@ package object
 type ObjectType string
 
 const (
-	ERROR_OBJ    = "ERROR_OBJ"   // error object
-	INT_OBJ      = "INT_OBJ"     // integers: 1,2,3,...
-	BOOLEAN_OBJ  = "BOOLEAN_OBJ" // true or false
-	NULL_OBJ     = "NULL_OBJ"
-	FUNCTION_OBJ = "FUNCTION_OBJ" // function object
-	BUILTIN_OBJ  = "BUILTIN_OBJ"  // built-in function object
-	STRING_OBJ   = "STRING_OBJ"   // "hello"
-	ARRAY_OBJ    = "ARRAY_OBJ"    // [1,2,3]
-	HASH_OBJ     = "HASH_OBJ"     // {"key": "value"}
+	ERROR_OBJ             = "ERROR_OBJ"   // error object
+	INT_OBJ               = "INT_OBJ"     // integers: 1,2,3,...
+	FLOAT_OBJ             = "FLOAT_OBJ"   // floating point: 3.14
+	BOOLEAN_OBJ           = "BOOLEAN_OBJ" // true or false
+	NULL_OBJ              = "NULL_OBJ"
+	FUNCTION_OBJ          = "FUNCTION_OBJ"          // function object
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION_OBJ" // bytecode of a function literal
+	BUILTIN_OBJ           = "BUILTIN_OBJ"           // built-in function object
+	STRING_OBJ            = "STRING_OBJ"            // "hello"
+	ARRAY_OBJ             = "ARRAY_OBJ"             // [1,2,3]
+	HASH_OBJ              = "HASH_OBJ"              // {"key": "value"}
+	BREAK_OBJ             = "BREAK_OBJ"             // break signal
+	CONTINUE_OBJ          = "CONTINUE_OBJ"          // continue signal
+	RETURN_OBJ            = "RETURN_OBJ"            // return signal wrapping the returned value
+	TAIL_CALL_OBJ         = "TAIL_CALL_OBJ"         // a call in return position, made by the caller instead
+	ITERATOR_OBJ          = "ITERATOR_OBJ"          // the items a for-in loop of the vm has left
+	COMPLETION_OBJ        = "COMPLETION_OBJ"        // what a finally block of the vm carries on with once done
+
+	ERROR_VALUE_OBJ = "ERROR_VALUE_OBJ" // a caught error, as seen by scripts
+)
+
+// kinds of raised errors, scripts see them in the kind field of caught errors
+const (
+	RUNTIME_ERROR   = "RuntimeError"   // raised by the interpreter
+	USER_ERROR      = "Error"          // raised by a script with error()
+	INTERNAL_ERROR  = "InternalError"  // a bug in the interpreter, never caught by scripts
+	RECURSION_ERROR = "RecursionError" // calls nested deeper than the maximum call depth
+	EXIT            = "Exit"           // exit() ending the program, never caught by scripts
+	LIMIT_ERROR     = "LimitError"     // a run used up its steps or elements, or was cancelled
 )
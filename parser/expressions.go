@@ -1,7 +1,6 @@
 package parser
 
 import (
-	"fmt"
 	"main/ast"
 	"main/token"
 	"strconv"
@@ -13,14 +12,14 @@ func (p *Parser) parseExpression(precedence int) (ast.Expression, []error) {
 
 	if p.currTokenIsLegalPrefix() {
 		exp, errs = p.parsePrefixExpression()
-	} else if p.currTokenIs(token.IDENTIFIER) && p.peekTokenIs(token.LPAREN) {
-		exp, errs = p.parseCallExpression()
 	} else if p.currTokenIs(token.IDENTIFIER) {
 		exp = p.parseIdentifierExpression()
 	} else if p.currTokenIs(token.BOOLEAN) {
 		exp = p.parseBooleanExpression()
 	} else if p.currTokenIs(token.INT) {
 		exp, errs = p.parseIntExpression()
+	} else if p.currTokenIs(token.FLOAT) {
+		exp, errs = p.parseFloatExpression()
 	} else if p.currTokenIs(token.STRING) {
 		exp = p.parseStringExpression()
 	} else if p.currTokenIs(token.LPAREN) {
@@ -33,17 +32,30 @@ func (p *Parser) parseExpression(precedence int) (ast.Expression, []error) {
 		exp, errs = p.parseArrayExpression()
 	} else if p.currTokenIs(token.LBRACKET) {
 		exp, errs = p.ParseHashExpression()
+	} else if p.currTokenIs(token.ILLEGAL) {
+		return nil, []error{p.illegalTokenError()}
 	} else {
-		return nil, []error{fmt.Errorf("error - expected: expression - got: %s", p.currToken.Type)}
+		return nil, []error{p.errorf("error - expected: expression - got: %s", p.currToken.Type)}
 	}
 	if len(errs) != 0 {
 		return nil, errs
 	}
 
-	for IsLegalInfixOperator(p.peekToken.Type) && precedence < p.peekPrecedence() {
-		exp, errs = p.parseInfixExpression(exp)
-		if len(errs) != 0 {
-			return nil, errs
+	for precedence < p.peekPrecedence() {
+		if IsLegalPostfixOperator(p.peekToken.Type) {
+			// x++ only makes sense on something assignable, otherwise the ++ belongs
+			// to the next statement (e.g. `if (x) { y } ++z`)
+			if !isAssignable(exp) {
+				break
+			}
+			exp = p.parsePostfixExpression(exp)
+		} else if IsLegalInfixOperator(p.peekToken.Type) {
+			exp, errs = p.parseInfixExpression(exp)
+			if len(errs) != 0 {
+				return nil, errs
+			}
+		} else {
+			break
 		}
 	}
 
@@ -65,20 +77,19 @@ func (p *Parser) parsePrefixExpression() (ast.PrefixExpression, []error) {
 	}, nil
 }
 
-func (p *Parser) parseCallExpression() (ast.CallExpression, []error) {
-	identifier := p.parseIdentifierExpression()
-	p.nextToken()
+func (p *Parser) parseCallExpression(function ast.Expression) (ast.CallExpression, []error) {
+	lparen := p.currToken
 	p.nextToken()
 
-	args, errs := p.parseExpressionList(token.RPAREN) // Fixed typo: Seperated -> Separated
+	args, errs := p.parseExpressionList(token.RPAREN)
 	if len(errs) != 0 {
 		return ast.CallExpression{}, errs
 	}
 
 	return ast.CallExpression{
-		Token:      identifier.Token,
-		Identifier: identifier,
-		Args:       args,
+		Token:    lparen,
+		Function: function,
+		Args:     args,
 	}, nil
 }
 
@@ -94,12 +105,20 @@ func (p *Parser) parseIntExpression() (ast.IntExpression, []error) {
 	// checking if it's parsable first
 	_, err := strconv.ParseInt(p.currToken.Literal, 0, 64)
 	if err != nil {
-		return ast.IntExpression{}, []error{fmt.Errorf("error - could not parse %q as integer", p.currToken.Literal)}
+		return ast.IntExpression{}, []error{p.errorf("error - could not parse %q as integer", p.currToken.Literal)}
 	}
 
-	return ast.IntExpression{
-		Token: token.Token{Type: token.INT, Literal: p.currToken.Literal},
-	}, nil
+	return ast.IntExpression{Token: p.currToken}, nil
+}
+
+func (p *Parser) parseFloatExpression() (ast.FloatExpression, []error) {
+	// checking if it's parsable first
+	_, err := strconv.ParseFloat(p.currToken.Literal, 64)
+	if err != nil {
+		return ast.FloatExpression{}, []error{p.errorf("error - could not parse %q as float", p.currToken.Literal)}
+	}
+
+	return ast.FloatExpression{Token: p.currToken}, nil
 }
 
 func (p *Parser) parseStringExpression() ast.StringExpression {
@@ -143,9 +162,15 @@ func (p *Parser) ParseIfExpression() (ast.IfExpression, []error) {
 			return ast.IfExpression{}, errs
 		}
 		blocks = append(blocks, b)
+
+		// only step past the closing bracket when there is an else branch,
+		// otherwise the token after the if belongs to whatever comes next
+		if !p.peekTokenIs(token.ELSE) {
+			break
+		}
 		p.nextToken()
 
-		if !(p.currTokenIs(token.ELSE) && p.peekTokenIs(token.IF)) {
+		if !p.peekTokenIs(token.IF) {
 			break
 		}
 		p.nextToken()
@@ -185,6 +210,14 @@ func (p *Parser) parseInfixExpression(left ast.Expression) (ast.Expression, []er
 		return right, nil
 	}
 
+	if operator.Type == token.LPAREN {
+		return p.parseCallExpression(left)
+	}
+
+	if IsAssignmentOperator(operator.Type) {
+		return p.parseAssignExpression(left)
+	}
+
 	p.nextToken()
 	right, errs = p.parseExpression(precedence)
 	if len(errs) != 0 {
@@ -198,6 +231,34 @@ func (p *Parser) parseInfixExpression(left ast.Expression) (ast.Expression, []er
 	}, nil
 }
 
+func (p *Parser) parsePostfixExpression(left ast.Expression) ast.PostfixExpression {
+	p.nextToken()
+	return ast.PostfixExpression{
+		Token:      p.currToken,
+		Expression: left,
+	}
+}
+
+func (p *Parser) parseAssignExpression(target ast.Expression) (ast.Expression, []error) {
+	operator := p.currToken
+	if !isAssignable(target) {
+		return nil, []error{errorAt(target.Pos(), "error - invalid assignment target: %s", target.String())}
+	}
+	p.nextToken()
+
+	// parsing with a lower precedence makes assignment right associative: a = b = c is a = (b = c)
+	value, errs := p.parseExpression(ASSIGN - 1)
+	if len(errs) != 0 {
+		return nil, errs
+	}
+
+	return ast.AssignExpression{
+		Token:  operator,
+		Target: target,
+		Value:  value,
+	}, nil
+}
+
 func (p *Parser) parseFunctionExpression() (ast.FunctionExpression, []error) {
 	fn := p.currToken
 	p.nextToken()
@@ -230,7 +291,6 @@ func (p *Parser) parseFunctionExpression() (ast.FunctionExpression, []error) {
 	p.nextToken()
 
 	body, err := p.ParseBlockStatement()
-	p.nextToken()
 	if len(err) != 0 {
 		return ast.FunctionExpression{}, err
 	}
@@ -295,6 +355,10 @@ func (p *Parser) parseExpressionList(terminationToken token.TokenType) ([]ast.Ex
 		p.nextToken()
 	}
 
+	if !p.currTokenIs(terminationToken) {
+		return nil, []error{p.badTokenTypeError(terminationToken)}
+	}
+
 	return args, nil
 }
 
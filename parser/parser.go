@@ -6,15 +6,32 @@ import (
 	"main/token"
 )
 
+// Mode controls optional parser features
+type Mode uint
+
+const (
+	// ParseComments keeps comments in the AST, attached to the statements around them
+	ParseComments Mode = 1 << iota
+)
+
 type Parser struct {
-	l *lexer.Lexer
+	l    *lexer.Lexer
+	mode Mode
 
+	prevToken token.Token
 	currToken token.Token
 	peekToken token.Token
+
+	comments []ast.Comment // read but not yet attached to a statement
 }
 
 func CreateParser(l *lexer.Lexer) Parser {
-	p := Parser{l: l}
+	return CreateParserWithMode(l, 0)
+}
+
+func CreateParserWithMode(l *lexer.Lexer, mode Mode) Parser {
+	p := Parser{l: l, mode: mode}
+	l.EmitComments(mode&ParseComments != 0)
 
 	// loading tokens into curr and peek
 	p.nextToken()
@@ -24,23 +41,37 @@ func CreateParser(l *lexer.Lexer) Parser {
 }
 
 func (p *Parser) nextToken() {
+	p.prevToken = p.currToken
 	p.currToken = p.peekToken
 	p.peekToken = p.l.GetNextToken()
+
+	// comments are put aside, statements pick them up by position
+	for p.peekToken.Type == token.COMMENT {
+		p.comments = append(p.comments, ast.Comment{Token: p.peekToken})
+		p.peekToken = p.l.GetNextToken()
+	}
 }
 
 func (p *Parser) ParseProgram() (ast.Program, []error) {
 	statements := []ast.Statement{}
+	comments := []ast.StatementComments{}
 	errors := []error{}
 
 	for !p.currTokenIs(token.EOF) {
-		s, errs := p.ParseStatement()
+		s, c, errs := p.parseStatementWithComments()
 		if s != nil {
 			statements = append(statements, s)
+			comments = append(comments, c)
 		}
 		errors = append(errors, errs...)
 	}
 
-	return ast.Program{Statements: statements}, errors
+	program := ast.Program{Statements: statements}
+	if p.mode&ParseComments != 0 {
+		program.Comments = comments
+		program.EndComments = p.takeComments(p.currToken.Pos, p.currToken.Pos.Line)
+	}
+	return program, errors
 }
 
 func (p *Parser) ParseBlockStatement() (ast.BlockStatement, []error) {
@@ -51,19 +82,54 @@ func (p *Parser) ParseBlockStatement() (ast.BlockStatement, []error) {
 	p.nextToken()
 
 	statements := []ast.Statement{}
+	comments := []ast.StatementComments{}
 	errors := []error{}
 	for !(p.currTokenIs(token.EOF) || p.currTokenIs(token.RBRACKET)) {
-		s, errs := p.ParseStatement()
+		s, c, errs := p.parseStatementWithComments()
 		if s != nil {
 			statements = append(statements, s)
+			comments = append(comments, c)
 		}
 		errors = append(errors, errs...)
 	}
 
-	return ast.BlockStatement{
+	block := ast.BlockStatement{
 		Token:      t,
 		Statements: statements,
-	}, errors
+	}
+	if p.mode&ParseComments != 0 {
+		block.Comments = comments
+		block.EndComments = p.takeComments(p.currToken.Pos, p.currToken.Pos.Line)
+	}
+	return block, errors
+}
+
+// parseStatementWithComments parses a statement along with the comments before it,
+// and the ones after it up to the end of its last line
+func (p *Parser) parseStatementWithComments() (ast.Statement, ast.StatementComments, []error) {
+	var c ast.StatementComments
+	c.Leading = p.takeComments(p.currToken.Pos, p.currToken.Pos.Line)
+
+	s, errs := p.ParseStatement()
+
+	// prevToken is the last token of the statement, and currToken the start of the next one
+	c.Trailing = p.takeComments(p.currToken.Pos, p.prevToken.Pos.Line)
+	return s, c, errs
+}
+
+// takeComments removes and returns the pending comments that start before pos, on line or earlier
+func (p *Parser) takeComments(pos token.Position, line int) []ast.Comment {
+	var taken, rest []ast.Comment
+	for _, c := range p.comments {
+		if c.Pos().Before(pos) && c.Pos().Line <= line {
+			taken = append(taken, c)
+		} else {
+			rest = append(rest, c)
+		}
+	}
+
+	p.comments = rest
+	return taken
 }
 
 func (p *Parser) ParseStatement() (ast.Statement, []error) {
@@ -71,10 +137,18 @@ func (p *Parser) ParseStatement() (ast.Statement, []error) {
 	var errs []error // this is bad
 
 	// Parsing the statement
-	if p.currTokenIs(token.LET) {
+	if p.currTokenIs(token.LET) || p.currTokenIs(token.CONST) {
 		s, errs = p.parseLetStatement()
 	} else if p.currTokenIs(token.RETURN) {
 		s, errs = p.parseReturnStatement()
+	} else if p.currTokenIs(token.FOR) {
+		s, errs = p.parseForStatement()
+	} else if p.currTokenIs(token.TRY) {
+		s, errs = p.parseTryStatement()
+	} else if p.currTokenIs(token.BREAK) {
+		s = p.parseBreakStatement()
+	} else if p.currTokenIs(token.CONTINUE) {
+		s = p.parseContinueStatement()
 	} else {
 		s, errs = p.parseExpressionStatement()
 	}
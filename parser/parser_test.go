@@ -1,9 +1,9 @@
 package parser
 
 import (
-	"errors"
 	"fmt"
 	"main/ast"
+	"main/benchmarks"
 	"main/lexer"
 	"main/token"
 	"reflect"
@@ -15,7 +15,8 @@ func TestLetStatement(t *testing.T) {
 let y = 5;
 let xyz = true;
 let zyx = false;
-let exp = 5 + 10 * 12;`
+let exp = 5 + 10 * 12;
+const c = 1;`
 	l := lexer.CreateLexer(input)
 	p := CreateParser(l)
 
@@ -27,62 +28,71 @@ let exp = 5 + 10 * 12;`
 	expectedProg := ast.Program{
 		Statements: []ast.Statement{
 			ast.LetStatement{
-				Token: token.Token{Type: token.LET, Literal: "let"},
+				Token: token.Token{Type: token.LET, Literal: "let", Pos: pos(1, 1)},
 				Identifier: ast.IdentifierExpression{
-					Token: token.Token{Type: token.IDENTIFIER, Literal: "x"},
+					Token: token.Token{Type: token.IDENTIFIER, Literal: "x", Pos: pos(1, 5)},
 				},
 				Expression: ast.IntExpression{
-					Token: token.Token{Type: token.INT, Literal: "10"},
+					Token: token.Token{Type: token.INT, Literal: "10", Pos: pos(1, 9)},
 				},
 			},
 			ast.LetStatement{
-				Token: token.Token{Type: token.LET, Literal: "let"},
+				Token: token.Token{Type: token.LET, Literal: "let", Pos: pos(2, 1)},
 				Identifier: ast.IdentifierExpression{
-					Token: token.Token{Type: token.IDENTIFIER, Literal: "y"},
+					Token: token.Token{Type: token.IDENTIFIER, Literal: "y", Pos: pos(2, 5)},
 				},
 				Expression: ast.IntExpression{
-					Token: token.Token{Type: token.INT, Literal: "5"},
+					Token: token.Token{Type: token.INT, Literal: "5", Pos: pos(2, 9)},
 				},
 			},
 			ast.LetStatement{
-				Token: token.Token{Type: token.LET, Literal: "let"},
+				Token: token.Token{Type: token.LET, Literal: "let", Pos: pos(3, 1)},
 				Identifier: ast.IdentifierExpression{
-					Token: token.Token{Type: token.IDENTIFIER, Literal: "xyz"},
+					Token: token.Token{Type: token.IDENTIFIER, Literal: "xyz", Pos: pos(3, 5)},
 				},
 				Expression: ast.BooleanExpression{
-					Token: token.Token{Type: token.BOOLEAN, Literal: "true"},
+					Token: token.Token{Type: token.BOOLEAN, Literal: "true", Pos: pos(3, 11)},
 				},
 			},
 			ast.LetStatement{
-				Token: token.Token{Type: token.LET, Literal: "let"},
+				Token: token.Token{Type: token.LET, Literal: "let", Pos: pos(4, 1)},
 				Identifier: ast.IdentifierExpression{
-					Token: token.Token{Type: token.IDENTIFIER, Literal: "zyx"},
+					Token: token.Token{Type: token.IDENTIFIER, Literal: "zyx", Pos: pos(4, 5)},
 				},
 				Expression: ast.BooleanExpression{
-					Token: token.Token{Type: token.BOOLEAN, Literal: "false"},
+					Token: token.Token{Type: token.BOOLEAN, Literal: "false", Pos: pos(4, 11)},
 				},
 			},
 			ast.LetStatement{
-				Token: token.Token{Type: token.LET, Literal: "let"},
+				Token: token.Token{Type: token.LET, Literal: "let", Pos: pos(5, 1)},
 				Identifier: ast.IdentifierExpression{
-					Token: token.Token{Type: token.IDENTIFIER, Literal: "exp"},
+					Token: token.Token{Type: token.IDENTIFIER, Literal: "exp", Pos: pos(5, 5)},
 				},
 				Expression: ast.InfixExpression{
-					Token: token.Token{Type: token.PLUS, Literal: "+"},
+					Token: token.Token{Type: token.PLUS, Literal: "+", Pos: pos(5, 13)},
 					Left: ast.IntExpression{
-						Token: token.Token{Type: token.INT, Literal: "5"},
+						Token: token.Token{Type: token.INT, Literal: "5", Pos: pos(5, 11)},
 					},
 					Right: ast.InfixExpression{
-						Token: token.Token{Type: token.ASTERISK, Literal: "*"},
+						Token: token.Token{Type: token.ASTERISK, Literal: "*", Pos: pos(5, 18)},
 						Left: ast.IntExpression{
-							Token: token.Token{Type: token.INT, Literal: "10"},
+							Token: token.Token{Type: token.INT, Literal: "10", Pos: pos(5, 15)},
 						},
 						Right: ast.IntExpression{
-							Token: token.Token{Type: token.INT, Literal: "12"},
+							Token: token.Token{Type: token.INT, Literal: "12", Pos: pos(5, 20)},
 						},
 					},
 				},
 			},
+			ast.LetStatement{
+				Token: token.Token{Type: token.CONST, Literal: "const", Pos: pos(6, 1)},
+				Identifier: ast.IdentifierExpression{
+					Token: token.Token{Type: token.IDENTIFIER, Literal: "c", Pos: pos(6, 7)},
+				},
+				Expression: ast.IntExpression{
+					Token: token.Token{Type: token.INT, Literal: "1", Pos: pos(6, 11)},
+				},
+			},
 		},
 	}
 
@@ -103,19 +113,23 @@ func TestLetStatementErrors(t *testing.T) {
  let 838383;
  let false = true;
  let let = let;
- let wrong = let;`
+ let wrong = let;
+ const 5 = 1;
+ const c;`
 	l := lexer.CreateLexer(input)
 	p := CreateParser(l)
 
 	prog, err := p.ParseProgram()
 
 	expectedErr := []error{
-		errors.New("error - expected: = - got: INT"),
-		errors.New("error - expected: IDENTIFIER - got: ="),
-		errors.New("error - expected: IDENTIFIER - got: INT"),
-		errors.New("error - expected: IDENTIFIER - got: BOOLEAN"),
-		errors.New("error - expected: IDENTIFIER - got: LET"),
-		errors.New("error - expected: expression - got: LET"),
+		Error{Pos: pos(1, 7), Message: "error - expected: = - got: INT"},
+		Error{Pos: pos(2, 6), Message: "error - expected: IDENTIFIER - got: ="},
+		Error{Pos: pos(3, 6), Message: "error - expected: IDENTIFIER - got: INT"},
+		Error{Pos: pos(4, 6), Message: "error - expected: IDENTIFIER - got: BOOLEAN"},
+		Error{Pos: pos(5, 6), Message: "error - expected: IDENTIFIER - got: LET"},
+		Error{Pos: pos(6, 14), Message: "error - expected: expression - got: LET"},
+		Error{Pos: pos(7, 8), Message: "error - expected: IDENTIFIER - got: INT"},
+		Error{Pos: pos(8, 9), Message: "error - expected: = - got: ;"},
 	}
 
 	errorCount := len(expectedErr)
@@ -162,19 +176,19 @@ return;`
 	expectedProg := ast.Program{
 		Statements: []ast.Statement{
 			ast.ReturnStatement{
-				Token: token.Token{Type: token.RETURN, Literal: "return"},
+				Token: token.Token{Type: token.RETURN, Literal: "return", Pos: pos(1, 1)},
 				Expression: ast.IntExpression{
-					Token: token.Token{Type: token.INT, Literal: "10"},
+					Token: token.Token{Type: token.INT, Literal: "10", Pos: pos(1, 8)},
 				},
 			},
 			ast.ReturnStatement{
-				Token: token.Token{Type: token.RETURN, Literal: "return"},
+				Token: token.Token{Type: token.RETURN, Literal: "return", Pos: pos(2, 1)},
 				Expression: ast.IdentifierExpression{
-					Token: token.Token{Type: token.IDENTIFIER, Literal: "xyz"},
+					Token: token.Token{Type: token.IDENTIFIER, Literal: "xyz", Pos: pos(2, 8)},
 				},
 			},
 			ast.ReturnStatement{
-				Token:      token.Token{Type: token.RETURN, Literal: "return"},
+				Token:      token.Token{Type: token.RETURN, Literal: "return", Pos: pos(3, 1)},
 				Expression: nil,
 			},
 		},
@@ -193,7 +207,7 @@ func TestReturnStatementErrors(t *testing.T) {
 	prog, err := p.ParseProgram()
 
 	expectedErr := []error{
-		errors.New("error - expected: expression - got: ="),
+		Error{Pos: pos(1, 8), Message: "error - expected: expression - got: ="},
 	}
 
 	errorCount := len(expectedErr)
@@ -235,15 +249,15 @@ func TestBasicExpressionStatements(t *testing.T) {
 	expectedProg := ast.Program{
 		Statements: []ast.Statement{
 			ast.ExpressionStatement{
-				Token: token.Token{Type: token.IDENTIFIER, Literal: "foobar"},
+				Token: token.Token{Type: token.IDENTIFIER, Literal: "foobar", Pos: pos(1, 1)},
 				Expression: ast.IdentifierExpression{
-					Token: token.Token{Type: token.IDENTIFIER, Literal: "foobar"},
+					Token: token.Token{Type: token.IDENTIFIER, Literal: "foobar", Pos: pos(1, 1)},
 				},
 			},
 			ast.ExpressionStatement{
-				Token: token.Token{Type: token.INT, Literal: "5"},
+				Token: token.Token{Type: token.INT, Literal: "5", Pos: pos(2, 1)},
 				Expression: ast.IntExpression{
-					Token: token.Token{Type: token.INT, Literal: "5"},
+					Token: token.Token{Type: token.INT, Literal: "5", Pos: pos(2, 1)},
 				},
 			},
 		},
@@ -275,38 +289,38 @@ func TestPrefixExpressionStatements(t *testing.T) {
 	expectedProg := ast.Program{
 		Statements: []ast.Statement{
 			ast.ExpressionStatement{
-				Token: token.Token{Type: token.BANG, Literal: "!"},
+				Token: token.Token{Type: token.BANG, Literal: "!", Pos: pos(1, 1)},
 				Expression: ast.PrefixExpression{
-					Token: token.Token{Type: token.BANG, Literal: "!"},
+					Token: token.Token{Type: token.BANG, Literal: "!", Pos: pos(1, 1)},
 					Expression: ast.IntExpression{
-						Token: token.Token{Type: token.INT, Literal: "5"},
+						Token: token.Token{Type: token.INT, Literal: "5", Pos: pos(1, 2)},
 					},
 				},
 			},
 			ast.ExpressionStatement{
-				Token: token.Token{Type: token.MINUS, Literal: "-"},
+				Token: token.Token{Type: token.MINUS, Literal: "-", Pos: pos(2, 1)},
 				Expression: ast.PrefixExpression{
-					Token: token.Token{Type: token.MINUS, Literal: "-"},
+					Token: token.Token{Type: token.MINUS, Literal: "-", Pos: pos(2, 1)},
 					Expression: ast.IntExpression{
-						Token: token.Token{Type: token.INT, Literal: "15"},
+						Token: token.Token{Type: token.INT, Literal: "15", Pos: pos(2, 2)},
 					},
 				},
 			},
 			ast.ExpressionStatement{
-				Token: token.Token{Type: token.INCREMENT, Literal: "++"},
+				Token: token.Token{Type: token.INCREMENT, Literal: "++", Pos: pos(3, 1)},
 				Expression: ast.PrefixExpression{
-					Token: token.Token{Type: token.INCREMENT, Literal: "++"},
+					Token: token.Token{Type: token.INCREMENT, Literal: "++", Pos: pos(3, 1)},
 					Expression: ast.IdentifierExpression{
-						Token: token.Token{Type: token.IDENTIFIER, Literal: "foobar"},
+						Token: token.Token{Type: token.IDENTIFIER, Literal: "foobar", Pos: pos(3, 3)},
 					},
 				},
 			},
 			ast.ExpressionStatement{
-				Token: token.Token{Type: token.DECREMENT, Literal: "--"},
+				Token: token.Token{Type: token.DECREMENT, Literal: "--", Pos: pos(4, 1)},
 				Expression: ast.PrefixExpression{
-					Token: token.Token{Type: token.DECREMENT, Literal: "--"},
+					Token: token.Token{Type: token.DECREMENT, Literal: "--", Pos: pos(4, 1)},
 					Expression: ast.IdentifierExpression{
-						Token: token.Token{Type: token.IDENTIFIER, Literal: "x"},
+						Token: token.Token{Type: token.IDENTIFIER, Literal: "x", Pos: pos(4, 3)},
 					},
 				},
 			},
@@ -479,6 +493,74 @@ func TestInfixExpressionStatements(t *testing.T) {
 			"{\"str\": 5, true: xyz, 5: false}",
 			"{str: 5, true: xyz, 5: false}",
 		},
+		{
+			"x = 5",
+			"(x = 5)",
+		},
+		{
+			"a = b = 1 + 2",
+			"(a = (b = (1 + 2)))",
+		},
+		{
+			"x += 1 * 2",
+			"(x += (1 * 2))",
+		},
+		{
+			"arr[0] -= 1",
+			"((arr[0]) -= 1)",
+		},
+		{
+			"h[\"k\"] = x == y",
+			"((h[k]) = (x == y))",
+		},
+		{
+			"x++",
+			"(x++)",
+		},
+		{
+			"-x--",
+			"(-(x--))",
+		},
+		{
+			"a + b++ * 2",
+			"(a + ((b++) * 2))",
+		},
+		{
+			"xs[0]++",
+			"((xs[0])++)",
+		},
+		{
+			"1.5 * 2 + 3e2",
+			"((1.5 * 2) + 3e2)",
+		},
+		{
+			"-0.5",
+			"(-0.5)",
+		},
+		{
+			"make_adder(2)(3)",
+			"make_adder(2)(3)",
+		},
+		{
+			"handlers[\"save\"](doc)",
+			"(handlers[save])(doc)",
+		},
+		{
+			"a + f(1)(2) * 3",
+			"(a + (f(1)(2) * 3))",
+		},
+		{
+			"(f)(x)",
+			"f(x)",
+		},
+		{
+			"-f(1)[0]",
+			"(-(f(1)[0]))",
+		},
+		{
+			"fn (x) { x }(1)",
+			"fn (x) {\n\tx\n}(1)",
+		},
 	}
 
 	for i := 0; i < len(tests); i++ {
@@ -561,6 +643,144 @@ func TestComplexExpressions(t *testing.T) {
 
 }
 
+func TestLoopStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"for (i < 10) { ++i; }",
+			`for ((i < 10)) {
+	(++i)
+}`,
+		},
+		{
+			"for (x in [1, 2]) { if (x == 1) { continue; } print(x); break; }",
+			`for (x in [1, 2]) {
+	if (x == 1) {
+		continue;
+	}
+	print(x)
+	break;
+}`,
+		},
+		{
+			"for (k in h) { for (c in k) { c } };",
+			`for (k in h) {
+	for (c in k) {
+		c
+	}
+}`,
+		},
+	}
+
+	for i, tt := range tests {
+		l := lexer.CreateLexer(tt.input)
+		p := CreateParser(l)
+
+		prog, err := p.ParseProgram()
+		if len(err) != 0 {
+			t.Fatal(err)
+		}
+
+		if len(prog.Statements) != 1 {
+			t.Fatalf("error - expected: 1 statements - got: %d", len(prog.Statements))
+		}
+
+		actual := prog.String()
+		if actual != tt.expected {
+			fmt.Printf("error [%d]:\n< EXPECTED >\n%s\n\n< ACTUAL >\n%s", i, tt.expected, actual)
+			t.Fatal()
+		}
+	}
+}
+
+func TestLoopStatementErrors(t *testing.T) {
+	input := `for x < 10 { x };
+for (x in xs { x };`
+	l := lexer.CreateLexer(input)
+	p := CreateParser(l)
+
+	_, err := p.ParseProgram()
+
+	expectedErr := []error{
+		Error{Pos: pos(1, 5), Message: "error - expected: ( - got: IDENTIFIER"},
+		Error{Pos: pos(2, 14), Message: "error - expected: ) - got: {"},
+	}
+
+	if ok := reflect.DeepEqual(err, expectedErr); !ok {
+		t.Fatalf("expected: %v - got: %v", expectedErr, err)
+	}
+}
+
+func TestCallExpressionErrors(t *testing.T) {
+	input := `f(1 2);
+f(1, 2;`
+	l := lexer.CreateLexer(input)
+	p := CreateParser(l)
+
+	_, err := p.ParseProgram()
+
+	expectedErr := []error{
+		Error{Pos: pos(1, 5), Message: "error - expected: ) - got: INT"},
+		Error{Pos: pos(2, 7), Message: "error - expected: ) - got: ;"},
+	}
+
+	if ok := reflect.DeepEqual(err, expectedErr); !ok {
+		t.Fatalf("expected: %v - got: %v", expectedErr, err)
+	}
+}
+
+func TestAssignExpressionErrors(t *testing.T) {
+	input := `5 = 1;
+a + b = 1;
+f() += 2;`
+	l := lexer.CreateLexer(input)
+	p := CreateParser(l)
+
+	_, err := p.ParseProgram()
+
+	expectedErr := []error{
+		Error{Pos: pos(1, 1), Message: "error - invalid assignment target: 5"},
+		Error{Pos: pos(2, 3), Message: "error - invalid assignment target: (a + b)"},
+		Error{Pos: pos(3, 2), Message: "error - invalid assignment target: f()"},
+	}
+
+	if ok := reflect.DeepEqual(err, expectedErr); !ok {
+		t.Fatalf("expected: %v - got: %v", expectedErr, err)
+	}
+}
+
+func TestBlockExpressionFollowedByStatement(t *testing.T) {
+	input := `if (x) { a } let y = 1;
+fn () { if (x) { a } b }
+let f = fn (x) { fn (y) { x } }
+let g = 1;`
+	l := lexer.CreateLexer(input)
+	p := CreateParser(l)
+
+	prog, err := p.ParseProgram()
+	if len(err) != 0 {
+		t.Fatal(err)
+	}
+
+	expected := `if x {
+	a
+}
+let y = 1;
+fn () {
+	if x {
+		a
+	}
+	b
+}
+let f = fn;
+let g = 1;`
+	if prog.String() != expected {
+		t.Fatalf("expected: %s - got: %s", expected, prog.String())
+	}
+}
+
 func whitespaceReplacer(str string) string {
 	output := ""
 	for _, ch := range str {
@@ -576,3 +796,189 @@ func whitespaceReplacer(str string) string {
 
 	return output
 }
+
+func pos(line int, column int) token.Position {
+	return token.Position{Line: line, Column: column}
+}
+
+func TestIllegalTokenErrors(t *testing.T) {
+	input := `let x = 0b102;
+let y = 1 + 0x;
+let z = ^;
+let s = "tab\q";`
+	l := lexer.CreateLexer(input)
+	p := CreateParser(l)
+
+	_, err := p.ParseProgram()
+
+	expectedErr := []error{
+		Error{Pos: pos(1, 9), Message: "error - malformed binary literal 0b102: invalid digit '2'"},
+		Error{Pos: pos(2, 13), Message: "error - malformed hexadecimal literal 0x: missing digits"},
+		Error{Pos: pos(3, 9), Message: "error - unexpected character \"^\""},
+		Error{Pos: pos(4, 13), Message: "error - invalid escape sequence '\\q', valid escapes are \\n \\t \\r \\0 \\\" \\\\ and \\u{...}"},
+	}
+
+	if ok := reflect.DeepEqual(err, expectedErr); !ok {
+		t.Fatalf("expected: %v - got: %v", expectedErr, err)
+	}
+}
+
+func TestParseComments(t *testing.T) {
+	input := `# about x
+#[ and more ]#
+let x = 1; # one
+let f = fn() {
+	# inside
+	return x; # returned
+	# before the bracket
+};
+let y = { # a hash
+	"a": 1, # first
+};
+# at the end`
+
+	commentText := func(comments []ast.Comment) []string {
+		texts := []string{}
+		for _, c := range comments {
+			texts = append(texts, c.String())
+		}
+		return texts
+	}
+
+	l := lexer.CreateLexer(input)
+	p := CreateParserWithMode(l, ParseComments)
+	program, errs := p.ParseProgram()
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	if len(program.Comments) != len(program.Statements) {
+		t.Fatalf("expected comments for %d statements - got: %d", len(program.Statements), len(program.Comments))
+	}
+
+	expectedText := [][2][]string{
+		{{"# about x", "#[ and more ]#"}, {"# one"}},
+		{{}, {}},
+		{{}, {"# a hash", "# first"}},
+	}
+	for i := range expectedText {
+		leading := commentText(program.Comments[i].Leading)
+		trailing := commentText(program.Comments[i].Trailing)
+		if !reflect.DeepEqual(leading, expectedText[i][0]) || !reflect.DeepEqual(trailing, expectedText[i][1]) {
+			t.Fatalf("statement[%d] - expected comments: %v %v - got: %v %v", i, expectedText[i][0], expectedText[i][1], leading, trailing)
+		}
+	}
+
+	if end := commentText(program.EndComments); !reflect.DeepEqual(end, []string{"# at the end"}) {
+		t.Fatalf("expected end comments: [# at the end] - got: %v", end)
+	}
+
+	// comments in a function body are attached to the block, not to the let statement around it
+	fn := program.Statements[1].(ast.LetStatement).Expression.(ast.FunctionExpression)
+	if leading := commentText(fn.Body.Comments[0].Leading); !reflect.DeepEqual(leading, []string{"# inside"}) {
+		t.Fatalf("expected leading comments: [# inside] - got: %v", leading)
+	}
+	if trailing := commentText(fn.Body.Comments[0].Trailing); !reflect.DeepEqual(trailing, []string{"# returned"}) {
+		t.Fatalf("expected trailing comments: [# returned] - got: %v", trailing)
+	}
+	if end := commentText(fn.Body.EndComments); !reflect.DeepEqual(end, []string{"# before the bracket"}) {
+		t.Fatalf("expected end comments: [# before the bracket] - got: %v", end)
+	}
+
+	// without the mode comments are skipped and nothing is attached
+	p = CreateParser(lexer.CreateLexer(input))
+	program, _ = p.ParseProgram()
+	if program.Comments != nil || program.EndComments != nil {
+		t.Fatalf("expected no comments without ParseComments - got: %v %v", program.Comments, program.EndComments)
+	}
+}
+
+func TestTryStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"try { f(); } catch (e) { print(e); }",
+			`try {
+	f()
+} catch (e) {
+	print(e)
+}`,
+		},
+		{
+			"try { f() } finally { g() };",
+			`try {
+	f()
+} finally {
+	g()
+}`,
+		},
+		{
+			"try { f() } catch (err) { err } finally { g() }",
+			`try {
+	f()
+} catch (err) {
+	err
+} finally {
+	g()
+}`,
+		},
+	}
+
+	for i, tt := range tests {
+		l := lexer.CreateLexer(tt.input)
+		p := CreateParser(l)
+
+		prog, err := p.ParseProgram()
+		if len(err) != 0 {
+			t.Fatal(err)
+		}
+
+		if len(prog.Statements) != 1 {
+			t.Fatalf("error - expected: 1 statements - got: %d", len(prog.Statements))
+		}
+
+		actual := prog.String()
+		if actual != tt.expected {
+			fmt.Printf("error [%d]:\n< EXPECTED >\n%s\n\n< ACTUAL >\n%s", i, tt.expected, actual)
+			t.Fatal()
+		}
+	}
+}
+
+func TestTryStatementErrors(t *testing.T) {
+	input := `try { f() };
+try { f() } catch e { e };
+try { f() } catch (1) { e };
+try f();`
+	l := lexer.CreateLexer(input)
+	p := CreateParser(l)
+
+	_, err := p.ParseProgram()
+
+	expectedErr := []error{
+		Error{Pos: pos(1, 1), Message: "error - try without catch or finally"},
+		Error{Pos: pos(2, 19), Message: "error - expected: ( - got: IDENTIFIER"},
+		Error{Pos: pos(3, 20), Message: "error - expected: IDENTIFIER - got: INT"},
+		Error{Pos: pos(4, 5), Message: "error - expected: { - got: IDENTIFIER"},
+	}
+
+	if ok := reflect.DeepEqual(err, expectedErr); !ok {
+		t.Fatalf("expected: %v - got: %v", expectedErr, err)
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	for _, bench := range benchmarks.Corpus() {
+		b.Run(bench.Name, func(b *testing.B) {
+			b.SetBytes(int64(len(bench.Source)))
+			for i := 0; i < b.N; i++ {
+				p := CreateParser(lexer.CreateLexer(bench.Source))
+				if _, errs := p.ParseProgram(); len(errs) > 0 {
+					b.Fatalf("unexpected errors: %v", errs)
+				}
+			}
+		})
+	}
+}
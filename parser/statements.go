@@ -9,6 +9,7 @@ import (
 // - Must have the currToken be the first token in its syntax
 // - When it's done the peekToken will be the first token of the next statement
 
+// parseLetStatement parses both let and const statements, they only differ in the token
 func (p *Parser) parseLetStatement() (ast.LetStatement, []error) {
 	letToken := p.currToken
 	p.nextToken()
@@ -82,3 +83,156 @@ func (p *Parser) parseExpressionStatement() (ast.ExpressionStatement, []error) {
 		Expression: exp,
 	}, nil
 }
+
+func (p *Parser) parseForStatement() (ast.Statement, []error) {
+	forToken := p.currToken
+	p.nextToken()
+
+	if !p.currTokenIs(token.LPAREN) {
+		return nil, []error{p.badTokenTypeError(token.LPAREN)}
+	}
+	p.nextToken()
+
+	// for (x in xs) { ... }
+	if p.currTokenIs(token.IDENTIFIER) && p.peekTokenIs(token.IN) {
+		return p.parseForInStatement(forToken)
+	}
+
+	// for (condition) { ... }
+	condition, errs := p.parseExpression(LOWEST)
+	if len(errs) != 0 {
+		return nil, errs
+	}
+	p.nextToken()
+
+	if !p.currTokenIs(token.RPAREN) {
+		return nil, []error{p.badTokenTypeError(token.RPAREN)}
+	}
+	p.nextToken()
+
+	body, errs := p.ParseBlockStatement()
+	if len(errs) != 0 {
+		return nil, errs
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return ast.ForStatement{
+		Token:     forToken,
+		Condition: condition,
+		Body:      body,
+	}, nil
+}
+
+func (p *Parser) parseForInStatement(forToken token.Token) (ast.Statement, []error) {
+	identExp := p.parseIdentifierExpression()
+	p.nextToken() // in
+	p.nextToken()
+
+	iterable, errs := p.parseExpression(LOWEST)
+	if len(errs) != 0 {
+		return nil, errs
+	}
+	p.nextToken()
+
+	if !p.currTokenIs(token.RPAREN) {
+		return nil, []error{p.badTokenTypeError(token.RPAREN)}
+	}
+	p.nextToken()
+
+	body, errs := p.ParseBlockStatement()
+	if len(errs) != 0 {
+		return nil, errs
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return ast.ForInStatement{
+		Token:      forToken,
+		Identifier: identExp,
+		Iterable:   iterable,
+		Body:       body,
+	}, nil
+}
+
+func (p *Parser) parseBreakStatement() ast.BreakStatement {
+	s := ast.BreakStatement{Token: p.currToken}
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return s
+}
+
+func (p *Parser) parseContinueStatement() ast.ContinueStatement {
+	s := ast.ContinueStatement{Token: p.currToken}
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return s
+}
+
+func (p *Parser) parseTryStatement() (ast.Statement, []error) {
+	stmt := ast.TryStatement{Token: p.currToken}
+	p.nextToken()
+
+	body, errs := p.ParseBlockStatement()
+	if len(errs) != 0 {
+		return nil, errs
+	}
+	stmt.Body = body
+
+	// catch (e) { ... }
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+		p.nextToken()
+
+		if !p.currTokenIs(token.LPAREN) {
+			return nil, []error{p.badTokenTypeError(token.LPAREN)}
+		}
+		p.nextToken()
+
+		if !p.currTokenIs(token.IDENTIFIER) {
+			return nil, []error{p.badTokenTypeError(token.IDENTIFIER)}
+		}
+		param := p.parseIdentifierExpression()
+		p.nextToken()
+
+		if !p.currTokenIs(token.RPAREN) {
+			return nil, []error{p.badTokenTypeError(token.RPAREN)}
+		}
+		p.nextToken()
+
+		catch, errs := p.ParseBlockStatement()
+		if len(errs) != 0 {
+			return nil, errs
+		}
+		stmt.CatchParam = &param
+		stmt.Catch = &catch
+	}
+
+	// finally { ... }
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+		p.nextToken()
+
+		finally, errs := p.ParseBlockStatement()
+		if len(errs) != 0 {
+			return nil, errs
+		}
+		stmt.Finally = &finally
+	}
+
+	if stmt.Catch == nil && stmt.Finally == nil {
+		return nil, []error{errorAt(stmt.Token.Pos, "error - try without catch or finally")}
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt, nil
+}
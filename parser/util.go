@@ -2,11 +2,45 @@ package parser
 
 import (
 	"fmt"
+	"main/ast"
 	"main/token"
 )
 
+// Error is a syntax error found at Pos in the source
+type Error struct {
+	Pos     token.Position
+	Message string
+}
+
+func (e Error) Error() string {
+	if !e.Pos.IsValid() {
+		return e.Message
+	}
+	return e.Pos.String() + ": " + e.Message
+}
+
+func errorAt(pos token.Position, format string, a ...interface{}) error {
+	return Error{Pos: pos, Message: fmt.Sprintf(format, a...)}
+}
+
+// errorf creates an error at the position of the current token
+func (p *Parser) errorf(format string, a ...interface{}) error {
+	return errorAt(p.currToken.Pos, format, a...)
+}
+
 func (p *Parser) badTokenTypeError(expected token.TokenType) error {
-	return fmt.Errorf("error - expected: %s - got: %s", expected, p.currToken.Type)
+	if p.currTokenIs(token.ILLEGAL) {
+		return p.illegalTokenError()
+	}
+	return p.errorf("error - expected: %s - got: %s", expected, p.currToken.Type)
+}
+
+// illegalTokenError reports why the lexer could not make sense of the current token
+func (p *Parser) illegalTokenError() error {
+	if reason, ok := p.l.IllegalReason(p.currToken.Pos); ok {
+		return p.errorf("error - %s", reason)
+	}
+	return p.errorf("error - illegal token: %q", p.currToken.Literal)
 }
 
 func (p *Parser) currTokenIs(t token.TokenType) bool {
@@ -69,6 +103,10 @@ var legalInfexOperator = map[token.TokenType]struct{}{
 	token.GREATER_THAN_EQUAL:    {},
 	token.LESS_THAN_EQUAL:       {},
 	token.LSQPAREN:              {},
+	token.LPAREN:                {},
+	token.EQUAL:                 {},
+	token.PLUS_EQUAL:            {},
+	token.MINUS_EQUAL:           {},
 }
 
 func IsLegalInfixOperator(t token.TokenType) bool {
@@ -76,9 +114,40 @@ func IsLegalInfixOperator(t token.TokenType) bool {
 	return ok
 }
 
+var legalPostfixOperator = map[token.TokenType]struct{}{
+	token.INCREMENT: {},
+	token.DECREMENT: {},
+}
+
+func IsLegalPostfixOperator(t token.TokenType) bool {
+	_, ok := legalPostfixOperator[t]
+	return ok
+}
+
+var assignmentOperator = map[token.TokenType]struct{}{
+	token.EQUAL:       {},
+	token.PLUS_EQUAL:  {},
+	token.MINUS_EQUAL: {},
+}
+
+func IsAssignmentOperator(t token.TokenType) bool {
+	_, ok := assignmentOperator[t]
+	return ok
+}
+
+// only variables and container elements can be written to
+func isAssignable(exp ast.Expression) bool {
+	switch exp.(type) {
+	case ast.IdentifierExpression, ast.IndexExpression:
+		return true
+	}
+	return false
+}
+
 const (
 	_           int = iota
 	LOWEST          // _ (black identifier)
+	ASSIGN          // = or += or -=
 	EQUALS          // ==
 	LESSGREATER     // > or <
 	AND             // &&
@@ -87,11 +156,15 @@ const (
 	SUM             // +
 	PRODUCT         // *
 	PREFIX          // -x or !x
+	POSTFIX         // x++ or x--
 	CALL            // myFunc(x)
 	INDEX           // myArray[x]
 )
 
 var precedences = map[token.TokenType]int{
+	token.EQUAL:                 ASSIGN,
+	token.PLUS_EQUAL:            ASSIGN,
+	token.MINUS_EQUAL:           ASSIGN,
 	token.CONDITIONAL_EQUAL:     EQUALS,
 	token.CONDITIONAL_NOT_EQUAL: EQUALS,
 	token.LESS_THAN:             LESSGREATER,
@@ -107,5 +180,8 @@ var precedences = map[token.TokenType]int{
 	token.SLASH:                 PRODUCT,
 	token.ASTERISK:              PRODUCT,
 	token.MODULUS:               PRODUCT,
+	token.INCREMENT:             POSTFIX,
+	token.DECREMENT:             POSTFIX,
+	token.LPAREN:                CALL,
 	token.LSQPAREN:              INDEX,
 }
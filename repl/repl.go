@@ -0,0 +1,85 @@
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"main/ast"
+	"main/diagnostics"
+	"main/lexer"
+	"main/object"
+	"main/parser"
+)
+
+// Prompt is written before every line the REPL reads
+const Prompt = ">> "
+
+// Runner runs the programs of a session one after the other, later programs see the variables of earlier ones
+type Runner func(program ast.Program) (object.Object, object.ErrorObj)
+
+// Start runs the lines read from in until the input ends or a line calls exit() and the user
+// confirms, and returns the code to exit with. Values go to out, syntax and runtime errors to errOut. The runner has to read the input of scripts from the
+// same *bufio.Reader if in is one, or a line typed for input() may end up in the buffer of the REPL
+func Start(in io.Reader, out io.Writer, errOut io.Writer, run Runner) int {
+	reader := bufio.NewReader(in)
+	inputs := diagnostics.Sources{}
+	for {
+		// prompt user for input
+		io.WriteString(out, Prompt)
+
+		// reading user input
+		line, ok := readLine(reader)
+		if !ok {
+			return 0
+		}
+
+		// lexing, the input keeps its name so later tracebacks can show its lines
+		name := fmt.Sprintf("<stdin-%d>", len(inputs)+1)
+		inputs[name] = line
+		l := lexer.CreateFileLexer(name, line)
+
+		// parsing
+		p := parser.CreateParser(l)
+		program, errs := p.ParseProgram()
+		if len(errs) != 0 {
+			diagnostics.WriteParserErrors(errOut, line, errs)
+			continue
+		}
+
+		// interpreting
+		evaluated, err := run(program)
+		if code, ok := err.ExitCode(); ok {
+			// the session is worth keeping if exit() was typed by mistake
+			fmt.Fprintf(out, "exit(%d) called, quit the session? [y/N] ", code)
+			answer, ok := readLine(reader)
+			if !ok || strings.EqualFold(strings.TrimSpace(answer), "y") {
+				return code
+			}
+			continue
+		}
+		if !err.Ok() {
+			if err.Type() == object.ERROR_OBJ {
+				io.WriteString(errOut, diagnostics.RuntimeError(inputs, err))
+			} else {
+				io.WriteString(errOut, "Unknown error occurred\n")
+			}
+			continue
+		}
+
+		if evaluated != nil && evaluated.Type() != object.NULL_OBJ {
+			io.WriteString(out, evaluated.Inspect())
+			io.WriteString(out, "\n")
+		}
+	}
+}
+
+// readLine reads a line without its line ending, false once the input ended
+func readLine(reader *bufio.Reader) (string, bool) {
+	line, err := reader.ReadString('\n')
+	if err != nil && line == "" {
+		return "", false
+	}
+	return strings.TrimRight(line, "\r\n"), true
+}
@@ -0,0 +1,59 @@
+package repl
+
+import (
+	"bytes"
+	"main/evaluator"
+	"main/hydrogen"
+	"strings"
+	"testing"
+)
+
+func TestStart(t *testing.T) {
+	tests := []struct {
+		input  string
+		out    string
+		errOut string
+		code   int
+	}{
+		{"let x = 2\nx * 3\nprint(\"hi\")\n", ">> >> 6\n>> hi \n>> ", "", 0},
+		{
+			"1 / 0\nlet = 1\n",
+			">> >> >> ",
+			"Traceback (most recent call last):\n  File \"<stdin-1>\", line 1, column 3, in <module>\n    1 / 0\nRuntimeError: division by zero\n" +
+				"<stdin-2>:1:5: error - expected: IDENTIFIER - got: =\nlet = 1\n    ^\n",
+			0,
+		},
+		// a function shows the input it was defined in
+		{
+			"let f = fn() { 1 / 0 }\nf()\n",
+			">> >> >> ",
+			"Traceback (most recent call last):\n  File \"<stdin-2>\", line 1, column 1, in <module>\n    f()\n" +
+				"  File \"<stdin-1>\", line 1, column 18, in f\n    let f = fn() { 1 / 0 }\nRuntimeError: division by zero\n",
+			0,
+		},
+		{"exit(3)\ny\n", ">> exit(3) called, quit the session? [y/N] ", "", 3},
+		{"exit(3)\nn\n1\n", ">> exit(3) called, quit the session? [y/N] >> 1\n>> ", "", 0},
+	}
+
+	for _, engine := range []string{"eval", "vm"} {
+		for _, tt := range tests {
+			var out, errOut bytes.Buffer
+			in := strings.NewReader(tt.input)
+			interpreter, err := hydrogen.New(hydrogen.Options{Engine: engine, Builtins: evaluator.Prelude(), In: in, Out: &out, Err: &errOut})
+			if err != nil {
+				t.Fatalf("%s: %v", engine, err)
+			}
+
+			code := Start(in, &out, &errOut, interpreter.Run)
+			if code != tt.code {
+				t.Errorf("%s: %q: exit code - expected: %d - actual: %d", engine, tt.input, tt.code, code)
+			}
+			if out.String() != tt.out {
+				t.Errorf("%s: %q: output - expected: %q - actual: %q", engine, tt.input, tt.out, out.String())
+			}
+			if errOut.String() != tt.errOut {
+				t.Errorf("%s: %q: errors - expected: %q - actual: %q", engine, tt.input, tt.errOut, errOut.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package resolver
+
+import (
+	"main/ast"
+	"main/token"
+)
+
+func (r *Resolver) resolveStatements(statements []ast.Statement) []ast.Statement {
+	resolved := make([]ast.Statement, len(statements))
+	for i, statement := range statements {
+		resolved[i] = r.resolveStatement(statement)
+	}
+	return resolved
+}
+
+func (r *Resolver) resolveStatement(s ast.Statement) ast.Statement {
+	switch stmt := s.(type) {
+	case ast.BlockStatement:
+		stmt.Statements = r.resolveStatements(stmt.Statements)
+		return stmt
+	case ast.ExpressionStatement:
+		stmt.Expression = r.resolveExpression(stmt.Expression)
+		return stmt
+	case ast.LetStatement:
+		// the value is resolved first, in let x = x the second x is an outer one
+		stmt.Expression = r.resolveExpression(stmt.Expression)
+		stmt.Identifier = r.declare(stmt.Identifier, stmt.IsConst())
+		return stmt
+	case ast.ReturnStatement:
+		if stmt.Expression != nil {
+			stmt.Expression = r.resolveExpression(stmt.Expression)
+		}
+		return stmt
+	case ast.ForStatement:
+		stmt.Condition = r.resolveExpression(stmt.Condition)
+		r.loops++
+		stmt.Body = r.resolveBlock(stmt.Body)
+		r.loops--
+		return stmt
+	case ast.ForInStatement:
+		// the loop variable lives in the scope of each iteration, along with the variables of the body
+		stmt.Iterable = r.resolveExpression(stmt.Iterable)
+		r.enterScope(false)
+		stmt.Identifier = r.declare(stmt.Identifier, false)
+		r.loops++
+		stmt.Body = r.resolveBlockIn(stmt.Body)
+		r.loops--
+		return stmt
+	case ast.TryStatement:
+		stmt.Body = r.resolveBlock(stmt.Body)
+		if stmt.Catch != nil {
+			r.enterScope(false)
+			param := r.declare(*stmt.CatchParam, false)
+			catch := r.resolveBlockIn(*stmt.Catch)
+			stmt.CatchParam, stmt.Catch = &param, &catch
+		}
+		if stmt.Finally != nil {
+			finally := r.resolveBlock(*stmt.Finally)
+			stmt.Finally = &finally
+		}
+		return stmt
+	case ast.BreakStatement:
+		if r.loops == 0 {
+			r.fail("break outside of loop", stmt.Pos())
+		}
+		return stmt
+	case ast.ContinueStatement:
+		if r.loops == 0 {
+			r.fail("continue outside of loop", stmt.Pos())
+		}
+		return stmt
+	default:
+		return s
+	}
+}
+
+// resolveBlock resolves a block with a scope of its own
+func (r *Resolver) resolveBlock(block ast.BlockStatement) ast.BlockStatement {
+	r.enterScope(false)
+	return r.resolveBlockIn(block)
+}
+
+// resolveBlockIn resolves a block in the scope entered for it, and leaves the scope
+func (r *Resolver) resolveBlockIn(block ast.BlockStatement) ast.BlockStatement {
+	r.reserveLets(block.Statements)
+	block.Statements = r.resolveStatements(block.Statements)
+	block.Slots = r.leaveScope()
+	return block
+}
+
+func (r *Resolver) resolveExpressions(expressions []ast.Expression) []ast.Expression {
+	resolved := make([]ast.Expression, len(expressions))
+	for i, exp := range expressions {
+		resolved[i] = r.resolveExpression(exp)
+	}
+	return resolved
+}
+
+func (r *Resolver) resolveExpression(n ast.Expression) ast.Expression {
+	switch exp := n.(type) {
+	case ast.PrefixExpression:
+		if exp.Token.Type == token.INCREMENT || exp.Token.Type == token.DECREMENT {
+			exp.Expression = r.resolveTarget(exp.Expression, exp.Pos())
+		} else {
+			exp.Expression = r.resolveExpression(exp.Expression)
+		}
+		return exp
+	case ast.PostfixExpression:
+		exp.Expression = r.resolveTarget(exp.Expression, exp.Pos())
+		return exp
+	case ast.AssignExpression:
+		exp.Target = r.resolveTarget(exp.Target, exp.Pos())
+		exp.Value = r.resolveExpression(exp.Value)
+		return exp
+	case ast.InfixExpression:
+		exp.Left = r.resolveExpression(exp.Left)
+		exp.Right = r.resolveExpression(exp.Right)
+		return exp
+	case ast.IfExpression:
+		conditions := make([]ast.Expression, len(exp.Conditions))
+		blocks := make([]ast.BlockStatement, len(exp.Blocks))
+		for i := range exp.Blocks {
+			if i < len(exp.Conditions) {
+				conditions[i] = r.resolveExpression(exp.Conditions[i])
+			}
+			blocks[i] = r.resolveBlock(exp.Blocks[i])
+		}
+		exp.Conditions, exp.Blocks = conditions, blocks
+		return exp
+	case ast.IdentifierExpression:
+		binding, ok := r.lookup(exp.TokenLiteral())
+		if !ok {
+			r.fail("unknown identifier: "+exp.TokenLiteral(), exp.Pos())
+		}
+		exp.Binding = binding
+		return exp
+	case ast.FunctionExpression:
+		// parameters and the variables of the body share the scope of the call,
+		// the loops around the function are not around its body
+		loops := r.loops
+		r.loops = 0
+		r.enterScope(true)
+		args := make([]ast.IdentifierExpression, len(exp.Args))
+		for i, arg := range exp.Args {
+			args[i] = r.declare(arg, false)
+		}
+		exp.Args = args
+		exp.Body = r.resolveBlockIn(exp.Body)
+		r.loops = loops
+		return exp
+	case ast.CallExpression:
+		exp.Function = r.resolveExpression(exp.Function)
+		exp.Args = r.resolveExpressions(exp.Args)
+		return exp
+	case ast.ArrayExpression:
+		exp.Elems = r.resolveExpressions(exp.Elems)
+		return exp
+	case ast.IndexExpression:
+		exp.Exp = r.resolveExpression(exp.Exp)
+		exp.Index = r.resolveExpression(exp.Index)
+		return exp
+	case ast.HashExpression:
+		elems := make([]ast.KeyValuePair, len(exp.Elems))
+		for i, kvp := range exp.Elems {
+			kvp.Key = r.resolveExpression(kvp.Key)
+			kvp.Value = r.resolveExpression(kvp.Value)
+			elems[i] = kvp
+		}
+		exp.Elems = elems
+		return exp
+	default:
+		return n
+	}
+}
+
+// resolveTarget resolves what an assignment or update at pos writes to
+func (r *Resolver) resolveTarget(target ast.Expression, pos token.Position) ast.Expression {
+	ident, ok := target.(ast.IdentifierExpression)
+	if !ok {
+		return r.resolveExpression(target)
+	}
+
+	binding, ok := r.lookup(ident.TokenLiteral())
+	if !ok {
+		r.fail("cannot assign to undeclared variable: "+ident.TokenLiteral(), pos)
+	}
+	ident.Binding = binding
+	return ident
+}
@@ -0,0 +1,233 @@
+package resolver
+
+import (
+	"fmt"
+	"main/ast"
+	"main/object"
+	"main/token"
+)
+
+// Resolver finds the variable every identifier of a program refers to before the program runs,
+// and reports names that refer to nothing. It remembers the globals of everything it resolved,
+// so the programs of a REPL session can use what earlier ones declared
+type Resolver struct {
+	isBuiltin    func(name string) bool
+	globals      map[string]int // slots of the variables declared at the top level
+	globalNames  []string
+	declared     map[string]bool // top level variables declared so far, in the order of the source
+	reserved     map[string]bool // top level variables the program being resolved declares
+	builtins     []string
+	builtinIndex map[string]int
+
+	scope *scope          // the scope being resolved, nil at the top level
+	loops int             // loops around the statement being resolved, in the same function
+	err   object.ErrorObj // the first error of the program
+}
+
+// scope is a scope of variables as the evaluator has them: the body of a function call,
+// an iteration of a loop, an if, try, catch or finally block. The top level is not one, its variables are globals
+type scope struct {
+	outer    *scope
+	declared map[string]variable // variables declared so far, in the order of the source
+	reserved map[string]variable // every variable the scope declares, for functions that run once they are all set
+	function bool                // the scope of a function call
+	size     int
+}
+
+type variable struct {
+	slot    int
+	isConst bool
+}
+
+// New returns a resolver for names that are variables or builtins, isBuiltin tells them apart
+func New(isBuiltin func(name string) bool) *Resolver {
+	return &Resolver{
+		isBuiltin:    isBuiltin,
+		globals:      map[string]int{},
+		declared:     map[string]bool{},
+		builtinIndex: map[string]int{},
+	}
+}
+
+// Resolve returns the program with the binding of every identifier and the slots of every block set.
+// It fails on the first name that is neither a variable of a scope around it nor a builtin,
+// or the first break or continue outside of a loop
+func (r *Resolver) Resolve(program ast.Program) (resolved ast.Program, resolveErr object.ErrorObj) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			resolved, resolveErr = ast.Program{}, object.NewErrorObj(fmt.Sprintf("internal error: %v", rec))
+			resolveErr.Kind = object.INTERNAL_ERROR
+		}
+	}()
+
+	r.scope = nil
+	r.loops = 0
+	r.err = object.EmptyErrorObj()
+	r.reserved = map[string]bool{}
+	r.reserveLets(program.Statements)
+
+	resolved = program
+	resolved.Statements = r.resolveStatements(program.Statements)
+	if !r.err.Ok() {
+		return ast.Program{}, r.err
+	}
+	return resolved, object.EmptyErrorObj()
+}
+
+// Globals returns the name of every global slot, the slots of a program are below len(Globals()) once it is resolved
+func (r *Resolver) Globals() []string {
+	return r.globalNames
+}
+
+// Builtins returns the name of every builtin index handed out so far
+func (r *Resolver) Builtins() []string {
+	return r.builtins
+}
+
+// DeclareGlobal declares a top level variable from outside of any program, like a value
+// the program embedding the interpreter sets. Returns its slot
+func (r *Resolver) DeclareGlobal(name string) int {
+	r.declared[name] = true
+	return r.globalSlot(name).slot
+}
+
+// Global returns the slot of a top level variable, false if no program declared it
+func (r *Resolver) Global(name string) (int, bool) {
+	if !r.declared[name] {
+		return 0, false
+	}
+	return r.globals[name], true
+}
+
+// fail records an error of the program, only the first one is reported
+func (r *Resolver) fail(message string, pos token.Position) {
+	if r.err.Ok() {
+		r.err = object.NewErrorObj(message).At(pos)
+	}
+}
+
+// globalSlot returns the slot of a top level variable, making one the first time.
+// Whether a global is a constant is only known once its declaration runs
+func (r *Resolver) globalSlot(name string) variable {
+	slot, ok := r.globals[name]
+	if !ok {
+		slot = len(r.globalNames)
+		r.globalNames = append(r.globalNames, name)
+		r.globals[name] = slot
+	}
+	return variable{slot: slot}
+}
+
+// reserve gives slots to the variables the current scope declares, before any of them is declared
+func (r *Resolver) reserve(name string, isConst bool) variable {
+	if r.scope == nil {
+		r.reserved[name] = true
+		return r.globalSlot(name)
+	}
+
+	if v, ok := r.scope.reserved[name]; ok {
+		return v
+	}
+	v := variable{slot: r.scope.size, isConst: isConst}
+	r.scope.size++
+	r.scope.reserved[name] = v
+	return v
+}
+
+// reserveLets reserves the variables of the let and const statements of a block
+func (r *Resolver) reserveLets(statements []ast.Statement) {
+	for _, statement := range statements {
+		switch stmt := statement.(type) {
+		case ast.LetStatement:
+			r.reserve(stmt.Identifier.TokenLiteral(), stmt.IsConst())
+		case ast.BlockStatement:
+			r.reserveLets(stmt.Statements)
+		}
+	}
+}
+
+// declare makes a reserved variable visible to the code after it, and binds the identifier declaring it
+func (r *Resolver) declare(ident ast.IdentifierExpression, isConst bool) ast.IdentifierExpression {
+	name := ident.TokenLiteral()
+	v := r.reserve(name, isConst)
+
+	if r.scope == nil {
+		r.declared[name] = true
+		ident.Binding = ast.Binding{Scope: ast.Global, Slot: v.slot}
+		return ident
+	}
+
+	r.scope.declared[name] = v
+	ident.Binding = ast.Binding{Scope: ast.Local, Slot: v.slot, Const: v.isConst}
+	return ident
+}
+
+// lookup finds the variable a name refers to. A function body runs once its surroundings
+// have declared their variables, so from inside one the variables declared later count too.
+// A variable used before it is declared still refers to it, and is missing at run time
+func (r *Resolver) lookup(name string) (ast.Binding, bool) {
+	crossed := false
+	var fallback *ast.Binding
+
+	depth := 0
+	for s := r.scope; s != nil; s = s.outer {
+		if v, ok := s.declared[name]; ok {
+			return ast.Binding{Scope: ast.Local, Depth: depth, Slot: v.slot, Const: v.isConst}, true
+		}
+		if v, ok := s.reserved[name]; ok {
+			binding := ast.Binding{Scope: ast.Local, Depth: depth, Slot: v.slot, Const: v.isConst}
+			if crossed {
+				return binding, true
+			}
+			if fallback == nil {
+				fallback = &binding
+			}
+		}
+		if s.function {
+			crossed = true
+		}
+		depth++
+	}
+
+	if slot, ok := r.globals[name]; ok {
+		binding := ast.Binding{Scope: ast.Global, Slot: slot}
+		if r.declared[name] || (r.reserved[name] && crossed) {
+			return binding, true
+		}
+		if r.reserved[name] && fallback == nil {
+			fallback = &binding
+		}
+	}
+
+	if r.isBuiltin(name) {
+		index, ok := r.builtinIndex[name]
+		if !ok {
+			index = len(r.builtins)
+			r.builtins = append(r.builtins, name)
+			r.builtinIndex[name] = index
+		}
+		return ast.Binding{Scope: ast.Builtin, Slot: index}, true
+	}
+
+	if fallback != nil {
+		return *fallback, true
+	}
+	return ast.Binding{}, false
+}
+
+// enterScope starts a scope inside the current one
+func (r *Resolver) enterScope(function bool) {
+	r.scope = &scope{
+		outer:    r.scope,
+		declared: map[string]variable{},
+		reserved: map[string]variable{},
+		function: function,
+	}
+}
+
+// leaveScope ends the current scope and returns how many slots it needs
+func (r *Resolver) leaveScope() int {
+	size := r.scope.size
+	r.scope = r.scope.outer
+	return size
+}
@@ -0,0 +1,217 @@
+package resolver
+
+import (
+	"fmt"
+	"main/ast"
+	"main/lexer"
+	"main/parser"
+	"testing"
+)
+
+var builtins = map[string]bool{"len": true, "print": true}
+
+func isBuiltin(name string) bool { return builtins[name] }
+
+func parse(input string, t *testing.T) ast.Program {
+	l := lexer.CreateLexer(input)
+	p := parser.CreateParser(l)
+	program, errs := p.ParseProgram()
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	return program
+}
+
+// bindings lists the identifiers of the statements in the order of the source, with where they were resolved to
+func bindings(statements []ast.Statement) []string {
+	out := []string{}
+	for _, statement := range statements {
+		switch stmt := statement.(type) {
+		case ast.LetStatement:
+			out = append(out, expressionBindings(stmt.Expression)...)
+			out = append(out, binding(stmt.Identifier))
+		case ast.ExpressionStatement:
+			out = append(out, expressionBindings(stmt.Expression)...)
+		case ast.ForInStatement:
+			out = append(out, expressionBindings(stmt.Iterable)...)
+			out = append(out, binding(stmt.Identifier))
+			out = append(out, bindings(stmt.Body.Statements)...)
+		}
+	}
+	return out
+}
+
+func expressionBindings(exp ast.Expression) []string {
+	switch e := exp.(type) {
+	case ast.IdentifierExpression:
+		return []string{binding(e)}
+	case ast.InfixExpression:
+		return append(expressionBindings(e.Left), expressionBindings(e.Right)...)
+	case ast.CallExpression:
+		out := expressionBindings(e.Function)
+		for _, arg := range e.Args {
+			out = append(out, expressionBindings(arg)...)
+		}
+		return out
+	case ast.FunctionExpression:
+		out := []string{}
+		for _, arg := range e.Args {
+			out = append(out, binding(arg))
+		}
+		return append(out, bindings(e.Body.Statements)...)
+	case ast.IfExpression:
+		out := []string{}
+		for i, block := range e.Blocks {
+			if i < len(e.Conditions) {
+				out = append(out, expressionBindings(e.Conditions[i])...)
+			}
+			out = append(out, bindings(block.Statements)...)
+		}
+		return out
+	}
+	return nil
+}
+
+func binding(ident ast.IdentifierExpression) string {
+	b := ident.Binding
+	switch b.Scope {
+	case ast.Local:
+		return fmt.Sprintf("%s:local %d %d", ident.TokenLiteral(), b.Depth, b.Slot)
+	case ast.Global:
+		return fmt.Sprintf("%s:global %d", ident.TokenLiteral(), b.Slot)
+	case ast.Builtin:
+		return fmt.Sprintf("%s:builtin %d", ident.TokenLiteral(), b.Slot)
+	}
+	return ident.TokenLiteral() + ":unresolved"
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 1; x", []string{"x:global 0", "x:global 0"}},
+		{"len(print)", []string{"len:builtin 0", "print:builtin 1"}},
+		{"let len = 1; len", []string{"len:global 0", "len:global 0"}},
+		{
+			"fn(a) { let b = a; fn() { a + b } }",
+			[]string{"a:local 0 0", "a:local 0 0", "b:local 0 1", "a:local 1 0", "b:local 1 1"},
+		},
+		{
+			// the function runs once the top level declared g
+			"let f = fn() { g() }; let g = fn() { 1 };",
+			[]string{"g:global 1", "f:global 0", "g:global 1"},
+		},
+		{
+			"let x = 1; if (true) { let y = x; let x = 2; y + x }",
+			[]string{"x:global 0", "x:global 0", "y:local 0 0", "x:local 0 1", "y:local 0 0", "x:local 0 1"},
+		},
+		{
+			"for (i in [1, 2]) { let j = i; fn() { i + j } }",
+			[]string{"i:local 0 0", "i:local 0 0", "j:local 0 1", "i:local 1 0", "j:local 1 1"},
+		},
+		{
+			// used before its declaration, the variable is missing at run time
+			"fn() { x; let x = 1 }",
+			[]string{"x:local 0 0", "x:local 0 0"},
+		},
+	}
+
+	for _, tt := range tests {
+		program, err := New(isBuiltin).Resolve(parse(tt.input, t))
+		if !err.Ok() {
+			t.Fatalf("%q: unexpected error: %s", tt.input, err.Inspect())
+		}
+
+		got := bindings(program.Statements)
+		if fmt.Sprint(got) != fmt.Sprint(tt.expected) {
+			t.Errorf("%q: error - expected: %v - actual: %v", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestSlots(t *testing.T) {
+	program, err := New(isBuiltin).Resolve(parse("fn(a, b) { let c = 1; let c = 2; if (a) { let d = 1; let e = 2 } }", t))
+	if !err.Ok() {
+		t.Fatalf("unexpected error: %s", err.Inspect())
+	}
+
+	fn := program.Statements[0].(ast.ExpressionStatement).Expression.(ast.FunctionExpression)
+	if fn.Body.Slots != 3 {
+		t.Errorf("error - expected: 3 slots in the function - actual: %d", fn.Body.Slots)
+	}
+	ifBlock := fn.Body.Statements[2].(ast.ExpressionStatement).Expression.(ast.IfExpression).Blocks[0]
+	if ifBlock.Slots != 2 {
+		t.Errorf("error - expected: 2 slots in the if block - actual: %d", ifBlock.Slots)
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		line     int
+		column   int
+	}{
+		{"missing", "unknown identifier: missing", 1, 1},
+		{"let f = fn() {\n  lenght(1) }", "unknown identifier: lenght", 2, 3},
+		{"if (true) { let y = 1 }; y", "unknown identifier: y", 1, 26},
+		{"if (false) { never }", "unknown identifier: never", 1, 14},
+		{"let x = 1; y = 2", "cannot assign to undeclared variable: y", 1, 14},
+		{"z++; missing", "cannot assign to undeclared variable: z", 1, 2},
+		{"let x = 1\nbreak", "break outside of loop", 2, 1},
+		{"for (true) { let f = fn() {\n  continue } }", "continue outside of loop", 2, 3},
+	}
+
+	for _, tt := range tests {
+		_, err := New(isBuiltin).Resolve(parse(tt.input, t))
+		if err.Ok() {
+			t.Fatalf("%q: expected an error", tt.input)
+		}
+		if err.Message != tt.expected {
+			t.Errorf("%q: error - expected: %q - actual: %q", tt.input, tt.expected, err.Message)
+		}
+		if err.Pos.Line != tt.line || err.Pos.Column != tt.column {
+			t.Errorf("%q: error - expected: %d:%d - actual: %s", tt.input, tt.line, tt.column, err.Pos)
+		}
+	}
+}
+
+func TestGlobalsOfEarlierPrograms(t *testing.T) {
+	r := New(isBuiltin)
+	if _, err := r.Resolve(parse("let x = 1", t)); !err.Ok() {
+		t.Fatalf("unexpected error: %s", err.Inspect())
+	}
+
+	program, err := r.Resolve(parse("let y = x; y", t))
+	if !err.Ok() {
+		t.Fatalf("unexpected error: %s", err.Inspect())
+	}
+	expected := []string{"x:global 0", "y:global 1", "y:global 1"}
+	if got := bindings(program.Statements); fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("error - expected: %v - actual: %v", expected, got)
+	}
+	if fmt.Sprint(r.Globals()) != "[x y]" {
+		t.Errorf("error - expected: globals [x y] - actual: %v", r.Globals())
+	}
+}
+
+func TestDeclareGlobal(t *testing.T) {
+	r := New(isBuiltin)
+	slot := r.DeclareGlobal("len")
+	if _, ok := r.Global("missing"); ok {
+		t.Errorf("error - expected: no slot for a global never declared")
+	}
+
+	program, err := r.Resolve(parse("len = 1; len", t))
+	if !err.Ok() {
+		t.Fatalf("unexpected error: %s", err.Inspect())
+	}
+	expected := []string{fmt.Sprintf("len:global %d", slot)}
+	if got := bindings(program.Statements); fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("error - expected: %v - actual: %v", expected, got)
+	}
+	if got, ok := r.Global("len"); !ok || got != slot {
+		t.Errorf("error - expected: slot %d - actual: %d %t", slot, got, ok)
+	}
+}
@@ -1,23 +1,34 @@
 package token
 
+import "strconv"
+
 const (
 	// special
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
+	COMMENT = "COMMENT" // # line and #[ block ]# comments, only emitted when asked for
 
 	// types
 	IDENTIFIER = "IDENTIFIER" // x, y, foo, variables, ...
 	INT        = "INT"        // integers: 1,2,3,...
+	FLOAT      = "FLOAT"      // floating point: 3.14, 1e-9
 	BOOLEAN    = "BOOLEAN"    // true or false
 	STRING     = "STRING"     // string literals: "hello"
 
 	// keywords
 	LET      = "LET"
+	CONST    = "CONST"
 	FUNCTION = "FUNCTION"
 	IF       = "IF"
 	ELSE     = "ELSE"
 	FOR      = "FOR"
+	IN       = "IN"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
 	RETURN   = "RETURN"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
 
 	// quotes
 	SINGLE_QUOTE  = "'"
@@ -67,17 +78,48 @@ type TokenType string
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position // where the token starts in the source
+}
+
+// Position is a location in the source, lines and columns start at 1
+type Position struct {
+	File   string
+	Line   int
+	Column int
+}
+
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+// Before reports whether p comes before other, both being in the same source
+func (p Position) Before(other Position) bool {
+	return p.Line < other.Line || (p.Line == other.Line && p.Column < other.Column)
+}
+
+// String formats the position as file:line:column, the file is left out when unknown
+func (p Position) String() string {
+	s := strconv.Itoa(p.Line) + ":" + strconv.Itoa(p.Column)
+	if p.File != "" {
+		s = p.File + ":" + s
+	}
+	return s
 }
 
 var keywordTokenMap map[string]Token = map[string]Token{
-	"let":    {Type: LET, Literal: "let"},
-	"fn":     {Type: FUNCTION, Literal: "fn"},
-	"if":     {Type: IF, Literal: "if"},
-	"else":   {Type: ELSE, Literal: "else"},
-	"for":    {Type: FOR, Literal: "for"},
-	"true":   {Type: BOOLEAN, Literal: "true"},
-	"false":  {Type: BOOLEAN, Literal: "false"},
-	"return": {Type: RETURN, Literal: "return"},
+	"let":      {Type: LET, Literal: "let"},
+	"const":    {Type: CONST, Literal: "const"},
+	"fn":       {Type: FUNCTION, Literal: "fn"},
+	"if":       {Type: IF, Literal: "if"},
+	"else":     {Type: ELSE, Literal: "else"},
+	"for":      {Type: FOR, Literal: "for"},
+	"in":       {Type: IN, Literal: "in"},
+	"break":    {Type: BREAK, Literal: "break"},
+	"continue": {Type: CONTINUE, Literal: "continue"},
+	"true":     {Type: BOOLEAN, Literal: "true"},
+	"false":    {Type: BOOLEAN, Literal: "false"},
+	"return":   {Type: RETURN, Literal: "return"},
+	"try":      {Type: TRY, Literal: "try"},
+	"catch":    {Type: CATCH, Literal: "catch"},
+	"finally":  {Type: FINALLY, Literal: "finally"},
 }
 
 var specialTokenMap map[string]Token = map[string]Token{
@@ -0,0 +1,68 @@
+package vm
+
+import "main/object"
+
+// frame is a running call of a compiled function, or the top level of a program
+type frame struct {
+	fn     *object.CompiledFunctionObj
+	ip     int     // offset of the next instruction
+	bp     int     // where the stack of the frame starts, the called function was there
+	scope  *record // the innermost scope with variables of its own
+	blocks []block // the loops and try statements the frame is in, innermost last
+	call   bool    // whether the frame is on the call stack, the top level is not
+	base   bool    // whether returning from the frame ends the run that made it
+}
+
+// record holds the variables of a scope, closures keep the record they were created in
+type record struct {
+	vars  []object.Object
+	outer *record
+}
+
+type blockKind int
+
+const (
+	loopBlock blockKind = iota
+	tryBlock
+)
+
+// block is a loop or try statement, break, continue, return and errors unwind to them
+type block struct {
+	kind    blockKind
+	sp      int     // the stack as it was when the block started
+	scope   *record // the scope as it was when the block started
+	brk     int     // where a loop goes on break
+	cont    int     // where a loop goes on continue
+	catch   int     // where a try goes on an error, 0 once it is caught or without catch
+	finally int     // where a try goes once done, 0 without finally
+}
+
+// iterator is what a for-in loop walks over, the items are a snapshot taken when the loop starts
+type iterator struct {
+	items []object.Object
+	next  int
+}
+
+func (it *iterator) Type() object.ObjectType { return object.ITERATOR_OBJ }
+func (it *iterator) Inspect() string         { return "iterator" }
+
+type completionKind int
+
+const (
+	normalCompletion completionKind = iota
+	errorCompletion
+	returnCompletion
+	breakCompletion
+	continueCompletion
+)
+
+// completion is what a finally block carries on with once it is done: the value of
+// the try statement, or what interrupted it
+type completion struct {
+	kind  completionKind
+	value object.Object
+	err   object.ErrorObj
+}
+
+func (c *completion) Type() object.ObjectType { return object.COMPLETION_OBJ }
+func (c *completion) Inspect() string         { return "completion" }
@@ -0,0 +1,806 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"main/code"
+	"main/compiler"
+	"main/evaluator"
+	"main/object"
+	"strconv"
+)
+
+var (
+	Null  = &object.NullObj{}
+	True  = &object.BooleanObj{Value: true}
+	False = &object.BooleanObj{Value: false}
+)
+
+var infixOperators = map[code.Opcode]string{
+	code.OpAdd:          "+",
+	code.OpSub:          "-",
+	code.OpMul:          "*",
+	code.OpDiv:          "/",
+	code.OpMod:          "%",
+	code.OpEqual:        "==",
+	code.OpNotEqual:     "!=",
+	code.OpLess:         "<",
+	code.OpLessEqual:    "<=",
+	code.OpGreater:      ">",
+	code.OpGreaterEqual: ">=",
+	code.OpAnd:          "&&",
+	code.OpOr:           "||",
+	code.OpBitAnd:       "&",
+	code.OpBitOr:        "|",
+}
+
+var prefixOperators = map[code.Opcode]string{
+	code.OpMinus:     "-",
+	code.OpBang:      "!",
+	code.OpIncrement: "++",
+	code.OpDecrement: "--",
+}
+
+// VM runs bytecode. Globals are kept from one run to the next, so a REPL can run
+// the programs of a session one after the other
+type VM struct {
+	constants    []object.Object
+	globals      []object.Object
+	constGlobals []bool
+	globalNames  []string
+	builtins     []*evaluator.Builtin
+	builtinNames []string
+
+	stack []object.Object
+	sp    int // the next free slot of the stack
+
+	frames       []*frame
+	callStack    []object.Frame // calls of functions and builtins, innermost call last
+	maxCallDepth int            // 0 for no limit
+
+	env    evaluator.Environment // passed to builtins, functions they call are run by the vm
+	budget *evaluator.Budget     // what the run used of its limits, kept by env so builtins count with it
+}
+
+// New returns a vm for programs that can call builtins, nil for none.
+// The compiler of the bytecode has to be given the same builtins
+func New(builtins *evaluator.Builtins) *VM {
+	vm := &VM{
+		stack:        make([]object.Object, 256),
+		maxCallDepth: evaluator.DefaultMaxCallDepth,
+		env:          evaluator.NewEnvironment(builtins),
+	}
+	vm.env.SetCallFunc(vm.callFunction)
+	vm.budget = vm.env.Budget()
+	return vm
+}
+
+// SetMaxCallDepth limits how deep calls may nest, deeper calls raise a RecursionError. 0 removes the limit
+func (vm *VM) SetMaxCallDepth(depth int) {
+	vm.maxCallDepth = depth
+}
+
+// SetIO makes builtins read from in, write to out and report problems to errOut, like Environment.SetIO
+func (vm *VM) SetIO(in io.Reader, out io.Writer, errOut io.Writer) {
+	vm.env.SetIO(in, out, errOut)
+}
+
+// SetLimits limits the steps and elements of every run from now on, like Environment.SetLimits
+func (vm *VM) SetLimits(limits evaluator.Limits) {
+	vm.env.SetLimits(limits)
+}
+
+// SetContext makes runs fail with a LimitError once ctx is done, like Environment.SetContext
+func (vm *VM) SetContext(ctx context.Context) {
+	vm.env.SetContext(ctx)
+}
+
+// CallStack returns a copy of the current call stack, outermost call first
+func (vm *VM) CallStack() []object.Frame {
+	if len(vm.callStack) == 0 {
+		return nil
+	}
+	return append([]object.Frame{}, vm.callStack...)
+}
+
+// Run runs a compiled program and returns the value of its last statement, or what it returns.
+// As with the evaluator, a bug that makes Go panic is returned as an internal error
+func (vm *VM) Run(bytecode *compiler.Bytecode) (result object.Object, runErr object.ErrorObj) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, runErr = object.NullObj{}, object.NewErrorObj(fmt.Sprintf("internal error: %v", r))
+			runErr.Kind = object.INTERNAL_ERROR
+			vm.frames, vm.callStack, vm.sp = nil, nil, 0
+		}
+	}()
+
+	vm.load(bytecode)
+	vm.sp = 0
+	// the record of the top level holds the variables of its blocks
+	main := &record{vars: make([]object.Object, bytecode.Main.NumLocals)}
+	vm.frames = append(vm.frames[:0], &frame{fn: bytecode.Main, base: true, scope: main})
+	vm.callStack = vm.callStack[:0]
+	vm.budget.Reset()
+	return vm.run()
+}
+
+// Call calls a function value from outside of any program, like the function a program
+// embedding the interpreter looked up. As with Run a panic is returned as an internal error
+func (vm *VM) Call(fn object.Object, args []object.Object) (result object.Object, callErr object.ErrorObj) {
+	// a builtin the host registered may call back while a program runs, only an outermost call starts afresh
+	if len(vm.frames) == 0 {
+		defer func() {
+			if r := recover(); r != nil {
+				result, callErr = object.NullObj{}, object.NewErrorObj(fmt.Sprintf("internal error: %v", r))
+				callErr.Kind = object.INTERNAL_ERROR
+				vm.frames, vm.callStack, vm.sp = nil, nil, 0
+			}
+		}()
+		vm.sp = 0
+		vm.callStack = vm.callStack[:0]
+		vm.budget.Reset()
+	}
+
+	switch funcObj := fn.(type) {
+	case *object.ClosureObj:
+		return vm.callFunction(funcObj, args)
+	case *evaluator.Builtin:
+		return funcObj.Fn(vm.env, args...)
+	default:
+		return object.NullObj{}, object.NewErrorObj("not a function: " + string(fn.Type()))
+	}
+}
+
+// Global returns the value in a global slot, nil until the variable is declared
+func (vm *VM) Global(slot int) object.Object {
+	if slot >= len(vm.globals) {
+		return nil
+	}
+	return vm.globals[slot]
+}
+
+// SetGlobal assigns to the variable in a global slot, constants cannot be assigned to
+func (vm *VM) SetGlobal(slot int, value object.Object) object.ErrorObj {
+	for len(vm.globals) <= slot {
+		vm.globals = append(vm.globals, nil)
+		vm.constGlobals = append(vm.constGlobals, false)
+	}
+	if vm.constGlobals[slot] {
+		return object.NewErrorObj("cannot assign to constant: " + vm.globalNames[slot])
+	}
+	vm.globals[slot] = value
+	return object.ErrorObj{}
+}
+
+// load takes in the constants, globals and builtins a program adds to those of the programs before it
+func (vm *VM) load(bytecode *compiler.Bytecode) {
+	vm.constants = bytecode.Constants
+	vm.globalNames = bytecode.GlobalNames
+	for len(vm.globals) < len(bytecode.GlobalNames) {
+		vm.globals = append(vm.globals, nil)
+		vm.constGlobals = append(vm.constGlobals, false)
+	}
+	// builtins may have been replaced or removed since the last program, every one is looked up again
+	vm.builtins = vm.builtins[:0]
+	for _, name := range bytecode.Builtins {
+		builtin, _ := vm.env.Builtins().Lookup(name)
+		vm.builtins = append(vm.builtins, builtin)
+	}
+	vm.builtinNames = bytecode.Builtins
+}
+
+func (vm *VM) push(obj object.Object) {
+	if vm.sp == len(vm.stack) {
+		vm.stack = append(vm.stack, nil)
+		vm.stack = vm.stack[:cap(vm.stack)]
+	}
+	vm.stack[vm.sp] = obj
+	vm.sp++
+}
+
+func (vm *VM) pop() object.Object {
+	vm.sp--
+	return vm.stack[vm.sp]
+}
+
+func nativeBool(value bool) *object.BooleanObj {
+	if value {
+		return True
+	}
+	return False
+}
+
+// run executes instructions until the frame it started in returns
+func (vm *VM) run() (object.Object, object.ErrorObj) {
+	fr := vm.frames[len(vm.frames)-1]
+
+	for {
+		ins := fr.fn.Instructions
+		start := fr.ip
+		op := code.Opcode(ins[start])
+		fr.ip++
+
+		var err object.ErrorObj
+		switch op {
+		case code.OpConstant:
+			vm.push(vm.constants[code.ReadUint16(ins[fr.ip:])])
+			fr.ip += 2
+		case code.OpNull:
+			vm.push(Null)
+		case code.OpTrue:
+			vm.push(True)
+		case code.OpFalse:
+			vm.push(False)
+		case code.OpPop:
+			vm.sp--
+		case code.OpDup:
+			vm.push(vm.stack[vm.sp-1])
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+			code.OpEqual, code.OpNotEqual, code.OpLess, code.OpLessEqual, code.OpGreater, code.OpGreaterEqual,
+			code.OpAnd, code.OpOr, code.OpBitAnd, code.OpBitOr:
+			right := vm.pop()
+			left := vm.pop()
+			var result object.Object
+			result, err = vm.infix(op, left, right)
+			if err.Ok() {
+				vm.push(result)
+			}
+
+		case code.OpMinus, code.OpBang, code.OpIncrement, code.OpDecrement:
+			var result object.Object
+			result, err = evaluator.EvalPrefixOperator(prefixOperators[op], vm.pop())
+			if err.Ok() {
+				vm.push(result)
+			}
+		case code.OpStep:
+			operator := "--"
+			if ins[fr.ip] == 1 {
+				operator = "++"
+			}
+			fr.ip++
+			vm.stack[vm.sp-1], err = evaluator.StepUpdate(operator)(vm.stack[vm.sp-1])
+
+		case code.OpJump:
+			fr.ip = int(code.ReadUint32(ins[fr.ip:]))
+		case code.OpJumpNotTrue:
+			// same as the evaluator, anything that isn't a true boolean is false
+			if cond, ok := vm.pop().(*object.BooleanObj); ok && cond.Value {
+				fr.ip += 4
+			} else {
+				fr.ip = int(code.ReadUint32(ins[fr.ip:]))
+			}
+
+		case code.OpGetGlobal:
+			slot := int(code.ReadUint16(ins[fr.ip:]))
+			fr.ip += 2
+			if value := vm.globals[slot]; value != nil {
+				vm.push(value)
+			} else {
+				err = object.NewErrorObj("unknown identifier: " + vm.globalNames[slot])
+			}
+		case code.OpSetGlobal:
+			vm.globals[code.ReadUint16(ins[fr.ip:])] = vm.stack[vm.sp-1]
+			fr.ip += 2
+		case code.OpDeclarableGlobal, code.OpDefineGlobal, code.OpDefineConstGlobal:
+			slot := int(code.ReadUint16(ins[fr.ip:]))
+			fr.ip += 2
+			if vm.globals[slot] != nil {
+				err = object.NewErrorObj(fmt.Sprintf("variable '%s' already exists in this scope", vm.globalNames[slot]))
+				break
+			}
+			if op == code.OpDeclarableGlobal {
+				break
+			}
+			vm.globals[slot] = vm.pop()
+			vm.constGlobals[slot] = op == code.OpDefineConstGlobal
+		case code.OpAssignableGlobal:
+			slot := int(code.ReadUint16(ins[fr.ip:]))
+			fr.ip += 2
+			if vm.globals[slot] == nil {
+				err = object.NewErrorObj("cannot assign to undeclared variable: " + vm.globalNames[slot])
+			} else if vm.constGlobals[slot] {
+				err = object.NewErrorObj("cannot assign to constant: " + vm.globalNames[slot])
+			}
+		case code.OpGetLocal:
+			vm.push(fr.scope.vars[code.ReadUint16(ins[fr.ip:])])
+			fr.ip += 2
+		case code.OpSetLocal:
+			fr.scope.vars[code.ReadUint16(ins[fr.ip:])] = vm.stack[vm.sp-1]
+			fr.ip += 2
+		case code.OpInitLocal:
+			fr.scope.vars[code.ReadUint16(ins[fr.ip:])] = vm.pop()
+			fr.ip += 2
+		case code.OpGetOuter, code.OpSetOuter:
+			scope := fr.scope
+			for hops := int(ins[fr.ip]); hops > 0; hops-- {
+				scope = scope.outer
+			}
+			slot := int(code.ReadUint16(ins[fr.ip+1:]))
+			name := vm.constants[code.ReadUint16(ins[fr.ip+3:])].Inspect()
+			fr.ip += 5
+
+			// variables of outer scopes may not be declared yet when a function runs
+			if scope.vars[slot] == nil && op == code.OpGetOuter {
+				err = object.NewErrorObj("unknown identifier: " + name)
+			} else if scope.vars[slot] == nil {
+				err = object.NewErrorObj("cannot assign to undeclared variable: " + name)
+			} else if op == code.OpGetOuter {
+				vm.push(scope.vars[slot])
+			} else {
+				scope.vars[slot] = vm.stack[vm.sp-1]
+			}
+		case code.OpGetBuiltin:
+			index := int(ins[fr.ip])
+			fr.ip++
+			if vm.builtins[index] == nil {
+				err = object.NewErrorObj("unknown identifier: " + vm.builtinNames[index])
+				break
+			}
+			vm.push(vm.builtins[index])
+		case code.OpPushScope:
+			fr.scope = &record{vars: make([]object.Object, code.ReadUint16(ins[fr.ip:])), outer: fr.scope}
+			fr.ip += 2
+		case code.OpPopScope:
+			fr.scope = fr.scope.outer
+
+		case code.OpArray:
+			count := int(code.ReadUint16(ins[fr.ip:]))
+			fr.ip += 2
+			elements := make([]object.Object, count)
+			copy(elements, vm.stack[vm.sp-count:vm.sp])
+			vm.sp -= count
+			if err = vm.budget.Allocate(count); err.Ok() {
+				vm.push(&object.ArrayObj{Elements: elements})
+			}
+		case code.OpHash:
+			count := int(code.ReadUint16(ins[fr.ip:]))
+			fr.ip += 2
+			var hash object.Object
+			hash, err = buildHash(vm.stack[vm.sp-2*count : vm.sp])
+			vm.sp -= 2 * count
+			if err.Ok() {
+				err = vm.budget.Allocate(count)
+			}
+			if err.Ok() {
+				vm.push(hash)
+			}
+		case code.OpIndex:
+			index := vm.pop()
+			var element object.Object
+			element, err = evaluator.EvalIndexOperator(vm.pop(), index)
+			if err.Ok() {
+				vm.push(element)
+			}
+		case code.OpUpdateIndex:
+			kind, operator := int(ins[fr.ip]), string(ins[fr.ip+1])
+			fr.ip += 2
+			err = vm.updateIndex(kind, operator)
+
+		case code.OpClosure:
+			fn := vm.constants[code.ReadUint16(ins[fr.ip:])].(*object.CompiledFunctionObj)
+			fr.ip += 2
+			vm.push(&object.ClosureObj{Name: fn.Name, Fn: fn, Env: fr.scope})
+		case code.OpNameFunction:
+			// functions are named after the variable they are first bound to, for stack traces
+			if closure, ok := vm.stack[vm.sp-1].(*object.ClosureObj); ok && closure.Name == "" {
+				named := *closure
+				named.Name = vm.constants[code.ReadUint16(ins[fr.ip:])].Inspect()
+				vm.stack[vm.sp-1] = &named
+			}
+			fr.ip += 2
+		case code.OpCall, code.OpTailCall:
+			argc := int(ins[fr.ip])
+			site := fr.fn.CallSites[code.ReadUint16(ins[fr.ip+1:])]
+			fr.ip += 3
+
+			switch callee := vm.stack[vm.sp-1-argc].(type) {
+			case *object.ClosureObj:
+				if op == code.OpTailCall {
+					fr, err = vm.tailCall(fr, callee, argc, site)
+				} else if next, callErr := vm.callClosure(callee, argc, site); callErr.Ok() {
+					fr = next
+				} else {
+					err = callErr
+				}
+			case *evaluator.Builtin:
+				args := make([]object.Object, argc)
+				copy(args, vm.stack[vm.sp-argc:vm.sp])
+				var result object.Object
+				result, err = vm.callBuiltin(callee, args, site)
+				if !err.Ok() {
+					break
+				}
+				vm.sp -= argc + 1
+				if op != code.OpTailCall {
+					vm.push(result)
+					break
+				}
+				// a returned builtin call is made here, and its value returned
+				var done bool
+				if fr, done = vm.returnValue(fr, result); done {
+					return result, object.EmptyErrorObj()
+				}
+			default:
+				err = object.NewErrorObj("not a function: " + string(callee.Type()))
+			}
+		case code.OpReturnValue:
+			value := vm.pop()
+			var done bool
+			if fr, done = vm.returnValue(fr, value); done {
+				return value, object.EmptyErrorObj()
+			}
+
+		case code.OpIter:
+			var items []object.Object
+			items, err = evaluator.IterableItems(vm.pop())
+			if err.Ok() {
+				vm.push(&iterator{items: items})
+			}
+		case code.OpIterNext:
+			it := vm.stack[vm.sp-1].(*iterator)
+			if it.next < len(it.items) {
+				vm.push(it.items[it.next])
+				it.next++
+				fr.ip += 4
+			} else {
+				fr.ip = int(code.ReadUint32(ins[fr.ip:]))
+			}
+		case code.OpIteration:
+			err = vm.budget.Step()
+
+		case code.OpSetupLoop:
+			fr.blocks = append(fr.blocks, block{
+				kind:  loopBlock,
+				sp:    vm.sp,
+				scope: fr.scope,
+				brk:   int(code.ReadUint32(ins[fr.ip:])),
+				cont:  int(code.ReadUint32(ins[fr.ip+4:])),
+			})
+			fr.ip += 8
+		case code.OpSetupTry:
+			fr.blocks = append(fr.blocks, block{
+				kind:    tryBlock,
+				sp:      vm.sp,
+				scope:   fr.scope,
+				catch:   int(code.ReadUint32(ins[fr.ip:])),
+				finally: int(code.ReadUint32(ins[fr.ip+4:])),
+			})
+			fr.ip += 8
+		case code.OpPopBlock:
+			fr.blocks = fr.blocks[:len(fr.blocks)-1]
+		case code.OpBreak:
+			vm.unwindLoop(fr, breakCompletion)
+		case code.OpContinue:
+			vm.unwindLoop(fr, continueCompletion)
+		case code.OpCompletion:
+			vm.stack[vm.sp-1] = &completion{kind: normalCompletion, value: vm.stack[vm.sp-1]}
+		case code.OpEndFinally:
+			c := vm.pop().(*completion)
+			switch c.kind {
+			case normalCompletion:
+				vm.push(c.value)
+			case errorCompletion:
+				err = c.err
+			case returnCompletion:
+				var done bool
+				if fr, done = vm.returnValue(fr, c.value); done {
+					return c.value, object.EmptyErrorObj()
+				}
+			default:
+				vm.unwindLoop(fr, c.kind)
+			}
+		case code.OpRaise:
+			err = object.NewErrorObj(vm.constants[code.ReadUint16(ins[fr.ip:])].Inspect())
+			fr.ip += 2
+
+		default:
+			err = object.NewErrorObj(fmt.Sprintf("unknown opcode: %d", op))
+			err.Kind = object.INTERNAL_ERROR
+		}
+
+		if !err.Ok() {
+			var unhandled object.ErrorObj
+			if fr, unhandled = vm.throw(err, start); !unhandled.Ok() {
+				return object.NullObj{}, unhandled
+			}
+		}
+	}
+}
+
+// infix applies an infix operator, ints are handled here to spare the common case the checks of the evaluator
+func (vm *VM) infix(op code.Opcode, left, right object.Object) (object.Object, object.ErrorObj) {
+	leftInt, leftOk := left.(*object.IntegerObj)
+	rightInt, rightOk := right.(*object.IntegerObj)
+	if leftOk && rightOk {
+		switch op {
+		case code.OpAdd:
+			return &object.IntegerObj{Value: leftInt.Value + rightInt.Value}, object.ErrorObj{}
+		case code.OpSub:
+			return &object.IntegerObj{Value: leftInt.Value - rightInt.Value}, object.ErrorObj{}
+		case code.OpMul:
+			return &object.IntegerObj{Value: leftInt.Value * rightInt.Value}, object.ErrorObj{}
+		case code.OpLess:
+			return nativeBool(leftInt.Value < rightInt.Value), object.ErrorObj{}
+		case code.OpLessEqual:
+			return nativeBool(leftInt.Value <= rightInt.Value), object.ErrorObj{}
+		case code.OpGreater:
+			return nativeBool(leftInt.Value > rightInt.Value), object.ErrorObj{}
+		case code.OpGreaterEqual:
+			return nativeBool(leftInt.Value >= rightInt.Value), object.ErrorObj{}
+		case code.OpEqual:
+			return nativeBool(leftInt.Value == rightInt.Value), object.ErrorObj{}
+		case code.OpNotEqual:
+			return nativeBool(leftInt.Value != rightInt.Value), object.ErrorObj{}
+		}
+	}
+	result, err := evaluator.EvalInfixOperator(infixOperators[op], left, right)
+	if !err.Ok() {
+		return result, err
+	}
+	return result, vm.budget.AllocateString(result)
+}
+
+func buildHash(items []object.Object) (object.Object, object.ErrorObj) {
+	pairs := make(map[object.HashKey]object.HashPair, len(items)/2)
+	for i := 0; i < len(items); i += 2 {
+		key, ok := items[i].(object.Hashable)
+		if !ok {
+			return nil, object.NewErrorObj("unhashable key type: " + string(items[i].Type()))
+		}
+		pairs[key.HashKey()] = object.HashPair{Key: items[i], Value: items[i+1]}
+	}
+	return &object.HashObj{Pairs: pairs}, object.ErrorObj{}
+}
+
+// updateIndex writes to a container element, see the code.Update constants
+func (vm *VM) updateIndex(kind int, operator string) object.ErrorObj {
+	var value object.Object
+	if kind == code.UpdateAssign || kind == code.UpdateCompound {
+		value = vm.pop()
+	}
+	index := vm.pop()
+	container := vm.pop()
+
+	var update func(object.Object) (object.Object, object.ErrorObj)
+	switch kind {
+	case code.UpdateAssign:
+		update = func(object.Object) (object.Object, object.ErrorObj) { return value, object.ErrorObj{} }
+	case code.UpdateCompound:
+		update = func(current object.Object) (object.Object, object.ErrorObj) {
+			updated, err := evaluator.CompoundOperator(operator, current, value)
+			if !err.Ok() {
+				return updated, err
+			}
+			return updated, vm.budget.AllocateString(updated)
+		}
+	default:
+		update = evaluator.StepUpdate(operator + operator)
+	}
+
+	old, updated, err := evaluator.AssignIndex(container, index, update, vm.budget)
+	if !err.Ok() {
+		return err
+	}
+	if kind == code.UpdatePostfix {
+		vm.push(old)
+	} else {
+		vm.push(updated)
+	}
+	return object.ErrorObj{}
+}
+
+// callClosure starts a call of a compiled function, whose arguments are on the stack above it
+func (vm *VM) callClosure(fn *object.ClosureObj, argc int, site code.CallSite) (*frame, object.ErrorObj) {
+	if argc != len(fn.Fn.Parameters) {
+		return nil, object.NewErrorObj(
+			"wrong number of arguments: expected " + strconv.Itoa(len(fn.Fn.Parameters)) +
+				", got " + strconv.Itoa(argc),
+		)
+	}
+
+	// raised before the call is made, so the stack shows the calls that led to it
+	if vm.maxCallDepth > 0 && len(vm.callStack) >= vm.maxCallDepth {
+		err := object.NewErrorObj("maximum recursion depth exceeded")
+		err.Kind = object.RECURSION_ERROR
+		err.Pos = site.Pos
+		err.Stack = vm.CallStack()
+		return nil, err
+	}
+	if err := vm.budget.Step(); !err.Ok() {
+		err.Pos = site.Pos
+		err.Stack = vm.CallStack()
+		return nil, err
+	}
+
+	name := fn.Name
+	if name == "" {
+		name = "<anonymous>"
+	}
+	vm.callStack = append(vm.callStack, object.Frame{Function: name, CallSite: site.Pos})
+
+	bp := vm.sp - argc - 1
+	vars := make([]object.Object, fn.Fn.NumLocals)
+	copy(vars, vm.stack[bp+1:vm.sp])
+	outer, _ := fn.Env.(*record)
+	vm.sp = bp
+
+	fr := &frame{fn: fn.Fn, bp: bp, scope: &record{vars: vars, outer: outer}, call: true}
+	vm.frames = append(vm.frames, fr)
+	return fr, object.ErrorObj{}
+}
+
+// tailCall makes a returned call in place of the returning one, so tail recursion runs in constant space
+func (vm *VM) tailCall(fr *frame, fn *object.ClosureObj, argc int, site code.CallSite) (*frame, object.ErrorObj) {
+	if argc != len(fn.Fn.Parameters) {
+		return fr, object.NewErrorObj(
+			"wrong number of arguments: expected " + strconv.Itoa(len(fn.Fn.Parameters)) +
+				", got " + strconv.Itoa(argc),
+		)
+	}
+
+	// the returning call leaves the stack first, the new one can never be deeper
+	vm.callStack = vm.callStack[:len(vm.callStack)-1]
+	vm.frames = vm.frames[:len(vm.frames)-1]
+	copy(vm.stack[fr.bp:], vm.stack[vm.sp-argc-1:vm.sp])
+	vm.sp = fr.bp + argc + 1
+
+	next, err := vm.callClosure(fn, argc, site)
+	if !err.Ok() {
+		return fr, err
+	}
+	next.base = fr.base
+	return next, err
+}
+
+// callBuiltin calls a builtin, which is on the call stack while it runs
+func (vm *VM) callBuiltin(fn *evaluator.Builtin, args []object.Object, site code.CallSite) (object.Object, object.ErrorObj) {
+	if err := vm.budget.Step(); !err.Ok() {
+		return object.NullObj{}, err
+	}
+	vm.callStack = append(vm.callStack, object.Frame{Function: site.Callee, CallSite: site.Pos})
+	result, err := fn.Fn(vm.env, args...)
+	vm.callStack = vm.callStack[:len(vm.callStack)-1]
+	return result, err
+}
+
+// callFunction calls a function for a builtin, like the function map() is given. The call is
+// made from where the builtin was called, and runs until it returns
+func (vm *VM) callFunction(fn object.Callable, args []object.Object) (object.Object, object.ErrorObj) {
+	if builtin, ok := fn.(*evaluator.Builtin); ok {
+		if err := vm.budget.Step(); !err.Ok() {
+			return object.NullObj{}, err
+		}
+		return builtin.Fn(vm.env, args...)
+	}
+
+	closure, ok := fn.(*object.ClosureObj)
+	if !ok {
+		return object.NullObj{}, object.NewErrorObj("not a function: " + string(fn.Type()))
+	}
+
+	var site code.CallSite
+	if len(vm.callStack) > 0 {
+		site.Pos = vm.callStack[len(vm.callStack)-1].CallSite
+	}
+
+	sp := vm.sp
+	vm.push(closure)
+	for _, arg := range args {
+		vm.push(arg)
+	}
+	fr, err := vm.callClosure(closure, len(args), site)
+	if !err.Ok() {
+		vm.sp = sp
+		return object.NullObj{}, err
+	}
+	fr.base = true
+	return vm.run()
+}
+
+// popFrame leaves a frame, its stack and its place on the call stack
+func (vm *VM) popFrame(fr *frame) {
+	vm.frames = vm.frames[:len(vm.frames)-1]
+	if fr.call {
+		vm.callStack = vm.callStack[:len(vm.callStack)-1]
+	}
+	vm.sp = fr.bp
+}
+
+// returnValue returns from a frame, running the finally blocks it is in first. It returns the frame
+// to carry on in, or true when the frame was the base of the run
+func (vm *VM) returnValue(fr *frame, value object.Object) (*frame, bool) {
+	for len(fr.blocks) > 0 {
+		b := fr.blocks[len(fr.blocks)-1]
+		fr.blocks = fr.blocks[:len(fr.blocks)-1]
+		if b.kind == tryBlock && b.finally != 0 {
+			vm.sp, fr.scope = b.sp, b.scope
+			vm.push(&completion{kind: returnCompletion, value: value})
+			fr.ip = b.finally
+			return fr, false
+		}
+	}
+
+	vm.popFrame(fr)
+	if fr.base {
+		return fr, true
+	}
+	vm.push(value)
+	return vm.frames[len(vm.frames)-1], false
+}
+
+// unwindLoop goes to the closest loop for a break or a continue, running the finally blocks on the way first
+func (vm *VM) unwindLoop(fr *frame, kind completionKind) {
+	for {
+		b := fr.blocks[len(fr.blocks)-1]
+		vm.sp, fr.scope = b.sp, b.scope
+
+		if b.kind == loopBlock {
+			if kind == breakCompletion {
+				fr.blocks = fr.blocks[:len(fr.blocks)-1]
+				fr.ip = b.brk
+			} else {
+				fr.ip = b.cont
+			}
+			return
+		}
+
+		fr.blocks = fr.blocks[:len(fr.blocks)-1]
+		if b.finally != 0 {
+			vm.push(&completion{kind: kind})
+			fr.ip = b.finally
+			return
+		}
+	}
+}
+
+// throw unwinds to the closest try statement that handles err, and returns the frame it is in.
+// The error is returned when no try statement of the run handles it
+func (vm *VM) throw(err object.ErrorObj, offset int) (*frame, object.ErrorObj) {
+	fr := vm.frames[len(vm.frames)-1]
+	err = err.At(fr.fn.SourceMap.Lookup(offset))
+	if err.CallStack() == nil && len(vm.callStack) > 0 {
+		err.Stack = vm.CallStack()
+	}
+
+	for {
+		for len(fr.blocks) > 0 {
+			b := &fr.blocks[len(fr.blocks)-1]
+			if b.kind != tryBlock {
+				fr.blocks = fr.blocks[:len(fr.blocks)-1]
+				continue
+			}
+
+			vm.sp, fr.scope = b.sp, b.scope
+			if b.catch != 0 && err.Catchable() {
+				// the finally block still runs after the catch block
+				fr.ip = b.catch
+				if b.finally != 0 {
+					b.catch = 0
+				} else {
+					fr.blocks = fr.blocks[:len(fr.blocks)-1]
+				}
+				vm.push(&object.ErrorValueObj{Err: err})
+				return fr, object.ErrorObj{}
+			}
+
+			fr.blocks = fr.blocks[:len(fr.blocks)-1]
+			if b.finally == 0 {
+				continue
+			}
+			fr.ip = b.finally
+			vm.push(&completion{kind: errorCompletion, err: err})
+			return fr, object.ErrorObj{}
+		}
+
+		vm.popFrame(fr)
+		if fr.base {
+			return nil, err
+		}
+
+		// errors without a position of their own point to the call they come out of
+		fr = vm.frames[len(vm.frames)-1]
+		err = err.At(fr.fn.SourceMap.Lookup(fr.ip - 1))
+	}
+}
@@ -0,0 +1,77 @@
+package vm
+
+import (
+	"fmt"
+	"main/compiler"
+	"main/evaluator"
+	"main/lexer"
+	"main/object"
+	"main/parser"
+	"strings"
+	"testing"
+)
+
+func run(input string, t *testing.T) (object.Object, object.ErrorObj) {
+	p := parser.CreateParser(lexer.CreateLexer(input))
+	program, errs := p.ParseProgram()
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	builtins := evaluator.Prelude()
+	bytecode, err := compiler.New(builtins).Compile(program)
+	if !err.Ok() {
+		return object.NullObj{}, err
+	}
+	return New(builtins).Run(bytecode)
+}
+
+// list joins n items made by item, separated by sep
+func list(n int, sep string, item func(i int) string) string {
+	items := make([]string, n)
+	for i := range items {
+		items[i] = item(i)
+	}
+	return strings.Join(items, sep)
+}
+
+func name(i int) string { return fmt.Sprintf("p%d", i) }
+
+func number(i int) string { return fmt.Sprint(i) }
+
+// operands too wide for their instruction fail to compile instead of running truncated
+func TestOperandLimits(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{fmt.Sprintf("let f = fn(%s) { p254 }; f(%s)", list(255, ", ", name), list(255, ", ", number)), 254},
+		{fmt.Sprintf("let f = fn(%s) { p255 }; f(%s)", list(256, ", ", name), list(256, ", ", number)),
+			"program too large to compile: OpCall needs operand 256, at most 255"},
+		{fmt.Sprintf("len([%s])", list(65535, ", ", number)), 65535},
+		{fmt.Sprintf("len([%s])", list(70000, ", ", func(int) string { return "1" })),
+			"program too large to compile: OpArray needs operand 70000, at most 65535"},
+		{fmt.Sprintf("len({%s})", list(70000, ", ", func(int) string { return "1: 1" })),
+			"program too large to compile: OpHash needs operand 70000, at most 65535"},
+		{"let s = 0; " + list(70000, "; ", func(i int) string { return fmt.Sprintf("s += %d", i) }),
+			"program too large to compile: OpConstant needs operand 65536, at most 65535"},
+	}
+
+	for _, tt := range tests {
+		result, err := run(tt.input, t)
+		switch expected := tt.expected.(type) {
+		case int:
+			if !err.Ok() {
+				t.Errorf("%.40q: unexpected error: %s", tt.input, err.Inspect())
+				continue
+			}
+			if integer, ok := result.(*object.IntegerObj); !ok || integer.Value != int64(expected) {
+				t.Errorf("%.40q: error - expected: %d - actual: %s", tt.input, expected, result.Inspect())
+			}
+		case string:
+			if err.Ok() || err.Message != expected {
+				t.Errorf("%.40q: error - expected: %s - actual: %s", tt.input, expected, err.Inspect())
+			}
+		}
+	}
+}